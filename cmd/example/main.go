@@ -30,8 +30,18 @@ func main() {
 		defer page.Close()
 	}
 
-	// Initialize a new B+ Tree instance
-	tree, err := bp3disk.Initialize[int, string](
+	// Some sorted key-value pairs
+	values := func(yield func(int, string) bool) {
+		for i := 0; i < 1000000; i++ {
+			if !yield(i, fmt.Sprintf("value_%d", i)) {
+				return
+			}
+		}
+	}
+
+	// Initialize a new B+ Tree instance, bulk loaded with the key-value pairs
+	tree, err := bp3disk.BulkLoad(
+		values,
 		store,
 		pages[0],
 		bp3disk.WithIndexPages(pages[1:]),
@@ -42,11 +52,6 @@ func main() {
 		return
 	}
 
-	for i := 0; i < 1000000; i++ {
-		// Insert some key-value pairs
-		tree.Insert(i, fmt.Sprintf("value_%d", i))
-	}
-
 	// Flush the tree to the storage
 	if err := bp3disk.Flush(tree); err != nil {
 		fmt.Println("Error flushing B+ Tree:", err)
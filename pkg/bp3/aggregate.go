@@ -0,0 +1,236 @@
+package bp3
+
+// Monoid describes an aggregate of key-value pairs, such as a sum, a maximum or a count of their values.
+// Combine must be associative, and Identity must be its neutral element. The generic parameters K and V
+// are for the key and value types, and A is for the aggregate type.
+type Monoid[K any, V any, A any] interface {
+	Identity() A              // Identity returns the aggregate of no key-value pairs.
+	Lift(kv KeyValue[K, V]) A // Lift returns the aggregate of a single key-value pair.
+	Combine(a, b A) A         // Combine returns the aggregate of two adjacent aggregates, a before b.
+}
+
+// EqualMonoid is a Monoid that also tells whether two aggregates are equal. Validate checks the
+// cached aggregates against their subtrees only for such monoids, as aggregates that are computed
+// in a different order may differ, for example by rounding, and equal ones may differ in representation.
+type EqualMonoid[K any, V any, A any] interface {
+	Monoid[K, V, A]
+	Equal(a, b A) bool // Equal returns true if the aggregates are equal.
+}
+
+// Aggregator is a Monoid whose aggregate type is erased, as cached by the internal nodes of an instance.
+// The generic parameters K and V are for the key and value types, respectively.
+type Aggregator[K any, V any] interface {
+	Identity() any
+	Lift(kv KeyValue[K, V]) any
+	Combine(a, b any) any
+	Equal(a, b any) (equal bool, known bool) // Equal returns whether the aggregates are equal, if the monoid can tell.
+}
+
+// Aggregating returns the aggregator of a monoid.
+func Aggregating[K any, V any, A any](m Monoid[K, V, A]) Aggregator[K, V] {
+	return aggregator[K, V, A]{m}
+}
+
+type aggregator[K any, V any, A any] struct {
+	m Monoid[K, V, A]
+}
+
+func (a aggregator[K, V, A]) Identity() any {
+	return a.m.Identity()
+}
+
+func (a aggregator[K, V, A]) Lift(kv KeyValue[K, V]) any {
+	return a.m.Lift(kv)
+}
+
+func (a aggregator[K, V, A]) Combine(x, y any) any {
+	return a.m.Combine(x.(A), y.(A))
+}
+
+func (a aggregator[K, V, A]) Equal(x, y any) (bool, bool) {
+	if m, ok := a.m.(EqualMonoid[K, V, A]); ok {
+		return m.Equal(x.(A), y.(A)), true
+	}
+
+	return false, false
+}
+
+// MonoidFunc returns a monoid of the given identity and functions.
+func MonoidFunc[K any, V any, A any](identity A, lift func(KeyValue[K, V]) A, combine func(a, b A) A) Monoid[K, V, A] {
+	return monoidFunc[K, V, A]{identity, lift, combine}
+}
+
+type monoidFunc[K any, V any, A any] struct {
+	identity A
+	lift     func(KeyValue[K, V]) A
+	combine  func(a, b A) A
+}
+
+func (m monoidFunc[K, V, A]) Identity() A {
+	return m.identity
+}
+
+func (m monoidFunc[K, V, A]) Lift(kv KeyValue[K, V]) A {
+	return m.lift(kv)
+}
+
+func (m monoidFunc[K, V, A]) Combine(a, b A) A {
+	return m.combine(a, b)
+}
+
+// EqualMonoidFunc returns a monoid of the given identity and functions, whose aggregates are compared
+// by the given equal function.
+func EqualMonoidFunc[K any, V any, A any](identity A, lift func(KeyValue[K, V]) A, combine func(a, b A) A, equal func(a, b A) bool) EqualMonoid[K, V, A] {
+	return equalMonoidFunc[K, V, A]{monoidFunc[K, V, A]{identity, lift, combine}, equal}
+}
+
+type equalMonoidFunc[K any, V any, A any] struct {
+	monoidFunc[K, V, A]
+	equal func(a, b A) bool
+}
+
+func (m equalMonoidFunc[K, V, A]) Equal(a, b A) bool {
+	return m.equal(a, b)
+}
+
+// Aggregate returns the aggregate of the key-value pairs of an instance within the specified range,
+// in ascending key order. It combines the aggregates cached for the subtrees covered by the range,
+// and lifts only the pairs of the two leaves at its boundaries. It panics if the instance has no
+// monoid, or one of another aggregate type.
+func Aggregate[A any, K any, V any](t *Instance[K, V], from, to RangeValue[K]) A {
+	if t.Aggregator == nil {
+		panic("bp3: instance has no monoid")
+	}
+
+	if t.Root == nil || t.compare(to.Value, from.Value) < 0 {
+		return t.Aggregator.Identity().(A)
+	}
+
+	return t.fold(t.Root, &from, &to).(A)
+}
+
+// fold returns the aggregate of the key-value pairs of a subtree within the given bounds, nil if unbounded.
+func (t *Instance[K, V]) fold(root NodeDescriptor[K, V], from, to *RangeValue[K]) any {
+	node := root.Read()
+
+	if node.Leaf() {
+		i, j := 0, len(node.Values)
+
+		if from != nil {
+			i = t.search(node.Values, from.Value, !from.Closed)
+		}
+
+		if to != nil {
+			j = t.search(node.Values, to.Value, to.Closed)
+		}
+
+		return t.lift(node.Values[i:max(i, j)])
+	}
+
+	// the children between the boundaries are covered by the range
+	i, j := 0, len(node.Children)-1
+
+	if from != nil {
+		i = t.child(node.Mins, from.Value, !from.Closed)
+	}
+
+	if to != nil {
+		j = t.child(node.Mins, to.Value, to.Closed)
+	}
+
+	if i > j {
+		return t.Aggregator.Identity()
+	}
+
+	if i == j {
+		return t.fold(node.Children[i], from, to)
+	}
+
+	a := t.fold(node.Children[i], from, nil)
+
+	for _, b := range t.aggregates(node)[i+1 : j] {
+		a = t.Aggregator.Combine(a, b)
+	}
+
+	return t.Aggregator.Combine(a, t.fold(node.Children[j], nil, to))
+}
+
+// lift returns the aggregate of a run of key-value pairs.
+func (t *Instance[K, V]) lift(values []KeyValue[K, V]) any {
+	a := t.Aggregator.Identity()
+
+	for _, kv := range values {
+		a = t.Aggregator.Combine(a, t.Aggregator.Lift(kv))
+	}
+
+	return a
+}
+
+// summarize returns the aggregate of the subtree of a node.
+func (t *Instance[K, V]) summarize(d NodeDescriptor[K, V]) any {
+	node := d.Read()
+
+	if node.Leaf() {
+		return t.lift(node.Values)
+	}
+
+	a := t.Aggregator.Identity()
+
+	for _, b := range t.aggregates(node) {
+		a = t.Aggregator.Combine(a, b)
+	}
+
+	return a
+}
+
+// aggregates returns the aggregate of each child subtree of an internal node,
+// computing them if the node was built without aggregates.
+func (t *Instance[K, V]) aggregates(node *Node[K, V]) []any {
+	if len(node.Aggregates) == len(node.Children) {
+		return node.Aggregates
+	}
+
+	s := make([]any, len(node.Children))
+
+	for i, child := range node.Children {
+		s[i] = t.summarize(child)
+	}
+
+	return s
+}
+
+// reaggregate sets the aggregates of all the children of an internal node, after its children changed.
+func (t *Instance[K, V]) reaggregate(d NodeDescriptor[K, V]) {
+	if t.Aggregator == nil || d.Read().Leaf() {
+		return
+	}
+
+	s := make([]any, len(d.Read().Children))
+
+	for i, child := range d.Read().Children {
+		s[i] = t.summarize(child)
+	}
+
+	d.Write().Aggregates = s
+}
+
+// regather sets the aggregate of the i-th child of an internal node, after the child subtree changed.
+func (t *Instance[K, V]) regather(d NodeDescriptor[K, V], i int) {
+	if t.Aggregator == nil {
+		return
+	}
+
+	if node := d.Read(); len(node.Aggregates) != len(node.Children) {
+		t.reaggregate(d)
+		return
+	}
+
+	d.Write().Aggregates[i] = t.summarize(d.Read().Children[i])
+}
+
+// regatherPath sets the aggregates along a path from the root, after its leaf changed.
+func (t *Instance[K, V]) regatherPath(p path[K, V]) {
+	for j := len(p) - 1; j >= 0; j-- {
+		t.regather(p[j].node, p[j].i)
+	}
+}
@@ -0,0 +1,138 @@
+package bp3_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+// sum is the monoid of the sum of the values.
+var sum = bp3.EqualMonoidFunc(0, func(kv bp3.KeyValue[int, int]) int {
+	return kv.Value
+}, func(a, b int) int {
+	return a + b
+}, func(a, b int) bool {
+	return a == b
+})
+
+func sumRange(tree *bp3.Instance[int, int], from, to bp3.RangeValue[int]) int {
+	s := 0
+
+	for _, v := range tree.Range(from, to) {
+		s += v
+	}
+
+	return s
+}
+
+func TestAggregate(t *testing.T) {
+	test := func(order int, options ...bp3.Option) {
+		r := rand.New(rand.NewSource(int64(order)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order), bp3.WithMonoid(sum))...)
+
+		check := func(step string) {
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("order %d, %s: %v", order, step, err)
+			}
+
+			for range 20 {
+				from := bp3.RangeValue[int]{Value: r.Intn(600) - 50, Closed: r.Intn(2) == 0}
+				to := bp3.RangeValue[int]{Value: r.Intn(600) - 50, Closed: r.Intn(2) == 0}
+
+				if got, want := bp3.Aggregate[int](tree, from, to), sumRange(tree, from, to); got != want {
+					t.Fatalf("order %d, %s: aggregate of %v..%v is %d, expected %d", order, step, from, to, got, want)
+				}
+			}
+		}
+
+		for _, i := range r.Perm(500) {
+			tree.Insert(i, i)
+		}
+
+		check("insert")
+
+		for i := range 500 {
+			tree.Insert(i, 2*i)
+		}
+
+		check("replace")
+
+		for _, i := range r.Perm(500)[:350] {
+			tree.Delete(i)
+		}
+
+		check("delete")
+
+		c := tree.Cursor()
+
+		for ok := c.SeekFirst(); ok; ok = c.Next() {
+			c.SetValue(c.Value() + 1)
+		}
+
+		check("cursor")
+
+		tree.DeleteRange(bp3.RangeValue[int]{Value: 100, Closed: true}, bp3.RangeValue[int]{Value: 300, Closed: false})
+		check("delete range")
+
+		left, right := tree.SplitAt(400)
+
+		if got := bp3.Aggregate[int](right, bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 1000, Closed: true}); got != sumRange(right, bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 1000, Closed: true}) {
+			t.Fatalf("order %d: aggregate of the right half is %d", order, got)
+		}
+
+		tree, _ = bp3.Join(left, right)
+		check("join")
+	}
+
+	for _, order := range []int{3, 4, 5, 8, 33} {
+		test(order)
+		test(order, bp3.WithCopyOnWrite())
+	}
+}
+
+func TestAggregateDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates(), bp3.WithMonoid(sum))
+
+	for i := range 300 {
+		tree.Insert(i%10, i)
+	}
+
+	tree.Replace(5, 1000)
+
+	for i := range 10 {
+		from, to := bp3.RangeValue[int]{Value: i, Closed: true}, bp3.RangeValue[int]{Value: i, Closed: true}
+
+		if got, want := bp3.Aggregate[int](tree, from, to), sumRange(tree, from, to); got != want {
+			t.Fatalf("aggregate of %d is %d, expected %d", i, got, want)
+		}
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAggregateBulkLoad(t *testing.T) {
+	seq := func(yield func(int, int) bool) {
+		for i := range 1000 {
+			if !yield(i, i) {
+				return
+			}
+		}
+	}
+
+	tree, err := bp3.BulkLoad(seq, bp3.WithOrder(5), bp3.WithFillFactor(0.7), bp3.WithMonoid(sum))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bp3.Aggregate[int](tree, bp3.RangeValue[int]{Value: 10, Closed: true}, bp3.RangeValue[int]{Value: 20, Closed: false}); got != 145 {
+		t.Fatalf("aggregate is %d, expected 145", got)
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,30 +1,47 @@
 package bp3
 
-import "golang.org/x/exp/constraints"
-
 // NodeDescriptor defines methods for reading and writing nodes.
-// The generic parameters K and V are for the key and value types, respectively, where K must be ordered.
-type NodeDescriptor[K constraints.Ordered, V any] interface {
+// The generic parameters K and V are for the key and value types, respectively.
+type NodeDescriptor[K any, V any] interface {
 	Read() *Node[K, V]  // Read returns a pointer to the node.
 	Write() *Node[K, V] // Write returns a pointer to the node for modification.
 }
 
 // NodeLoader defines a method for loading node descriptors.
-// The generic parameters K and V are for the key and value types, respectively, where K must be ordered.
-type NodeLoader[K constraints.Ordered, V any] interface {
+// The generic parameters K and V are for the key and value types, respectively.
+type NodeLoader[K any, V any] interface {
 	Load(d NodeDescriptor[K, V]) error // Load loads the specified node descriptor.
 }
 
 // NodeBuilder defines methods for creating, updating, and deleting nodes.
-// The generic parameters K and V are for the key and value types, respectively, where K must be ordered.
-type NodeBuilder[K constraints.Ordered, V any] interface {
+// The generic parameters K and V are for the key and value types, respectively.
+type NodeBuilder[K any, V any] interface {
 	Create(node *Node[K, V]) NodeDescriptor[K, V] // Create creates a new node descriptor for the given node.
 	Update(d NodeDescriptor[K, V])                // Update updates the specified node descriptor.
 	Delete(d NodeDescriptor[K, V])                // Delete deletes the specified node descriptor.
 	Flush() error                                 // Flush flushes any pending changes.
 }
 
-func readSafe[K constraints.Ordered, V any](d NodeDescriptor[K, V]) *Node[K, V] {
+// NodeCopier is implemented by node builders that support copy-on-write instances.
+// The generic parameters K and V are for the key and value types, respectively.
+type NodeCopier[K any, V any] interface {
+	Own(d NodeDescriptor[K, V]) NodeDescriptor[K, V] // Own returns a writable descriptor, copying the node if it was created by another builder.
+	Fork(readOnly bool) NodeBuilder[K, V]            // Fork returns a new builder for an instance that shares the existing nodes.
+}
+
+// NodeJournal is implemented by node builders that support transactions, see Journal.
+type NodeJournal interface {
+	Mark() int        // Mark starts a new level of changes and returns it.
+	Undo(level int)   // Undo restores the nodes changed since the level was marked, and ends it with the levels after it.
+	Commit(level int) // Commit ends the level and the levels after it, keeping their changes.
+}
+
+// NodeSizer is implemented by node descriptors that know the encoded size of their nodes.
+type NodeSizer interface {
+	Size() int64 // Size returns the encoded size of the node in bytes, zero if it was not encoded yet.
+}
+
+func readSafe[K any, V any](d NodeDescriptor[K, V]) *Node[K, V] {
 	if d == nil {
 		return nil
 	}
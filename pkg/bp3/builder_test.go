@@ -2,6 +2,7 @@ package bp3_test
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"slices"
 	"testing"
@@ -36,6 +37,7 @@ func (d *testNodeDescriptor[K, V]) Write() *bp3.Node[K, V] {
 
 type record[K constraints.Ordered, V any] struct {
 	mins     []K
+	counts   []int
 	children []string
 	values   []bp3.KeyValue[K, V]
 	next     string
@@ -43,12 +45,15 @@ type record[K constraints.Ordered, V any] struct {
 }
 
 type testNodeBuilder[K constraints.Ordered, V any] struct {
-	update map[string]*bp3.Node[K, V]
-	disk   map[string]*record[K, V]
-	delete []string
+	update  map[string]*bp3.Node[K, V]
+	disk    map[string]*record[K, V]
+	delete  []string
+	loads   int // loads is the number of Load calls.
+	updates int // updates is the number of Update calls.
 }
 
 func (b *testNodeBuilder[K, V]) Load(d bp3.NodeDescriptor[K, V]) error {
+	b.loads++
 	td := d.(*testNodeDescriptor[K, V])
 	saved := b.disk[td.id]
 
@@ -76,6 +81,7 @@ func (b *testNodeBuilder[K, V]) Load(d bp3.NodeDescriptor[K, V]) error {
 
 	td.node = &bp3.Node[K, V]{
 		Mins:     saved.mins,
+		Counts:   saved.counts,
 		Values:   saved.values,
 		Children: children,
 		Next:     next,
@@ -99,6 +105,7 @@ func (b *testNodeBuilder[K, V]) Create(node *bp3.Node[K, V]) bp3.NodeDescriptor[
 }
 
 func (b *testNodeBuilder[K, V]) Update(d bp3.NodeDescriptor[K, V]) {
+	b.updates++
 	td := d.(*testNodeDescriptor[K, V])
 	b.update[td.id] = td.node
 }
@@ -136,6 +143,7 @@ func (b *testNodeBuilder[K, V]) Flush() error {
 
 		b.disk[id] = &record[K, V]{
 			mins:     slices.Clone(node.Mins),
+			counts:   slices.Clone(node.Counts),
 			values:   slices.Clone(node.Values),
 			children: children,
 			next:     next,
@@ -268,3 +276,127 @@ func TestTreeInsertFlushInsertSync(t *testing.T) {
 	test(10, 1000)
 	test(15, 10000)
 }
+
+func TestTreePopMinNSync(t *testing.T) {
+	test := func(order int, n int, pop int) {
+		builder := &testNodeBuilder[int, string]{
+			disk:   make(map[string]*record[int, string]),
+			update: make(map[string]*bp3.Node[int, string]),
+		}
+
+		tree := &bp3.Instance[int, string]{Order: order, Builder: builder}
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		builder.Flush()
+
+		loaded := &bp3.Instance[int, string]{
+			Root:    &testNodeDescriptor[int, string]{id: tree.Root.(*testNodeDescriptor[int, string]).id, builder: builder, loader: builder},
+			Order:   order,
+			Size:    n,
+			Builder: builder,
+		}
+
+		height := loaded.Stats(0).Height
+		builder.loads, builder.updates = 0, 0
+
+		s := loaded.PopMinN(pop)
+
+		if len(s) != pop || s[0].Key != 0 || s[pop-1].Key != pop-1 {
+			t.Fatalf("order %d: popped %d pairs", order, len(s))
+		}
+
+		// the popped leaves are loaded once, and only the nodes along the boundary (and their
+		// siblings) are loaded besides them and written, instead of a descent for each pair
+		if leaves := (pop + order - 1) / (order / 2); builder.loads > leaves+3*height {
+			t.Fatalf("order %d: %d loads for %d pairs", order, builder.loads, pop)
+		}
+
+		if builder.updates > 12*height {
+			t.Fatalf("order %d: %d updates for %d pairs", order, builder.updates, pop)
+		}
+
+		rest := bp3.Slice(loaded.Root)
+
+		if loaded.Count() != n-pop || len(rest) != n-pop || rest[0].Key != pop || loaded.Min != pop {
+			t.Fatalf("order %d: count %d, %d pairs left", order, loaded.Count(), len(rest))
+		}
+	}
+
+	test(3, 1000, 100)
+	test(10, 10000, 1000)
+	test(15, 10000, 3000)
+}
+
+func TestTreeBuildSync(t *testing.T) {
+	test := func(order int, n int, fail bool) {
+		builder := &testNodeBuilder[int, string]{
+			disk:   make(map[string]*record[int, string]),
+			update: make(map[string]*bp3.Node[int, string]),
+		}
+
+		tree := &bp3.Instance[int, string]{Order: order, Builder: builder}
+		most := 0
+
+		seq := func(yield func(int, string) bool) {
+			for i := 0; i < n; i++ {
+				if i%100 == 0 {
+					built := 0
+
+					for _, node := range builder.update {
+						if node.Leaf() {
+							built += len(node.Values)
+						}
+					}
+
+					// the pairs not yet in a leaf are at most those of two leaves
+					most = max(most, i-built)
+				}
+
+				if !yield(i, fmt.Sprint(i)) {
+					return
+				}
+			}
+
+			if fail {
+				yield(0, "0")
+			}
+		}
+
+		err := tree.Build(seq, 1)
+
+		if fail {
+			if !errors.Is(err, bp3.ErrUnsorted) || tree.Root != nil {
+				t.Fatalf("order %d: unexpected error %v", order, err)
+			}
+
+			if builder.Flush(); len(builder.disk) != 0 {
+				t.Fatalf("order %d: %d nodes left", order, len(builder.disk))
+			}
+
+			return
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if most > 2*order {
+			t.Fatalf("order %d: %d pairs held", order, most)
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("order %d: %v", order, err)
+		}
+
+		if s := bp3.Slice(tree.Root); len(s) != n || s[n-1].Key != n-1 {
+			t.Fatalf("order %d: %d pairs", order, len(s))
+		}
+	}
+
+	test(3, 1000, false)
+	test(10, 10000, false)
+	test(10, 10000, true)
+}
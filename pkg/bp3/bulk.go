@@ -0,0 +1,238 @@
+package bp3
+
+import (
+	"cmp"
+	"errors"
+	"iter"
+	"math"
+	"slices"
+
+	"golang.org/x/exp/constraints"
+)
+
+var (
+	ErrNotEmpty     = errors.New("bp3: instance is not empty")
+	ErrUnsorted     = errors.New("bp3: input is not sorted")
+	ErrDuplicateKey = errors.New("bp3: duplicate key")
+)
+
+// BulkLoad creates a new instance of b+tree structure with the specified options
+// from a sequence of key-value pairs sorted in ascending key order.
+func BulkLoad[K constraints.Ordered, V any](seq iter.Seq2[K, V], options ...Option) (*Instance[K, V], error) {
+	return BulkLoadFunc(cmp.Compare[K], seq, options...)
+}
+
+// BulkLoadFunc creates a new instance of b+tree structure with the specified options
+// from a sequence of key-value pairs sorted in ascending order of the given compare function,
+// or of the natural order of K if it is nil. It returns ErrUnordered if K has none.
+func BulkLoadFunc[K any, V any](compare func(a, b K) int, seq iter.Seq2[K, V], options ...Option) (*Instance[K, V], error) {
+	if compare == nil {
+		var err error
+
+		if compare, err = NaturalOrder[K](); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := buildOptions(options...)
+	tree := NewFunc[K, V](compare, options...)
+
+	if err := tree.Build(seq, opts.fill); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// Build fills an empty instance with a sequence of key-value pairs sorted in ascending key order.
+// The nodes are built bottom-up through the instance builder, each filled to the given fraction
+// (0, 1] of the order, as the pairs arrive, so that only the nodes along the right edge of the
+// tree are held until they are full. It returns an error if the instance is not empty or if the
+// sequence is not ascending, or has equal keys while the instance does not allow duplicates, in
+// which case the nodes built so far are deleted.
+func (t *Instance[K, V]) Build(seq iter.Seq2[K, V], fill float64) error {
+	if t.Root != nil {
+		return ErrNotEmpty
+	}
+
+	if fill <= 0 || fill > 1 {
+		fill = 1
+	}
+
+	b := spine[K, V]{tree: t}
+	b.size, b.lower = b.sizes(true, fill)
+	b.fanout, b.least = b.sizes(false, fill)
+
+	var err error
+
+	for key, value := range seq {
+		if b.n > 0 {
+			if c := t.compare(b.values[len(b.values)-1].Key, key); c == 0 && !t.Duplicates {
+				err = ErrDuplicateKey
+			} else if c > 0 {
+				err = ErrUnsorted
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		b.add(KeyValue[K, V]{Key: key, Value: value})
+	}
+
+	root := b.finish()
+
+	if err != nil {
+		if root != nil {
+			t.drop(root)
+		}
+
+		return err
+	}
+
+	if root == nil {
+		return nil
+	}
+
+	t.Root = root
+	t.Min = minimum(root).Read().Values[0].Key
+	t.Size = b.n
+	t.Version++
+
+	if t.observed() {
+		for p, leaf := t.first(); leaf != nil; leaf = t.next(&p, leaf) {
+			for _, kv := range leaf.Read().Values {
+				t.inserted(kv)
+			}
+		}
+	}
+
+	return nil
+}
+
+// spine is the state of Build: the pairs of the leaf being filled, and for each internal level,
+// the children of the node being filled, which are not yet under a parent.
+type spine[K any, V any] struct {
+	tree          *Instance[K, V]
+	values        []KeyValue[K, V]
+	levels        []entries[K, V]
+	prev          NodeDescriptor[K, V] // prev is the last leaf built.
+	n             int                  // n is the number of pairs added.
+	size, lower   int                  // size is the number of pairs to fill a leaf with, lower the least it can be left with.
+	fanout, least int                  // fanout and least are the same for the children of an internal node.
+}
+
+// entries are the children of an internal node, with their minimum keys and counts.
+type entries[K any, V any] struct {
+	children []NodeDescriptor[K, V]
+	mins     []K
+	weights  []int
+}
+
+// sizes returns the number of entries to fill a node with, and the least number it can be left with.
+func (b *spine[K, V]) sizes(leaf bool, fill float64) (int, int) {
+	upper, lower := b.tree.capacity(leaf), b.tree.least(leaf)
+	return min(max(int(math.Round(float64(upper)*fill)), lower, 1), upper), lower
+}
+
+// add adds a pair to the leaf being filled, and builds a leaf once the pairs left after it
+// are enough for another one, so that the last leaf is never underfull.
+func (b *spine[K, V]) add(kv KeyValue[K, V]) {
+	b.values = append(b.values, kv)
+	b.n++
+
+	if len(b.values) >= b.size+b.lower {
+		b.leaf(b.values[:b.size:b.size])
+		b.values = slices.Clone(b.values[b.size:])
+	}
+}
+
+// leaf builds a leaf of the given pairs, links it after the previous one, and adds it to its parent.
+func (b *spine[K, V]) leaf(values []KeyValue[K, V]) {
+	t := b.tree
+	leaf := t.Builder.Create(&Node[K, V]{Values: values})
+
+	if b.prev != nil && !t.CopyOnWrite {
+		leaf.Read().Prev = b.prev
+		b.prev.Write().Next = leaf
+	}
+
+	b.prev = leaf
+	b.push(0, leaf, values[0].Key, len(values))
+}
+
+// push adds a node to the children of the node being filled at the given internal level,
+// and builds that node once the children left after it are enough for another one.
+func (b *spine[K, V]) push(depth int, child NodeDescriptor[K, V], min K, weight int) {
+	if depth == len(b.levels) {
+		b.levels = append(b.levels, entries[K, V]{})
+	}
+
+	e := &b.levels[depth]
+	e.children = append(e.children, child)
+	e.mins = append(e.mins, min)
+	e.weights = append(e.weights, weight)
+
+	if len(e.children) >= b.fanout+b.least {
+		b.parent(depth, 0, b.fanout)
+	}
+}
+
+// parent builds a node of the children at positions lo (inclusive) to hi (exclusive) at the given
+// internal level, removes them from it, and adds the node to the level above.
+func (b *spine[K, V]) parent(depth, lo, hi int) {
+	e := &b.levels[depth]
+
+	parent := b.tree.Builder.Create(&Node[K, V]{
+		Children: slices.Clone(e.children[lo:hi]),
+		Mins:     slices.Clone(e.mins[lo+1 : hi]),
+		Counts:   slices.Clone(e.weights[lo:hi]),
+	})
+
+	b.tree.reaggregate(parent)
+
+	min, weight := e.mins[lo], 0
+
+	for _, w := range e.weights[lo:hi] {
+		weight += w
+	}
+
+	e.children = slices.Delete(e.children, lo, hi)
+	e.mins = slices.Delete(e.mins, lo, hi)
+	e.weights = slices.Delete(e.weights, lo, hi)
+
+	b.push(depth+1, parent, min, weight)
+}
+
+// finish builds the nodes along the right edge from the entries left, as one node for each level,
+// or two halves when they do not fit in one, and returns the root, nil if no pair was added.
+func (b *spine[K, V]) finish() NodeDescriptor[K, V] {
+	if len(b.values) > 0 {
+		if n := len(b.values); n > b.tree.capacity(true) {
+			b.leaf(b.values[: n/2 : n/2])
+			b.leaf(b.values[n/2:])
+		} else {
+			b.leaf(b.values)
+		}
+
+		b.values = nil
+	}
+
+	for depth := 0; depth < len(b.levels); depth++ {
+		e := &b.levels[depth]
+
+		if depth == len(b.levels)-1 && len(e.children) == 1 {
+			return e.children[0]
+		}
+
+		if n := len(e.children); n > b.tree.Order {
+			b.parent(depth, 0, n/2)
+			b.parent(depth, 0, n-n/2)
+		} else if n > 0 {
+			b.parent(depth, 0, n)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package bp3
+
+import (
+	"cmp"
+	"errors"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// compare orders two keys using the instance compare function, falling back to the natural
+// order of K for instances that were not created by a constructor and have none. The natural
+// order is resolved once and kept on the instance.
+func (t *Instance[K, V]) compare(a, b K) int {
+	if t.Compare != nil {
+		return t.Compare(a, b)
+	}
+
+	t.resolve()
+
+	return t.natural(a, b)
+}
+
+// resolve resolves the natural order of an instance without a compare function, if it was not. The
+// concurrent wrappers resolve it ahead, so that their readers do not.
+func (t *Instance[K, V]) resolve() {
+	if t.Compare == nil && t.natural == nil {
+		t.natural = natural[K]()
+	}
+}
+
+// before reports whether key falls below the lower bound of a range.
+func (t *Instance[K, V]) before(key K, from RangeValue[K]) bool {
+	c := t.compare(key, from.Value)
+	return c < 0 || (!from.Closed && c == 0)
+}
+
+// after reports whether key falls above the upper bound of a range.
+func (t *Instance[K, V]) after(key K, to RangeValue[K]) bool {
+	c := t.compare(key, to.Value)
+	return c > 0 || (!to.Closed && c == 0)
+}
+
+func (t *Instance[K, V]) min(a, b K) K {
+	if t.compare(b, a) < 0 {
+		return b
+	}
+
+	return a
+}
+
+// ErrUnordered is returned (or panicked with) for a key type without a natural order and no compare function.
+var ErrUnordered = errors.New("bp3: unordered key type, use a compare function")
+
+// orders holds the natural orders resolved by NaturalOrder, by key type.
+var orders sync.Map
+
+// NaturalOrder returns the natural order of K, a type whose underlying type is an integer, floating-point
+// or string type, or ErrUnordered for other types. The order is resolved once for each key type, and
+// compares the keys as values of their underlying type, without reflection.
+func NaturalOrder[K any]() (func(a, b K) int, error) {
+	typ := reflect.TypeFor[K]()
+
+	if compare, found := orders.Load(typ); found {
+		return compare.(func(a, b K) int), nil
+	}
+
+	var compare func(a, b K) int
+
+	switch typ.Kind() {
+	case reflect.Int:
+		compare = underlying[K, int]
+	case reflect.Int8:
+		compare = underlying[K, int8]
+	case reflect.Int16:
+		compare = underlying[K, int16]
+	case reflect.Int32:
+		compare = underlying[K, int32]
+	case reflect.Int64:
+		compare = underlying[K, int64]
+	case reflect.Uint:
+		compare = underlying[K, uint]
+	case reflect.Uint8:
+		compare = underlying[K, uint8]
+	case reflect.Uint16:
+		compare = underlying[K, uint16]
+	case reflect.Uint32:
+		compare = underlying[K, uint32]
+	case reflect.Uint64:
+		compare = underlying[K, uint64]
+	case reflect.Uintptr:
+		compare = underlying[K, uintptr]
+	case reflect.Float32:
+		compare = underlying[K, float32]
+	case reflect.Float64:
+		compare = underlying[K, float64]
+	case reflect.String:
+		compare = underlying[K, string]
+	default:
+		return nil, ErrUnordered
+	}
+
+	orders.Store(typ, compare)
+
+	return compare, nil
+}
+
+// underlying compares two keys as values of their underlying type U.
+func underlying[K any, U cmp.Ordered](a, b K) int {
+	return cmp.Compare(*(*U)(unsafe.Pointer(&a)), *(*U)(unsafe.Pointer(&b)))
+}
+
+// natural returns the natural order of K, and panics if it has none.
+func natural[K any]() func(a, b K) int {
+	compare, err := NaturalOrder[K]()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return compare
+}
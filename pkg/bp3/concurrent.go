@@ -0,0 +1,544 @@
+package bp3
+
+import (
+	"iter"
+	"sync"
+	"time"
+)
+
+// Concurrent wraps an instance for concurrent use by multiple goroutines. Writes take an exclusive
+// lock and reads take a shared one, unless the instance was wrapped with exclusive reads (for builders
+// that load nodes lazily). Once wrapped, the instance must only be accessed through the wrapper.
+//
+// The sequences hold the read lock while they step through the instance, and release it while the
+// caller handles each key-value pair, so the loop body may call other methods of the wrapper. If a
+// write is made while a sequence is paused, the sequence resumes after the last pair it returned:
+// it returns the pairs that were added beyond that point and skips those that were removed, and it
+// never returns a pair twice.
+//
+// The generic functions of the instance have wrappers of their own, such as ConcurrentPrefix and
+// ConcurrentAggregate. Transactions are not wrapped, as a transaction spans calls that the wrapper
+// cannot keep apart from those of other goroutines.
+type Concurrent[K any, V any] struct {
+	mu        sync.RWMutex
+	tree      *Instance[K, V]
+	version   uint64
+	exclusive bool
+	flush     func() error
+}
+
+// NewConcurrent wraps an instance for concurrent use with the specified options.
+func NewConcurrent[K any, V any](tree *Instance[K, V], options ...ConcurrentOption) *Concurrent[K, V] {
+	opts := buildConcurrentOptions(options...)
+
+	flush := opts.flush
+
+	if flush == nil {
+		flush = tree.Builder.Flush
+	}
+
+	tree.resolve()
+
+	return &Concurrent[K, V]{tree: tree, exclusive: opts.exclusiveReads, flush: flush}
+}
+
+// read takes the read lock and returns the function that releases it.
+func (c *Concurrent[K, V]) read() func() {
+	if c.exclusive {
+		c.mu.Lock()
+		return c.mu.Unlock
+	}
+
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+// write takes the write lock, marks the instance as modified, and returns the function that releases it.
+func (c *Concurrent[K, V]) write() func() {
+	c.mu.Lock()
+	c.version++
+	return c.mu.Unlock
+}
+
+// Insert adds a key-value pair, see Instance.Insert.
+func (c *Concurrent[K, V]) Insert(key K, value V) (V, bool) {
+	defer c.write()()
+	return c.tree.Insert(key, value)
+}
+
+// InsertWithTTL adds a key-value pair that expires after a duration, see Instance.InsertWithTTL.
+func (c *Concurrent[K, V]) InsertWithTTL(key K, value V, ttl time.Duration) (V, bool) {
+	defer c.write()()
+	return c.tree.InsertWithTTL(key, value, ttl)
+}
+
+// InsertIfAbsent adds a key-value pair if the key does not exist, see Instance.InsertIfAbsent.
+func (c *Concurrent[K, V]) InsertIfAbsent(key K, value V) bool {
+	defer c.write()()
+	return c.tree.InsertIfAbsent(key, value)
+}
+
+// Replace sets the value of an existing key, see Instance.Replace.
+func (c *Concurrent[K, V]) Replace(key K, value V) (V, bool) {
+	defer c.write()()
+	return c.tree.Replace(key, value)
+}
+
+// Update sets the value of a key from its current one, see Instance.Update.
+// The function is called under the write lock and must not use the wrapper.
+func (c *Concurrent[K, V]) Update(key K, fn func(old V, ok bool) (V, bool)) (V, bool) {
+	defer c.write()()
+	return c.tree.Update(key, fn)
+}
+
+// Find retrieves the value of a key, see Instance.Find.
+func (c *Concurrent[K, V]) Find(key K) (V, bool) {
+	defer c.read()()
+	return c.tree.Find(key)
+}
+
+// FindAll returns a sequence of the values of a key, see Instance.FindAll.
+func (c *Concurrent[K, V]) FindAll(key K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range c.RangeClosed(key, key) {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// FindMany returns a sequence of the given keys that are found and their values, see Instance.FindMany.
+// The keys are consumed and the pairs are collected under a single read lock.
+func (c *Concurrent[K, V]) FindMany(keys iter.Seq[K]) iter.Seq2[K, V] {
+	return c.collect(func() iter.Seq2[K, V] {
+		return c.tree.FindMany(keys)
+	})
+}
+
+// RangeMany returns a sequence of the key-value pairs within any of the ranges, see Instance.RangeMany.
+// The pairs are collected under a single read lock.
+func (c *Concurrent[K, V]) RangeMany(ranges []struct{ From, To RangeValue[K] }) iter.Seq2[K, V] {
+	return c.collect(func() iter.Seq2[K, V] {
+		return c.tree.RangeMany(ranges)
+	})
+}
+
+// Page returns a page of the key-value pairs of a query and the token of the following one, see Instance.Page.
+func (c *Concurrent[K, V]) Page(query PageQuery[K], limit int) ([]KeyValue[K, V], PageToken, error) {
+	defer c.read()()
+	return c.tree.Page(query, limit)
+}
+
+// Range returns a sequence of the key-value pairs within a range, see Instance.Range.
+func (c *Concurrent[K, V]) Range(from, to RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(&from, &to, false)
+}
+
+// RangeClosed returns a sequence of the key-value pairs within [from, to].
+func (c *Concurrent[K, V]) RangeClosed(from, to K) iter.Seq2[K, V] {
+	return c.Range(RangeValue[K]{from, true}, RangeValue[K]{to, true})
+}
+
+// RangeOpened returns a sequence of the key-value pairs within (from, to).
+func (c *Concurrent[K, V]) RangeOpened(from, to K) iter.Seq2[K, V] {
+	return c.Range(RangeValue[K]{from, false}, RangeValue[K]{to, false})
+}
+
+// RangeLowHalfOpened returns a sequence of the key-value pairs within (from, to].
+func (c *Concurrent[K, V]) RangeLowHalfOpened(from, to K) iter.Seq2[K, V] {
+	return c.Range(RangeValue[K]{from, false}, RangeValue[K]{to, true})
+}
+
+// RangeHighHalfOpened returns a sequence of the key-value pairs within [from, to).
+func (c *Concurrent[K, V]) RangeHighHalfOpened(from, to K) iter.Seq2[K, V] {
+	return c.Range(RangeValue[K]{from, true}, RangeValue[K]{to, false})
+}
+
+// From returns a sequence of the key-value pairs starting from a range value, see Instance.From.
+func (c *Concurrent[K, V]) From(from RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(&from, nil, false)
+}
+
+// FromClosed returns a sequence of the key-value pairs starting from a key, including the key itself.
+func (c *Concurrent[K, V]) FromClosed(from K) iter.Seq2[K, V] {
+	return c.From(RangeValue[K]{from, true})
+}
+
+// FromOpened returns a sequence of the key-value pairs starting from a key, excluding the key itself.
+func (c *Concurrent[K, V]) FromOpened(from K) iter.Seq2[K, V] {
+	return c.From(RangeValue[K]{from, false})
+}
+
+// To returns a sequence of the key-value pairs up to a range value, see Instance.To.
+func (c *Concurrent[K, V]) To(to RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(nil, &to, false)
+}
+
+// ToClosed returns a sequence of the key-value pairs up to and including a key.
+func (c *Concurrent[K, V]) ToClosed(to K) iter.Seq2[K, V] {
+	return c.To(RangeValue[K]{to, true})
+}
+
+// ToOpened returns a sequence of the key-value pairs up to but excluding a key.
+func (c *Concurrent[K, V]) ToOpened(to K) iter.Seq2[K, V] {
+	return c.To(RangeValue[K]{to, false})
+}
+
+// RangeReverse returns a sequence of the key-value pairs within a range in descending order, see Instance.RangeReverse.
+func (c *Concurrent[K, V]) RangeReverse(from, to RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(&from, &to, true)
+}
+
+// RangeReverseClosed returns a sequence of the key-value pairs within [from, to], in descending order.
+func (c *Concurrent[K, V]) RangeReverseClosed(from, to K) iter.Seq2[K, V] {
+	return c.RangeReverse(RangeValue[K]{from, true}, RangeValue[K]{to, true})
+}
+
+// RangeReverseOpened returns a sequence of the key-value pairs within (from, to), in descending order.
+func (c *Concurrent[K, V]) RangeReverseOpened(from, to K) iter.Seq2[K, V] {
+	return c.RangeReverse(RangeValue[K]{from, false}, RangeValue[K]{to, false})
+}
+
+// RangeReverseLowHalfOpened returns a sequence of the key-value pairs within (from, to], in descending order.
+func (c *Concurrent[K, V]) RangeReverseLowHalfOpened(from, to K) iter.Seq2[K, V] {
+	return c.RangeReverse(RangeValue[K]{from, false}, RangeValue[K]{to, true})
+}
+
+// RangeReverseHighHalfOpened returns a sequence of the key-value pairs within [from, to), in descending order.
+func (c *Concurrent[K, V]) RangeReverseHighHalfOpened(from, to K) iter.Seq2[K, V] {
+	return c.RangeReverse(RangeValue[K]{from, true}, RangeValue[K]{to, false})
+}
+
+// FromReverse returns a sequence of the key-value pairs down to a range value, see Instance.FromReverse.
+func (c *Concurrent[K, V]) FromReverse(from RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(&from, nil, true)
+}
+
+// FromReverseClosed returns a sequence of the key-value pairs down to and including a key, in descending order.
+func (c *Concurrent[K, V]) FromReverseClosed(from K) iter.Seq2[K, V] {
+	return c.FromReverse(RangeValue[K]{from, true})
+}
+
+// FromReverseOpened returns a sequence of the key-value pairs down to but excluding a key, in descending order.
+func (c *Concurrent[K, V]) FromReverseOpened(from K) iter.Seq2[K, V] {
+	return c.FromReverse(RangeValue[K]{from, false})
+}
+
+// ToReverse returns a sequence of the key-value pairs starting from a range value, see Instance.ToReverse.
+func (c *Concurrent[K, V]) ToReverse(to RangeValue[K]) iter.Seq2[K, V] {
+	return c.scan(nil, &to, true)
+}
+
+// ToReverseClosed returns a sequence of the key-value pairs starting from a key, including the key itself,
+// in descending order.
+func (c *Concurrent[K, V]) ToReverseClosed(to K) iter.Seq2[K, V] {
+	return c.ToReverse(RangeValue[K]{to, true})
+}
+
+// ToReverseOpened returns a sequence of the key-value pairs starting below a key, in descending order.
+func (c *Concurrent[K, V]) ToReverseOpened(to K) iter.Seq2[K, V] {
+	return c.ToReverse(RangeValue[K]{to, false})
+}
+
+// Backward returns a sequence of all the key-value pairs in descending order.
+func (c *Concurrent[K, V]) Backward() iter.Seq2[K, V] {
+	return c.scan(nil, nil, true)
+}
+
+// Nearest returns a sequence of up to n key-value pairs closest to a key, see Instance.Nearest.
+// The pairs are collected under a single read lock.
+func (c *Concurrent[K, V]) Nearest(key K, n int, distance func(a, b K) float64) iter.Seq2[K, V] {
+	return c.collect(func() iter.Seq2[K, V] {
+		return c.tree.Nearest(key, n, distance)
+	})
+}
+
+// collect returns a sequence of the key-value pairs of the sequence the given function returns,
+// collected under a single read lock.
+func (c *Concurrent[K, V]) collect(fn func() iter.Seq2[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var s []KeyValue[K, V]
+
+		func() {
+			defer c.read()()
+
+			for k, v := range fn() {
+				s = append(s, KeyValue[K, V]{Key: k, Value: v})
+			}
+		}()
+
+		for _, kv := range s {
+			if !yield(kv.Key, kv.Value) {
+				return
+			}
+		}
+	}
+}
+
+// Floor returns the pair with the greatest key not greater than a key, see Instance.Floor.
+func (c *Concurrent[K, V]) Floor(key K) (K, V, bool) {
+	defer c.read()()
+	return c.tree.Floor(key)
+}
+
+// Ceiling returns the pair with the least key not less than a key, see Instance.Ceiling.
+func (c *Concurrent[K, V]) Ceiling(key K) (K, V, bool) {
+	defer c.read()()
+	return c.tree.Ceiling(key)
+}
+
+// Lower returns the pair with the greatest key less than a key, see Instance.Lower.
+func (c *Concurrent[K, V]) Lower(key K) (K, V, bool) {
+	defer c.read()()
+	return c.tree.Lower(key)
+}
+
+// Higher returns the pair with the least key greater than a key, see Instance.Higher.
+func (c *Concurrent[K, V]) Higher(key K) (K, V, bool) {
+	defer c.read()()
+	return c.tree.Higher(key)
+}
+
+// Delete removes the pair of a key, see Instance.Delete.
+func (c *Concurrent[K, V]) Delete(key K) (V, bool) {
+	defer c.write()()
+	return c.tree.Delete(key)
+}
+
+// DeleteOne removes the first pair of a key whose value satisfies match, see Instance.DeleteOne.
+// The function is called under the write lock and must not use the wrapper.
+func (c *Concurrent[K, V]) DeleteOne(key K, match func(V) bool) (V, bool) {
+	defer c.write()()
+	return c.tree.DeleteOne(key, match)
+}
+
+// DeleteAll removes all the pairs of a key, see Instance.DeleteAll.
+func (c *Concurrent[K, V]) DeleteAll(key K) int {
+	defer c.write()()
+	return c.tree.DeleteAll(key)
+}
+
+// DeleteRange removes all the pairs within a range, see Instance.DeleteRange.
+func (c *Concurrent[K, V]) DeleteRange(from, to RangeValue[K]) int {
+	defer c.write()()
+	return c.tree.DeleteRange(from, to)
+}
+
+// ExpireNow removes the expired pairs, see Instance.ExpireNow.
+func (c *Concurrent[K, V]) ExpireNow() int {
+	defer c.write()()
+	return c.tree.ExpireNow()
+}
+
+// PopMin removes and returns the pair with the minimum key, see Instance.PopMin.
+func (c *Concurrent[K, V]) PopMin() (K, V, bool) {
+	defer c.write()()
+	return c.tree.PopMin()
+}
+
+// PopMax removes and returns the pair with the maximum key, see Instance.PopMax.
+func (c *Concurrent[K, V]) PopMax() (K, V, bool) {
+	defer c.write()()
+	return c.tree.PopMax()
+}
+
+// PopMinN removes and returns up to n pairs with the minimum keys, see Instance.PopMinN.
+func (c *Concurrent[K, V]) PopMinN(n int) []KeyValue[K, V] {
+	defer c.write()()
+	return c.tree.PopMinN(n)
+}
+
+// Count returns the number of elements.
+func (c *Concurrent[K, V]) Count() int {
+	defer c.read()()
+	return c.tree.Count()
+}
+
+// Empty returns true if there are no elements.
+func (c *Concurrent[K, V]) Empty() bool {
+	defer c.read()()
+	return c.tree.Empty()
+}
+
+// First returns the pair with the minimum key, see Instance.First.
+func (c *Concurrent[K, V]) First() (K, V, bool) {
+	defer c.read()()
+	return c.tree.First()
+}
+
+// Last returns the pair with the maximum key, see Instance.Last.
+func (c *Concurrent[K, V]) Last() (K, V, bool) {
+	defer c.read()()
+	return c.tree.Last()
+}
+
+// Minimum returns the minimum value, see Instance.Minimum.
+func (c *Concurrent[K, V]) Minimum() V {
+	defer c.read()()
+	return c.tree.Minimum()
+}
+
+// Maximum returns the maximum value, see Instance.Maximum.
+func (c *Concurrent[K, V]) Maximum() V {
+	defer c.read()()
+	return c.tree.Maximum()
+}
+
+// Rank returns the number of pairs whose key is less than a key, see Instance.Rank.
+func (c *Concurrent[K, V]) Rank(key K) int {
+	defer c.read()()
+	return c.tree.Rank(key)
+}
+
+// At returns the pair at a position, see Instance.At.
+func (c *Concurrent[K, V]) At(i int) (K, V, bool) {
+	defer c.read()()
+	return c.tree.At(i)
+}
+
+// CountRange returns the number of pairs within a range, see Instance.CountRange.
+func (c *Concurrent[K, V]) CountRange(from, to RangeValue[K]) int {
+	defer c.read()()
+	return c.tree.CountRange(from, to)
+}
+
+// Stats returns the shape of the instance, see Instance.Stats.
+func (c *Concurrent[K, V]) Stats(samples int) Stats {
+	defer c.read()()
+	return c.tree.Stats(samples)
+}
+
+// Validate checks that the instance is a valid B+ Tree, see Instance.Validate.
+func (c *Concurrent[K, V]) Validate() error {
+	defer c.read()()
+	return c.tree.Validate()
+}
+
+// ConcurrentAggregate returns the aggregate of the pairs within a range, see Aggregate.
+func ConcurrentAggregate[A any, K any, V any](c *Concurrent[K, V], from, to RangeValue[K]) A {
+	defer c.read()()
+	return Aggregate[A](c.tree, from, to)
+}
+
+// ConcurrentPrefix returns a sequence of the pairs whose key starts with a prefix, see Prefix.
+// It steps through the instance as the other sequences of the wrapper do.
+func ConcurrentPrefix[K ~string, V any](c *Concurrent[K, V], prefix string) iter.Seq2[K, V] {
+	from := RangeValue[K]{K(prefix), true}
+
+	if end, ok := successor(prefix); ok {
+		return c.Range(from, RangeValue[K]{K(end), false})
+	}
+
+	return c.From(from)
+}
+
+// ConcurrentCountPrefix returns the number of pairs whose key starts with a prefix, see CountPrefix.
+func ConcurrentCountPrefix[K ~string, V any](c *Concurrent[K, V], prefix string) int {
+	defer c.read()()
+	return CountPrefix(c.tree, prefix)
+}
+
+// ConcurrentDeletePrefix removes the pairs whose key starts with a prefix, see DeletePrefix.
+func ConcurrentDeletePrefix[K ~string, V any](c *Concurrent[K, V], prefix string) int {
+	defer c.write()()
+	return DeletePrefix(c.tree, prefix)
+}
+
+// Snapshot returns a read-only view of a copy-on-write instance, see Instance.Snapshot.
+// The snapshot may be read without the wrapper while the wrapped instance is modified.
+func (c *Concurrent[K, V]) Snapshot() *Instance[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.Snapshot()
+}
+
+// Flush writes the pending changes of the instance.
+func (c *Concurrent[K, V]) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// scan returns a sequence of the key-value pairs between optional bounds, in ascending order
+// or in descending order if reverse is set. The read lock is held only while stepping.
+func (c *Concurrent[K, V]) scan(from, to *RangeValue[K], reverse bool) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var version uint64
+		var last K
+
+		cursor := c.tree.Cursor()
+		returned := 0 // the number of returned pairs with a key equal to the last one
+
+		for {
+			kv, expired, ok := c.step(cursor, from, to, reverse, &version, last, returned)
+
+			if !ok {
+				return
+			}
+
+			if returned > 0 && c.tree.compare(kv.Key, last) == 0 {
+				returned++
+			} else {
+				returned = 1
+			}
+
+			last = kv.Key
+
+			if !expired && !yield(kv.Key, kv.Value) {
+				return
+			}
+		}
+	}
+}
+
+// step moves the cursor of a sequence to its next key-value pair under the read lock, and returns it
+// with a boolean indicating whether it expired.
+// If the instance was modified since the last step, the cursor is positioned again after the last
+// returned pair, skipping the given number of pairs with an equal key.
+func (c *Concurrent[K, V]) step(cursor *Cursor[K, V], from, to *RangeValue[K], reverse bool, version *uint64, last K, returned int) (KeyValue[K, V], bool, bool) {
+	defer c.read()()
+
+	var valid bool
+
+	switch {
+	case returned == 0 && !reverse && from != nil:
+		valid = cursor.seek(from.Value, !from.Closed, false)
+	case returned == 0 && !reverse:
+		valid = cursor.SeekFirst()
+	case returned == 0 && to != nil:
+		valid = cursor.seek(to.Value, to.Closed, true)
+	case returned == 0:
+		valid = cursor.SeekLast()
+	case c.version == *version && !reverse:
+		valid = cursor.Next()
+	case c.version == *version:
+		valid = cursor.Prev()
+	case !reverse:
+		valid = cursor.seek(last, false, false)
+
+		for skip := returned; valid && skip > 0 && c.tree.compare(cursor.Key(), last) == 0; skip-- {
+			valid = cursor.Next()
+		}
+	default:
+		valid = cursor.seek(last, true, true)
+
+		for skip := returned; valid && skip > 0 && c.tree.compare(cursor.Key(), last) == 0; skip-- {
+			valid = cursor.Prev()
+		}
+	}
+
+	*version = c.version
+
+	if !valid {
+		return KeyValue[K, V]{}, false, false
+	}
+
+	kv := cursor.node.Read().Values[cursor.i]
+
+	if (!reverse && to != nil && c.tree.after(kv.Key, *to)) || (reverse && from != nil && c.tree.before(kv.Key, *from)) {
+		return KeyValue[K, V]{}, false, false
+	}
+
+	return kv, c.tree.expired(cursor.node.Read(), cursor.i), true
+}
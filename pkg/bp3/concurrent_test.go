@@ -0,0 +1,254 @@
+package bp3_test
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestConcurrent(t *testing.T) {
+	for _, duplicates := range []bool{false, true} {
+		options := []bp3.Option{bp3.WithOrder(4)}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.NewConcurrent(bp3.New[int, int](options...))
+
+		var wg sync.WaitGroup
+
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+
+			go func(w int) {
+				defer wg.Done()
+
+				r := rand.New(rand.NewSource(int64(w)))
+
+				for i := 0; i < 500; i++ {
+					k := r.Intn(200)
+
+					switch r.Intn(3) {
+					case 0, 1:
+						tree.Insert(k, k)
+					default:
+						tree.Delete(k)
+					}
+				}
+			}(w)
+		}
+
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+
+			go func(w int) {
+				defer wg.Done()
+
+				for i := 0; i < 20; i++ {
+					prev := -1
+
+					seq := tree.FromClosed(0)
+
+					if w%2 == 1 {
+						seq = tree.Backward()
+						prev = 200
+					}
+
+					for k, v := range seq {
+						if k != v {
+							t.Errorf("value %d of key %d", v, k)
+						}
+
+						if (w%2 == 0 && k < prev) || (w%2 == 1 && k > prev) {
+							t.Errorf("key %d after %d", k, prev)
+						}
+
+						prev = k
+
+						tree.Find(k)
+					}
+
+					tree.Count()
+				}
+			}(w)
+		}
+
+		wg.Wait()
+
+		n := 0
+
+		for range tree.FromClosed(0) {
+			n++
+		}
+
+		if n != tree.Count() {
+			t.Fatalf("iterated %d of %d", n, tree.Count())
+		}
+	}
+}
+
+func TestConcurrentPausedIteration(t *testing.T) {
+	test := func(duplicates bool, reverse bool) {
+		options := []bp3.Option{bp3.WithOrder(3)}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.NewConcurrent(bp3.New[int, int](options...))
+
+		for i := 0; i < 100; i++ {
+			tree.Insert(i, 0)
+
+			if duplicates {
+				tree.Insert(i, 1)
+			}
+		}
+
+		seq := tree.RangeClosed(10, 89)
+
+		if reverse {
+			seq = tree.RangeReverseClosed(10, 89)
+		}
+
+		var got []bp3.KeyValue[int, int]
+
+		for k, v := range seq {
+			got = append(got, bp3.KeyValue[int, int]{Key: k, Value: v})
+
+			if len(got) != 10 {
+				continue
+			}
+
+			// pairs before the last returned key are not returned, pairs after it are
+			tree.DeleteRange(bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 99, Closed: true})
+
+			for i := 0; i < 100; i += 2 {
+				tree.Insert(i, 2)
+			}
+		}
+
+		var want []bp3.KeyValue[int, int]
+
+		if !duplicates && !reverse {
+			for i := 10; i < 20; i++ {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 0})
+			}
+
+			for i := 20; i < 90; i += 2 {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 2})
+			}
+		} else if !duplicates {
+			for i := 89; i > 79; i-- {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 0})
+			}
+
+			for i := 78; i >= 10; i -= 2 {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 2})
+			}
+		} else if !reverse {
+			for i := 10; i < 15; i++ {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 0}, bp3.KeyValue[int, int]{Key: i, Value: 1})
+			}
+
+			for i := 16; i < 90; i += 2 {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 2})
+			}
+		} else {
+			for i := 89; i > 84; i-- {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 1}, bp3.KeyValue[int, int]{Key: i, Value: 0})
+			}
+
+			for i := 84; i >= 10; i -= 2 {
+				want = append(want, bp3.KeyValue[int, int]{Key: i, Value: 2})
+			}
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("duplicates %v, reverse %v: %v != %v", duplicates, reverse, got, want)
+		}
+	}
+
+	for _, duplicates := range []bool{false, true} {
+		test(duplicates, false)
+		test(duplicates, true)
+	}
+}
+
+func TestConcurrentNaturalOrder(t *testing.T) {
+	// the natural order of an instance without a compare function is resolved before the readers share it
+	src := bp3.New[int, int](bp3.WithOrder(4))
+
+	for i := range 100 {
+		src.Insert(i, i)
+	}
+
+	tree := &bp3.Instance[int, int]{Root: src.Root, Min: src.Min, Order: 4, Size: src.Size, Builder: src.Builder}
+	c := bp3.NewConcurrent(tree)
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range 100 {
+				if v, ok := c.Find(i); !ok || v != i {
+					t.Errorf("find %d: %d, %v", i, v, ok)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestConcurrentWrappers(t *testing.T) {
+	words := bp3.NewConcurrent(bp3.New[string, int](bp3.WithOrder(3)))
+
+	for i, w := range []string{"car", "cart", "cat", "dog", "do", "cab"} {
+		words.Insert(w, i)
+	}
+
+	var s []string
+
+	for k := range bp3.ConcurrentPrefix(words, "ca") {
+		s = append(s, k)
+	}
+
+	if !slices.Equal(s, []string{"cab", "car", "cart", "cat"}) {
+		t.Fatalf("prefix %v", s)
+	}
+
+	if n := bp3.ConcurrentCountPrefix(words, "car"); n != 2 {
+		t.Fatalf("count prefix %d", n)
+	}
+
+	if n := bp3.ConcurrentDeletePrefix(words, "do"); n != 2 || words.Count() != 4 {
+		t.Fatalf("delete prefix %d, count %d", n, words.Count())
+	}
+
+	numbers := bp3.NewConcurrent(bp3.New[int, int](bp3.WithOrder(4), bp3.WithMonoid(sum)))
+
+	for i := range 100 {
+		numbers.Insert(i, i)
+	}
+
+	if a := bp3.ConcurrentAggregate[int](numbers, bp3.RangeValue[int]{Value: 10, Closed: true}, bp3.RangeValue[int]{Value: 20}); a != 145 {
+		t.Fatalf("aggregate %d", a)
+	}
+
+	if stats := numbers.Stats(0); stats.Leaves == 0 || stats.Height < 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	if err := numbers.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+package bp3
+
+// Clone returns a copy of a copy-on-write instance in constant time. The two instances share
+// their nodes, and each copies the nodes it writes to from then on, so that changes to one of them
+// are not seen by the other. It panics if copy-on-write is not enabled, or in a transaction.
+func (t *Instance[K, V]) Clone() *Instance[K, V] {
+	return t.fork(false)
+}
+
+// Snapshot returns a read-only view of a copy-on-write instance at its current state in constant time.
+// Later changes to the instance copy the nodes they write to, so the snapshot can be read while the
+// instance is modified. Modifying the snapshot panics, as does taking one when copy-on-write is not enabled,
+// or in a transaction, whose journal does not follow the nodes to the builders of the forks.
+func (t *Instance[K, V]) Snapshot() *Instance[K, V] {
+	return t.fork(true)
+}
+
+func (t *Instance[K, V]) fork(readOnly bool) *Instance[K, V] {
+	copier, ok := t.Builder.(NodeCopier[K, V])
+
+	if !t.CopyOnWrite || !ok {
+		panic("bp3: copy-on-write is not enabled")
+	}
+
+	if journal, ok := t.Builder.(interface{ Active() bool }); ok && journal.Active() {
+		panic("bp3: fork in a transaction")
+	}
+
+	clone := *t
+	clone.Builder = copier.Fork(readOnly)
+	clone.hooks = nil
+
+	if t.Expiry != nil {
+		clone.Expiry = t.Expiry.fork(readOnly)
+	}
+
+	t.Builder = copier.Fork(false)
+
+	return &clone
+}
+
+// copy returns a descriptor of the given node that can be written. In copy-on-write mode,
+// nodes that are shared with other instances are copied.
+func (t *Instance[K, V]) copy(d NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+	if !t.CopyOnWrite || d == nil {
+		return d
+	}
+
+	return t.Builder.(NodeCopier[K, V]).Own(d)
+}
+
+// mutable returns the i-th child of a writable node for writing, pointing the node
+// at a copy of the child if the child is shared with other instances.
+func (t *Instance[K, V]) mutable(root NodeDescriptor[K, V], i int) NodeDescriptor[K, V] {
+	child := root.Read().Children[i]
+
+	if owned := t.copy(child); owned != child {
+		root.Write().Children[i] = owned
+		return owned
+	}
+
+	return child
+}
+
+// own makes the nodes on the path to a leaf writable, and returns the writable leaf.
+func (t *Instance[K, V]) own(p path[K, V], leaf NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+	if !t.CopyOnWrite {
+		return leaf
+	}
+
+	t.Root = t.copy(t.Root)
+	node := t.Root
+
+	for j := range p {
+		p[j].node = node
+		node = t.mutable(node, p[j].i)
+	}
+
+	return node
+}
+
+// clone returns a copy of a node without its leaf links.
+func clone[K any, V any](node *Node[K, V]) *Node[K, V] {
+	c := node.Clone()
+	c.Next, c.Prev = nil, nil
+	return c
+}
@@ -0,0 +1,276 @@
+package bp3_test
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+// contents returns the key-value pairs of an instance, checking that all the ways to iterate over it agree.
+func contents(t *testing.T, tree *bp3.Instance[int, int]) []bp3.KeyValue[int, int] {
+	t.Helper()
+
+	s := bp3.Slice(tree.Root)
+
+	var forward, backward []bp3.KeyValue[int, int]
+
+	for k, v := range tree.From(bp3.RangeValue[int]{Value: -1 << 31, Closed: true}) {
+		forward = append(forward, bp3.KeyValue[int, int]{Key: k, Value: v})
+	}
+
+	for k, v := range tree.Backward() {
+		backward = append(backward, bp3.KeyValue[int, int]{Key: k, Value: v})
+	}
+
+	slices.Reverse(backward)
+
+	if !slices.Equal(s, forward) || !slices.Equal(s, backward) {
+		t.Fatalf("slice %v, forward %v, backward %v", s, forward, backward)
+	}
+
+	c := tree.Cursor()
+
+	for i, ok := 0, c.SeekFirst(); ok; i, ok = i+1, c.Next() {
+		if c.Key() != s[i].Key || c.Value() != s[i].Value {
+			t.Fatalf("cursor %d: %d, %d != %v", i, c.Key(), c.Value(), s[i])
+		}
+	}
+
+	if tree.Count() != len(s) {
+		t.Fatalf("count %d != %d", tree.Count(), len(s))
+	}
+
+	return s
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	test := func(order int, n int, duplicates bool) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+
+		options := []bp3.Option{bp3.WithOrder(order), bp3.WithCopyOnWrite()}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.New[int, int](options...)
+
+		var snapshots []*bp3.Instance[int, int]
+		var states [][]bp3.KeyValue[int, int]
+
+		check := func() {
+			for i, snapshot := range snapshots {
+				if s := contents(t, snapshot); !slices.Equal(s, states[i]) {
+					t.Fatalf("snapshot %d: %v != %v", i, s, states[i])
+				}
+			}
+		}
+
+		for step := range 200 {
+			switch r.Intn(8) {
+			case 0, 1, 2:
+				for range r.Intn(n) {
+					k := r.Intn(n)
+					tree.Insert(k, step)
+				}
+			case 3:
+				for range r.Intn(n / 2) {
+					tree.Delete(r.Intn(n))
+				}
+			case 4:
+				from := r.Intn(n)
+				tree.DeleteRange(bp3.RangeValue[int]{Value: from, Closed: true}, bp3.RangeValue[int]{Value: from + r.Intn(n/4+1), Closed: true})
+			case 5:
+				c := tree.Cursor()
+
+				for ok := c.Seek(r.Intn(n)); ok; ok = c.Next() {
+					if r.Intn(3) == 0 {
+						_, ok = c.Delete()
+
+						if !ok {
+							break
+						}
+					} else {
+						c.SetValue(-step)
+					}
+				}
+			case 6:
+				left, right := tree.SplitAt(r.Intn(n))
+				left.PopMax()
+				right.PopMin()
+
+				joined, err := bp3.Join(left, right)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tree = joined
+			default:
+				for range r.Intn(n / 4) {
+					tree.Replace(r.Intn(n), step)
+				}
+			}
+
+			shape(t, tree.Root, order, true)
+
+			if r.Intn(4) == 0 {
+				snapshots = append(snapshots, tree.Snapshot())
+				states = append(states, contents(t, tree))
+			}
+
+			if step%20 == 0 {
+				check()
+			}
+		}
+
+		check()
+	}
+
+	test(3, 50, false)
+	test(4, 100, true)
+	test(7, 300, false)
+	test(10, 1000, true)
+}
+
+func TestClone(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3), bp3.WithCopyOnWrite())
+
+	for i := 0; i < 100; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	clone := tree.Clone()
+
+	for i := 0; i < 100; i += 2 {
+		tree.Delete(i)
+		clone.Insert(i, "clone")
+	}
+
+	for i := 100; i < 150; i++ {
+		clone.Insert(i, fmt.Sprint(i))
+	}
+
+	if tree.Count() != 50 || clone.Count() != 150 {
+		t.Fatalf("count %d, %d", tree.Count(), clone.Count())
+	}
+
+	for i := 0; i < 150; i++ {
+		v, ok := tree.Find(i)
+
+		if ok != (i < 100 && i%2 == 1) || (ok && v != fmt.Sprint(i)) {
+			t.Fatalf("tree %d: %s, %v", i, v, ok)
+		}
+
+		v, ok = clone.Find(i)
+
+		if expected := fmt.Sprint(i); i < 100 && i%2 == 0 {
+			expected = "clone"
+
+			if !ok || v != expected {
+				t.Fatalf("clone %d: %s, %v", i, v, ok)
+			}
+		} else if !ok || v != expected {
+			t.Fatalf("clone %d: %s, %v", i, v, ok)
+		}
+	}
+
+	shape(t, tree.Root, 3, true)
+	shape(t, clone.Root, 3, true)
+}
+
+func TestSnapshotReadOnly(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3), bp3.WithCopyOnWrite())
+
+	for i := 0; i < 10; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	snapshot := tree.Snapshot()
+
+	panics := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s did not panic", name)
+			}
+		}()
+
+		fn()
+	}
+
+	panics("insert", func() { snapshot.Insert(20, "20") })
+	panics("delete", func() { snapshot.Delete(5) })
+	panics("set value", func() {
+		c := snapshot.Cursor()
+		c.SeekFirst()
+		c.SetValue("0")
+	})
+
+	if v, ok := snapshot.Find(5); !ok || v != "5" {
+		t.Fatalf("find: %s, %v", v, ok)
+	}
+
+	panics("snapshot without copy-on-write", func() { bp3.New[int, int]().Snapshot() })
+	panics("clone without copy-on-write", func() { bp3.New[int, int]().Clone() })
+}
+
+func TestSnapshotInTx(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithCopyOnWrite())
+
+	for i := 0; i < 50; i++ {
+		tree.Insert(i, i)
+	}
+
+	tx := tree.Begin()
+
+	for i := 0; i < 50; i += 2 {
+		tx.Delete(i)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("snapshot in a transaction did not panic")
+			}
+		}()
+
+		tx.Snapshot()
+	}()
+
+	for i := 50; i < 100; i++ {
+		tx.Insert(i, i)
+	}
+
+	tx.Rollback()
+
+	if err := tree.Validate(); err != nil || tree.Count() != 50 {
+		t.Fatalf("count %d: %v", tree.Count(), err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if v, found := tree.Find(i); !found || v != i {
+			t.Fatalf("%d: %d, %v", i, v, found)
+		}
+	}
+
+	// a snapshot taken after the transaction is not changed by the next one
+	snapshot := tree.Snapshot()
+	tx = tree.Begin()
+
+	for i := 0; i < 50; i++ {
+		tx.Insert(i, -i)
+	}
+
+	tx.Rollback()
+
+	if v, _ := snapshot.Find(10); v != 10 {
+		t.Fatalf("snapshot value %d", v)
+	}
+
+	if v, _ := tree.Find(10); v != 10 {
+		t.Fatalf("value %d", v)
+	}
+}
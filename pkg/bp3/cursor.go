@@ -0,0 +1,206 @@
+package bp3
+
+import "slices"
+
+// Cursor is a stateful position over the key-value pairs of an instance. Unlike the range
+// sequences, a cursor can be paused, moved in both directions and used to modify the
+// instance at its position. A cursor is invalidated by modifications that are not made
+// through it. Like the sequences, a cursor skips the expired pairs.
+type Cursor[K any, V any] struct {
+	tree *Instance[K, V]
+	path path[K, V]
+	node NodeDescriptor[K, V]
+	i    int
+}
+
+// Cursor returns a new cursor over the instance. The cursor is not valid until positioned by one of its Seek methods.
+func (t *Instance[K, V]) Cursor() *Cursor[K, V] {
+	return &Cursor[K, V]{tree: t}
+}
+
+// Seek positions the cursor at the first key-value pair whose key is greater than or equal to the given key.
+// It returns true if such a pair exists.
+func (c *Cursor[K, V]) Seek(key K) bool {
+	return c.seek(key, false, false)
+}
+
+// SeekFirst positions the cursor at the key-value pair with the minimum key.
+// It returns false if the instance is empty.
+func (c *Cursor[K, V]) SeekFirst() bool {
+	c.path, c.node = c.tree.first()
+	c.i = 0
+	return c.live(false)
+}
+
+// SeekLast positions the cursor at the key-value pair with the maximum key.
+// It returns false if the instance is empty.
+func (c *Cursor[K, V]) SeekLast() bool {
+	c.path, c.node = c.tree.last()
+
+	if c.node != nil {
+		c.i = len(c.node.Read().Values) - 1
+	}
+
+	return c.live(true)
+}
+
+// Next moves the cursor to the following key-value pair.
+// It returns false if the cursor moved past the last pair or was not valid.
+func (c *Cursor[K, V]) Next() bool {
+	if !c.Valid() {
+		return false
+	}
+
+	c.forward()
+
+	return c.live(false)
+}
+
+// Prev moves the cursor to the preceding key-value pair.
+// It returns false if the cursor moved before the first pair or was not valid.
+func (c *Cursor[K, V]) Prev() bool {
+	if !c.Valid() {
+		return false
+	}
+
+	c.backward()
+
+	return c.live(true)
+}
+
+// seek positions the cursor at the first key-value pair whose key is not less than the given key,
+// or greater than it if after is set. If back is set, the cursor is positioned at the pair before it.
+// Expired pairs are skipped in the direction of the positioning.
+func (c *Cursor[K, V]) seek(key K, after, back bool) bool {
+	c.place(key, after, back)
+	return c.live(back)
+}
+
+// place positions the cursor as seek does, at a pair that may be expired.
+func (c *Cursor[K, V]) place(key K, after, back bool) {
+	c.path, c.node, c.i = c.tree.walk(key, after)
+
+	if c.node == nil {
+		return
+	}
+
+	if back {
+		c.backward()
+	} else if c.i == len(c.node.Read().Values) {
+		c.node, c.i = c.tree.next(&c.path, c.node), 0
+	}
+}
+
+// forward moves the cursor to the following key-value pair, expired or not.
+func (c *Cursor[K, V]) forward() {
+	c.i++
+
+	if c.i == len(c.node.Read().Values) {
+		c.node, c.i = c.tree.next(&c.path, c.node), 0
+	}
+}
+
+// backward moves the cursor to the preceding key-value pair, expired or not.
+func (c *Cursor[K, V]) backward() {
+	c.i--
+
+	if c.i < 0 {
+		c.node = c.tree.prev(&c.path, c.node)
+
+		if c.node != nil {
+			c.i = len(c.node.Read().Values) - 1
+		}
+	}
+}
+
+// live moves the cursor past the expired key-value pairs, backward if back is set, and returns
+// true if it is left at a pair.
+func (c *Cursor[K, V]) live(back bool) bool {
+	for c.Valid() && c.tree.expired(c.node.Read(), c.i) {
+		if back {
+			c.backward()
+		} else {
+			c.forward()
+		}
+	}
+
+	return c.Valid()
+}
+
+// Valid returns true if the cursor is positioned at a key-value pair.
+func (c *Cursor[K, V]) Valid() bool {
+	return c.node != nil && c.node.Read() != nil && c.i >= 0 && c.i < len(c.node.Read().Values)
+}
+
+// Key returns the key at the cursor position, or the zero key if the cursor is not valid.
+func (c *Cursor[K, V]) Key() K {
+	if !c.Valid() {
+		return *new(K)
+	}
+
+	return c.node.Read().Values[c.i].Key
+}
+
+// Value returns the value at the cursor position, or the zero value if the cursor is not valid.
+func (c *Cursor[K, V]) Value() V {
+	if !c.Valid() {
+		return *new(V)
+	}
+
+	return c.node.Read().Values[c.i].Value
+}
+
+// SetValue replaces the value at the cursor position.
+// It panics if the cursor is not valid.
+func (c *Cursor[K, V]) SetValue(value V) {
+	if !c.Valid() {
+		panic("bp3: invalid cursor")
+	}
+
+	old := c.node.Read().Values[c.i]
+	c.node = c.tree.own(c.path, c.node)
+	c.node.Write().Values[c.i].Value = value
+	c.tree.regatherPath(c.path)
+	c.tree.replaced(old, KeyValue[K, V]{Key: old.Key, Value: value})
+}
+
+// Delete removes the key-value pair at the cursor position and moves the cursor to the following pair.
+// It returns the removed value and a boolean indicating whether the cursor is still valid.
+// It panics if the cursor is not valid.
+func (c *Cursor[K, V]) Delete() (V, bool) {
+	if !c.Valid() {
+		panic("bp3: invalid cursor")
+	}
+
+	key := c.Key()
+	v, skip := c.remove()
+
+	// the delete may have merged or borrowed from the cursor leaf, so seek again
+	c.place(key, false, false)
+
+	for ; c.Valid() && skip > 0; skip-- {
+		c.forward()
+	}
+
+	return v, c.live(false)
+}
+
+// remove removes the key-value pair at the valid cursor position, and returns its value and the
+// number of pairs with an equal key before it, expired or not, which identifies the pair in its run.
+func (c *Cursor[K, V]) remove() (V, int) {
+	key := c.Key()
+	skip := 0
+
+	if c.tree.Duplicates {
+		p := *c
+		p.path = slices.Clone(c.path)
+
+		for p.backward(); p.Valid() && c.tree.compare(p.Key(), key) == 0; p.backward() {
+			skip++
+		}
+	}
+
+	v, _ := c.tree.remove(&deletion[K, V]{key: key, skip: skip})
+
+	return v, skip
+}
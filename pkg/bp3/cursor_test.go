@@ -0,0 +1,158 @@
+package bp3_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestCursorNextPrev(t *testing.T) {
+	test := func(order int, n int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i*2, fmt.Sprint(i*2))
+		}
+
+		c := tree.Cursor()
+
+		if c.Valid() {
+			t.Fatal("new cursor is valid")
+		}
+
+		var keys []int
+
+		for ok := c.SeekFirst(); ok; ok = c.Next() {
+			keys = append(keys, c.Key())
+
+			if c.Value() != fmt.Sprint(c.Key()) {
+				t.Fatalf("%d: %s", c.Key(), c.Value())
+			}
+		}
+
+		master := slices.Collect(SeqFirst(tree.RangeClosed(0, n*2)))
+
+		if slices.Compare(keys, master) != 0 {
+			t.Fatalf("%v, %v", keys, master)
+		}
+
+		keys = keys[:0]
+
+		for ok := c.SeekLast(); ok; ok = c.Prev() {
+			keys = append(keys, c.Key())
+		}
+
+		slices.Reverse(master)
+
+		if slices.Compare(keys, master) != 0 {
+			t.Fatalf("%v, %v", keys, master)
+		}
+
+		if n < 4 {
+			return
+		}
+
+		if !c.Seek(n) || c.Key() != n+n%2 {
+			t.Fatalf("seek %d: %d", n, c.Key())
+		}
+
+		if !c.Prev() || !c.Prev() || !c.Next() || c.Key() != n+n%2-2 {
+			t.Fatalf("seek %d and step: %d", n, c.Key())
+		}
+
+		if c.Seek(n * 2) {
+			t.Fatalf("seek past the end: %d", c.Key())
+		}
+	}
+
+	test(3, 0)
+	test(3, 1)
+	test(3, 100)
+	test(10, 1000)
+	test(15, 10000)
+}
+
+func TestCursorSetValue(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	for i := 0; i < 100; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	c := tree.Cursor()
+
+	for ok := c.Seek(50); ok; ok = c.Next() {
+		c.SetValue("x")
+	}
+
+	for i := 0; i < 100; i++ {
+		if v, _ := tree.Find(i); (i >= 50) != (v == "x") {
+			t.Fatalf("%d: %s", i, v)
+		}
+	}
+}
+
+func TestCursorDelete(t *testing.T) {
+	test := func(order int, n int, every int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		c := tree.Cursor()
+		ok := c.SeekFirst()
+
+		for ok {
+			if key := c.Key(); key%every == 0 {
+				v, valid := c.Delete()
+
+				if v != fmt.Sprint(key) || (valid && c.Key() != key+1) {
+					t.Fatalf("deleted %s, moved to %d", v, c.Key())
+				}
+
+				ok = valid
+			} else {
+				ok = c.Next()
+			}
+		}
+
+		var master []int
+
+		for i := 0; i < n; i++ {
+			if i%every != 0 {
+				master = append(master, i)
+			}
+		}
+
+		s := slices.Collect(SeqFirst(tree.RangeClosed(0, n)))
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+
+		if tree.Size != len(master) {
+			t.Fatalf("size %d != %d", tree.Size, len(master))
+		}
+
+		for ok := c.SeekLast(); ok; {
+			_, ok = c.Delete()
+
+			if !ok {
+				ok = c.SeekLast()
+			}
+		}
+
+		if !tree.Empty() {
+			t.Fatalf("tree not empty, size %d", tree.Size)
+		}
+	}
+
+	test(3, 100, 1)
+	test(3, 100, 2)
+	test(4, 500, 3)
+	test(10, 1000, 2)
+	test(15, 10000, 5)
+}
@@ -0,0 +1,195 @@
+package bp3_test
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+// multimap is a reference implementation of a sorted multimap over a slice.
+type multimap []bp3.KeyValue[int, int]
+
+func (m *multimap) insert(key, value int) {
+	i := sort.Search(len(*m), func(i int) bool { return (*m)[i].Key > key })
+	*m = slices.Insert(*m, i, bp3.KeyValue[int, int]{Key: key, Value: value})
+}
+
+func (m *multimap) deleteOne(key int, match func(int) bool) (int, bool) {
+	for i, kv := range *m {
+		if kv.Key == key && (match == nil || match(kv.Value)) {
+			*m = slices.Delete(*m, i, i+1)
+			return kv.Value, true
+		}
+	}
+
+	return 0, false
+}
+
+func (m multimap) values(key int) []int {
+	var s []int
+
+	for _, kv := range m {
+		if kv.Key == key {
+			s = append(s, kv.Value)
+		}
+	}
+
+	return s
+}
+
+func TestDuplicates(t *testing.T) {
+	test := func(order int, n int, keys int) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.New[int, int](bp3.WithOrder(order), bp3.WithDuplicates())
+		var master multimap
+
+		for i := 0; i < n; i++ {
+			k := r.Intn(keys)
+			tree.Insert(k, i)
+			master.insert(k, i)
+		}
+
+		verify := func() {
+			t.Helper()
+
+			if tree.Size != len(master) {
+				t.Fatalf("size %d != %d", tree.Size, len(master))
+			}
+
+			shape(t, tree.Root, order, true)
+
+			s := bp3.Slice(tree.Root)
+
+			if !slices.Equal(s, master) {
+				t.Fatalf("%v, %v", s, master)
+			}
+
+			for k := -1; k <= keys; k++ {
+				if s := slices.Collect(tree.FindAll(k)); !slices.Equal(s, master.values(k)) {
+					t.Fatalf("%d: %v, %v", k, s, master.values(k))
+				}
+
+				v, found := tree.Find(k)
+
+				if all := master.values(k); found != (len(all) > 0) || (found && v != all[0]) {
+					t.Fatalf("%d: %d, %v", k, v, found)
+				}
+			}
+		}
+
+		verify()
+
+		from, to := keys/4, keys/2
+		s := slices.Collect(SeqSecond(tree.RangeReverseClosed(from, to)))
+		var reversed []int
+
+		for _, kv := range slices.Backward(master) {
+			if kv.Key >= from && kv.Key <= to {
+				reversed = append(reversed, kv.Value)
+			}
+		}
+
+		if !slices.Equal(s, reversed) {
+			t.Fatalf("%v, %v", s, reversed)
+		}
+
+		for i := 0; i < n/2; i++ {
+			k := r.Intn(keys)
+			odd := func(v int) bool { return v%2 == 1 }
+
+			v0, ok0 := tree.DeleteOne(k, odd)
+			v1, ok1 := master.deleteOne(k, odd)
+
+			if v0 != v1 || ok0 != ok1 {
+				t.Fatalf("delete %d: %d, %v != %d, %v", k, v0, ok0, v1, ok1)
+			}
+		}
+
+		verify()
+
+		for k := 0; k < keys; k += 3 {
+			n := len(master.values(k))
+
+			if deleted := tree.DeleteAll(k); deleted != n {
+				t.Fatalf("delete all %d: %d != %d", k, deleted, n)
+			}
+
+			for range n {
+				master.deleteOne(k, nil)
+			}
+		}
+
+		verify()
+	}
+
+	test(3, 100, 5)
+	test(3, 500, 50)
+	test(4, 1000, 3)
+	test(10, 1000, 20)
+	test(15, 10000, 100)
+}
+
+func TestDuplicatesUpsert(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := 0; i < 10; i++ {
+		tree.Insert(1, fmt.Sprint(i))
+	}
+
+	if inserted := tree.InsertIfAbsent(1, "x"); inserted {
+		t.Fatal("inserted an existing key")
+	}
+
+	if old, replaced := tree.Replace(1, "x"); !replaced || old != "0" {
+		t.Fatalf("replace: %s, %v", old, replaced)
+	}
+
+	if tree.Size != 10 {
+		t.Fatalf("size %d != %d", tree.Size, 10)
+	}
+
+	s := slices.Collect(tree.FindAll(1))
+	master := []string{"x", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+
+	if !slices.Equal(s, master) {
+		t.Fatalf("%v, %v", s, master)
+	}
+}
+
+func TestDuplicatesCursorDelete(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := 0; i < 200; i++ {
+		tree.Insert(i/20, i)
+	}
+
+	c := tree.Cursor()
+
+	for ok := c.SeekFirst(); ok; {
+		if v := c.Value(); v%2 == 0 {
+			if deleted, valid := c.Delete(); deleted != v || (valid && c.Value() != v+1) {
+				t.Fatalf("deleted %d, moved to %d", deleted, c.Value())
+			} else {
+				ok = valid
+			}
+		} else {
+			ok = c.Next()
+		}
+	}
+
+	s := slices.Collect(SeqSecond(tree.FromClosed(0)))
+
+	if len(s) != 100 {
+		t.Fatalf("%d values left", len(s))
+	}
+
+	for i, v := range s {
+		if v != i*2+1 {
+			t.Fatalf("%d not in position", v)
+		}
+	}
+}
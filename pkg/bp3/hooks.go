@@ -0,0 +1,127 @@
+package bp3
+
+// hooks are the functions called after the key-value pairs of an instance change.
+type hooks[K any, V any] struct {
+	insert  []func(kv KeyValue[K, V])
+	replace []func(old, new KeyValue[K, V])
+	delete  []func(old KeyValue[K, V])
+	changes []change[K, V] // changes are the changes made in a transaction, to be reverted on a rollback.
+}
+
+// change is a change to a key-value pair: the pair is added if it had no old one, removed if it has no new one,
+// and replaced otherwise.
+type change[K any, V any] struct {
+	old, new KeyValue[K, V]
+	had, has bool
+}
+
+// OnInsert adds a function that is called after a key-value pair is added to the instance.
+//
+// The hooks are called after the write completes, in the order they were added, and must not modify
+// the instance. They are called by every write that adds, replaces or removes pairs, including bulk
+// loading, cursors, DeleteRange, and SplitAt and Join, which remove the pairs from the instances they
+// move them from. Rolling back a transaction calls them for the reverse of each change it undoes, latest
+// first. Clones and snapshots of the instance do not share its hooks.
+func (t *Instance[K, V]) OnInsert(fn func(kv KeyValue[K, V])) {
+	t.observers().insert = append(t.observers().insert, fn)
+}
+
+// OnReplace adds a function that is called after the value of a key-value pair of the instance
+// is replaced, with the pair before and after. See OnInsert.
+func (t *Instance[K, V]) OnReplace(fn func(old, new KeyValue[K, V])) {
+	t.observers().replace = append(t.observers().replace, fn)
+}
+
+// OnDelete adds a function that is called after a key-value pair is removed from the instance. See OnInsert.
+func (t *Instance[K, V]) OnDelete(fn func(old KeyValue[K, V])) {
+	t.observers().delete = append(t.observers().delete, fn)
+}
+
+func (t *Instance[K, V]) observers() *hooks[K, V] {
+	if t.hooks == nil {
+		t.hooks = &hooks[K, V]{}
+	}
+
+	return t.hooks
+}
+
+// observed returns true if the instance has hooks.
+func (t *Instance[K, V]) observed() bool {
+	return t.hooks != nil
+}
+
+func (t *Instance[K, V]) inserted(kv KeyValue[K, V]) {
+	t.notify(change[K, V]{new: kv, has: true})
+}
+
+func (t *Instance[K, V]) replaced(old, new KeyValue[K, V]) {
+	t.notify(change[K, V]{old: old, new: new, had: true, has: true})
+}
+
+func (t *Instance[K, V]) deleted(old KeyValue[K, V]) {
+	t.notify(change[K, V]{old: old, had: true})
+}
+
+// notify calls the hooks for a change, and records it if a transaction is active.
+func (t *Instance[K, V]) notify(c change[K, V]) {
+	if t.hooks == nil {
+		return
+	}
+
+	if journal, ok := t.Builder.(interface{ Active() bool }); ok && journal.Active() {
+		t.hooks.changes = append(t.hooks.changes, c)
+	}
+
+	t.call(c)
+}
+
+func (t *Instance[K, V]) call(c change[K, V]) {
+	switch {
+	case c.had && c.has:
+		for _, fn := range t.hooks.replace {
+			fn(c.old, c.new)
+		}
+	case c.has:
+		for _, fn := range t.hooks.insert {
+			fn(c.new)
+		}
+	default:
+		for _, fn := range t.hooks.delete {
+			fn(c.old)
+		}
+	}
+}
+
+// recorded returns the number of changes recorded in transactions.
+func (t *Instance[K, V]) recorded() int {
+	if t.hooks == nil {
+		return 0
+	}
+
+	return len(t.hooks.changes)
+}
+
+// revert calls the hooks for the reverse of the changes recorded since the given number of them,
+// latest first, and drops them. The changes are dropped altogether once no transaction is active.
+func (t *Instance[K, V]) revert(since int) {
+	if t.hooks == nil {
+		return
+	}
+
+	changes := t.hooks.changes[since:]
+	t.hooks.changes = t.hooks.changes[:since]
+
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		t.call(change[K, V]{old: c.new, new: c.old, had: c.has, has: c.had})
+	}
+
+	t.settled()
+}
+
+// settled drops the recorded changes if no transaction is active.
+func (t *Instance[K, V]) settled() {
+	if journal, ok := t.Builder.(interface{ Active() bool }); t.hooks != nil && ok && !journal.Active() {
+		t.hooks.changes = nil
+	}
+}
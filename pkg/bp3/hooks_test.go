@@ -0,0 +1,135 @@
+package bp3_test
+
+import (
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestHooks(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+	mirror := make(map[int]int)
+
+	tree.OnInsert(func(kv bp3.KeyValue[int, int]) {
+		if _, found := mirror[kv.Key]; found {
+			t.Fatalf("insert of existing key %d", kv.Key)
+		}
+
+		mirror[kv.Key] = kv.Value
+	})
+
+	tree.OnReplace(func(old, new bp3.KeyValue[int, int]) {
+		if mirror[old.Key] != old.Value || old.Key != new.Key {
+			t.Fatalf("replace of %v with %v, mirror has %d", old, new, mirror[old.Key])
+		}
+
+		mirror[new.Key] = new.Value
+	})
+
+	tree.OnDelete(func(old bp3.KeyValue[int, int]) {
+		if v, found := mirror[old.Key]; !found || v != old.Value {
+			t.Fatalf("delete of %v, mirror has %d", old, v)
+		}
+
+		delete(mirror, old.Key)
+	})
+
+	check := func(step string) {
+		if len(mirror) != tree.Count() {
+			t.Fatalf("%s: mirror has %d pairs, tree %d", step, len(mirror), tree.Count())
+		}
+
+		for k, v := range tree.FromClosed(0) {
+			if mirror[k] != v {
+				t.Fatalf("%s: mirror has %d for %d, tree %d", step, mirror[k], k, v)
+			}
+		}
+	}
+
+	for i := range 200 {
+		tree.Insert(i, i)
+	}
+
+	check("insert")
+
+	for i := range 100 {
+		tree.Insert(i, -i)
+	}
+
+	tree.Replace(150, 1)
+	tree.InsertIfAbsent(150, 2)
+	tree.InsertIfAbsent(300, 3)
+	tree.Update(160, func(old int, ok bool) (int, bool) { return old * 2, ok })
+	tree.Update(170, func(int, bool) (int, bool) { return 0, false })
+	check("replace")
+
+	for i := 0; i < 200; i += 3 {
+		tree.Delete(i)
+	}
+
+	tree.PopMin()
+	tree.PopMax()
+	check("delete")
+
+	c := tree.Cursor()
+
+	for ok := c.Seek(50); ok; ok = c.Next() {
+		c.SetValue(c.Key() * 10)
+	}
+
+	c.Seek(20)
+	c.Delete()
+	check("cursor")
+
+	tree.DeleteRange(bp3.RangeValue[int]{Value: 60, Closed: true}, bp3.RangeValue[int]{Value: 120, Closed: false})
+	check("delete range")
+
+	tx := tree.Begin()
+	tx.Insert(500, 5)
+	tx.Delete(50)
+	tx.Replace(130, 13)
+	check("tx")
+
+	sp := tx.Savepoint()
+	tx.DeleteRange(bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 140, Closed: false})
+	tx.PopMinN(3)
+	tx.Insert(50, 0)
+
+	// the hooks are called for the reverse of the changes that are undone
+	tx.RollbackTo(sp)
+	check("rollback to")
+
+	tx.Rollback()
+	check("rollback")
+
+	left, right := tree.SplitAt(100)
+	check("split")
+
+	joined, err := bp3.Join(left, right)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range joined.FromClosed(0) {
+		tree.Insert(k, v)
+	}
+
+	check("refill")
+
+	other := bp3.New[int, int](bp3.WithOrder(3))
+	other.Insert(1000, 1)
+
+	if _, err := bp3.Join(tree, other); err != nil {
+		t.Fatal(err)
+	}
+
+	check("join")
+
+	for i := range 100 {
+		tree.Insert(i, i)
+	}
+
+	bp3.Clear(tree)
+	check("clear")
+}
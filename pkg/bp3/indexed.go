@@ -0,0 +1,224 @@
+package bp3
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Indexed is a collection of key-value pairs kept in a primary instance, with any number of secondary
+// indexes that look the pairs up by keys extracted from them. The indexes are updated by hooks on the
+// primary instance, so that every write to it (directly, through a cursor or through a wrapper) updates
+// them as well, as does rolling back a transaction. The generic parameters K and V are for the key and
+// value types, respectively.
+type Indexed[K any, V any] struct {
+	Primary *Instance[K, V] // Primary is the instance that holds the key-value pairs.
+	indexes map[string]secondary[K, V]
+}
+
+// secondary is an index of an Indexed collection, with its key type erased.
+type secondary[K any, V any] interface {
+	add(kv KeyValue[K, V])
+	replace(old, new KeyValue[K, V])
+	remove(kv KeyValue[K, V])
+	find(key any) iter.Seq2[K, V]
+	span(from, to RangeValue[any]) iter.Seq2[K, V]
+}
+
+// NewIndexed creates a collection over a primary instance, and adds the hooks that update its indexes
+// to the instance. It panics if the instance is in duplicates mode, as its pairs have no unique keys.
+func NewIndexed[K any, V any](primary *Instance[K, V]) *Indexed[K, V] {
+	if primary.Duplicates {
+		panic("bp3: indexed instance with duplicates")
+	}
+
+	ix := &Indexed[K, V]{Primary: primary, indexes: make(map[string]secondary[K, V])}
+
+	primary.OnInsert(func(kv KeyValue[K, V]) {
+		for _, index := range ix.indexes {
+			index.add(kv)
+		}
+	})
+
+	primary.OnReplace(func(old, new KeyValue[K, V]) {
+		for _, index := range ix.indexes {
+			index.replace(old, new)
+		}
+	})
+
+	primary.OnDelete(func(old KeyValue[K, V]) {
+		for _, index := range ix.indexes {
+			index.remove(old)
+		}
+	})
+
+	return ix
+}
+
+// FindBy returns a sequence of the key-value pairs whose key extracted by the named index equals the
+// given key, in ascending order of their primary keys. It panics if there is no such index, or if the
+// key is not of the index key type.
+func (ix *Indexed[K, V]) FindBy(name string, key any) iter.Seq2[K, V] {
+	return ix.index(name).find(key)
+}
+
+// RangeBy returns a sequence of the key-value pairs whose key extracted by the named index is within
+// the specified range, in ascending order of the extracted keys, then of the primary keys. It panics
+// if there is no such index, or if the range values are not of the index key type.
+func (ix *Indexed[K, V]) RangeBy(name string, from, to RangeValue[any]) iter.Seq2[K, V] {
+	return ix.index(name).span(from, to)
+}
+
+// IndexOf returns the secondary index of a collection under the given name, to look the pairs up by
+// its extracted keys of type X without the type assertions of FindBy and RangeBy. It panics if there is
+// no such index, or if its extracted keys are not of type X.
+func IndexOf[X any, K any, V any](ix *Indexed[K, V], name string) *Index[K, V, X] {
+	typed, ok := ix.index(name).(*Index[K, V, X])
+
+	if !ok {
+		panic("bp3: index " + name + " has another key type")
+	}
+
+	return typed
+}
+
+func (ix *Indexed[K, V]) index(name string) secondary[K, V] {
+	index, found := ix.indexes[name]
+
+	if !found {
+		panic("bp3: unknown index " + name)
+	}
+
+	return index
+}
+
+// Index is a secondary index of an Indexed collection. It holds the primary key of each pair ordered
+// by the key extracted from the pair, then by the primary key, so that pairs may share an extracted key.
+// The generic parameters K and V are for the key and value types, and X is for the extracted key type.
+type Index[K any, V any, X any] struct {
+	primary *Instance[K, V]
+	extract func(kv KeyValue[K, V]) X
+	compare func(a, b X) int
+	tree    *Instance[entry[K, X], struct{}]
+}
+
+// entry is a key of a secondary index. A bound entry is below (negative) or above (positive)
+// all the entries with its extracted key, whatever their primary keys.
+type entry[K any, X any] struct {
+	key   X
+	pk    K
+	bound int
+}
+
+// AddIndex adds a secondary index under the given name to a collection, keyed by the ordered keys
+// the extract function returns for the key-value pairs, and fills it with the pairs of the primary
+// instance. The options apply to the instance that holds the index. It panics if the name is taken.
+func AddIndex[K any, V any, X constraints.Ordered](ix *Indexed[K, V], name string, extract func(kv KeyValue[K, V]) X, options ...Option) *Index[K, V, X] {
+	return AddIndexFunc(ix, name, cmp.Compare[X], extract, options...)
+}
+
+// AddIndexFunc adds a secondary index under the given name to a collection, keyed by the keys the
+// extract function returns for the key-value pairs, ordered by the given compare function. See AddIndex.
+func AddIndexFunc[K any, V any, X any](ix *Indexed[K, V], name string, compare func(a, b X) int, extract func(kv KeyValue[K, V]) X, options ...Option) *Index[K, V, X] {
+	if _, found := ix.indexes[name]; found {
+		panic("bp3: index " + name + " already exists")
+	}
+
+	index := &Index[K, V, X]{primary: ix.Primary, extract: extract, compare: compare}
+
+	index.tree = NewFunc[entry[K, X], struct{}](func(a, b entry[K, X]) int {
+		if c := compare(a.key, b.key); c != 0 {
+			return c
+		}
+
+		if a.bound != 0 || b.bound != 0 {
+			return cmp.Compare(a.bound, b.bound)
+		}
+
+		return ix.Primary.compare(a.pk, b.pk)
+	}, options...)
+
+	for _, kv := range Slice(ix.Primary.Root) {
+		index.add(kv)
+	}
+
+	ix.indexes[name] = index
+
+	return index
+}
+
+// Find returns a sequence of the key-value pairs whose extracted key equals the given key,
+// in ascending order of their primary keys.
+func (index *Index[K, V, X]) Find(key X) iter.Seq2[K, V] {
+	return index.Range(RangeValue[X]{key, true}, RangeValue[X]{key, true})
+}
+
+// Range returns a sequence of the key-value pairs whose extracted key is within the specified range,
+// in ascending order of the extracted keys, then of the primary keys. An entry whose pair is not found
+// in the primary instance, or no longer has the extracted key of the entry, is skipped.
+func (index *Index[K, V, X]) Range(from, to RangeValue[X]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		lower, upper := entry[K, X]{key: from.Value, bound: 1}, entry[K, X]{key: to.Value, bound: -1}
+
+		if from.Closed {
+			lower.bound = -1
+		}
+
+		if to.Closed {
+			upper.bound = 1
+		}
+
+		for e := range index.tree.RangeClosed(lower, upper) {
+			v, found := index.primary.Find(e.pk)
+
+			if !found || index.compare(index.extract(KeyValue[K, V]{Key: e.pk, Value: v}), e.key) != 0 {
+				continue
+			}
+
+			if !yield(e.pk, v) {
+				return
+			}
+		}
+	}
+}
+
+// Count returns the number of entries in the index.
+func (index *Index[K, V, X]) Count() int {
+	return index.tree.Count()
+}
+
+func (index *Index[K, V, X]) add(kv KeyValue[K, V]) {
+	index.tree.Insert(entry[K, X]{key: index.extract(kv), pk: kv.Key}, struct{}{})
+}
+
+func (index *Index[K, V, X]) replace(old, new KeyValue[K, V]) {
+	if index.compare(index.extract(old), index.extract(new)) != 0 {
+		index.remove(old)
+		index.add(new)
+	}
+}
+
+func (index *Index[K, V, X]) remove(kv KeyValue[K, V]) {
+	index.tree.Delete(entry[K, X]{key: index.extract(kv), pk: kv.Key})
+}
+
+func (index *Index[K, V, X]) find(key any) iter.Seq2[K, V] {
+	return index.Find(index.key(key))
+}
+
+func (index *Index[K, V, X]) span(from, to RangeValue[any]) iter.Seq2[K, V] {
+	return index.Range(RangeValue[X]{index.key(from.Value), from.Closed}, RangeValue[X]{index.key(to.Value), to.Closed})
+}
+
+// key returns a key given to FindBy or RangeBy as an extracted key, it panics if it is of another type.
+func (index *Index[K, V, X]) key(key any) X {
+	x, ok := key.(X)
+
+	if !ok {
+		panic(fmt.Sprintf("bp3: index key %v of type %T, expected %T", key, key, *new(X)))
+	}
+
+	return x
+}
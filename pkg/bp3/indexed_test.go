@@ -0,0 +1,147 @@
+package bp3_test
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+type user struct {
+	email  string
+	status int
+}
+
+func TestIndexed(t *testing.T) {
+	ix := bp3.NewIndexed(bp3.New[int, user](bp3.WithOrder(4)))
+
+	for i := range 50 {
+		ix.Primary.Insert(i, user{email: fmt.Sprintf("u%02d@example.com", i), status: i % 3})
+	}
+
+	// an index added later is filled with the existing pairs
+	byEmail := bp3.AddIndex(ix, "email", func(kv bp3.KeyValue[int, user]) string { return kv.Value.email })
+	byStatus := bp3.AddIndex(ix, "status", func(kv bp3.KeyValue[int, user]) int { return kv.Value.status }, bp3.WithOrder(3))
+
+	for i := 50; i < 100; i++ {
+		ix.Primary.Insert(i, user{email: fmt.Sprintf("u%02d@example.com", i), status: i % 3})
+	}
+
+	if byEmail.Count() != 100 || byStatus.Count() != 100 {
+		t.Fatalf("index counts %d, %d", byEmail.Count(), byStatus.Count())
+	}
+
+	keys := func(seq func(yield func(int, user) bool)) []int {
+		return slices.Collect(maps.Keys(maps.Collect(seq)))
+	}
+
+	if k := keys(ix.FindBy("email", "u42@example.com")); !slices.Equal(k, []int{42}) {
+		t.Fatalf("find by email: %v", k)
+	}
+
+	if k := keys(bp3.IndexOf[string](ix, "email").Find("u42@example.com")); !slices.Equal(k, []int{42}) {
+		t.Fatalf("find by typed email: %v", k)
+	}
+
+	// change the status of 42 and remove 43
+	ix.Primary.Insert(42, user{email: "u42@example.com", status: 7})
+	ix.Primary.Delete(43)
+
+	if k := keys(ix.FindBy("status", 7)); !slices.Equal(k, []int{42}) {
+		t.Fatalf("find by status: %v", k)
+	}
+
+	if k := keys(bp3.IndexOf[int](ix, "status").Find(7)); !slices.Equal(k, []int{42}) {
+		t.Fatalf("find by typed status: %v", k)
+	}
+
+	if k := keys(ix.FindBy("email", "u43@example.com")); len(k) != 0 {
+		t.Fatalf("deleted pair found: %v", k)
+	}
+
+	var statuses []int
+
+	for k, u := range byStatus.Find(1) {
+		if u.status != 1 || k%3 != 1 {
+			t.Fatalf("status 1: %d %+v", k, u)
+		}
+
+		statuses = append(statuses, k)
+	}
+
+	if !slices.IsSorted(statuses) || len(statuses) != 32 {
+		t.Fatalf("status 1: %v", statuses)
+	}
+
+	var emails []string
+
+	for _, u := range ix.RangeBy("email", bp3.RangeValue[any]{Value: "u10", Closed: true}, bp3.RangeValue[any]{Value: "u20", Closed: false}) {
+		emails = append(emails, u.email)
+	}
+
+	if len(emails) != 10 || emails[0] != "u10@example.com" || emails[9] != "u19@example.com" {
+		t.Fatalf("range by email: %v", emails)
+	}
+
+	ix.Primary.DeleteRange(bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 90, Closed: false})
+
+	if byEmail.Count() != 10 || byStatus.Count() != 10 {
+		t.Fatalf("index counts %d, %d", byEmail.Count(), byStatus.Count())
+	}
+
+	tx := ix.Primary.Begin()
+	tx.Insert(95, user{email: "new@example.com", status: 1})
+	tx.Delete(96)
+	tx.Insert(200, user{email: "u200@example.com"})
+	tx.Rollback()
+
+	// the rollback is undone in the indexes as well
+	if k := keys(byEmail.Find("u95@example.com")); !slices.Equal(k, []int{95}) || byEmail.Count() != 10 {
+		t.Fatalf("find by email after rollback: %v, count %d", k, byEmail.Count())
+	}
+
+	if k := keys(byEmail.Find("new@example.com")); len(k) != 0 {
+		t.Fatalf("rolled back pair found: %v", k)
+	}
+
+	left, right := ix.Primary.SplitAt(95)
+
+	if byEmail.Count() != 0 || byStatus.Count() != 0 || left.Count() != 5 || right.Count() != 5 {
+		t.Fatalf("index counts %d, %d after split", byEmail.Count(), byStatus.Count())
+	}
+}
+
+func TestIndexedStale(t *testing.T) {
+	ix := bp3.NewIndexed(bp3.New[int, *user]())
+	byEmail := bp3.AddIndex(ix, "email", func(kv bp3.KeyValue[int, *user]) string { return kv.Value.email })
+
+	for i := range 10 {
+		ix.Primary.Insert(i, &user{email: fmt.Sprintf("u%d@example.com", i)})
+	}
+
+	// a value changed in place is not seen by the hooks
+	u, _ := ix.Primary.Find(3)
+	u.email = "changed@example.com"
+
+	for k, v := range byEmail.Find("u3@example.com") {
+		t.Fatalf("stale entry of %d: %+v", k, v)
+	}
+
+	for _, fn := range []func(){
+		func() { bp3.IndexOf[int](ix, "email") },
+		func() { ix.FindBy("email", 3) },
+		func() { ix.FindBy("status", "active") },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatal("index of another key type")
+				}
+			}()
+
+			fn()
+		}()
+	}
+}
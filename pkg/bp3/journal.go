@@ -0,0 +1,87 @@
+package bp3
+
+// Journal records how to undo the changes made to the nodes of a node builder, in nested levels
+// that are undone or committed as a whole. A builder embeds it to implement NodeJournal, and calls
+// Record before changing a node while a level is active.
+type Journal struct {
+	undo  []func()
+	marks []int       // marks are the positions in undo where the levels start.
+	ids   []int       // ids identify the levels, so that a change is recorded once per level.
+	seen  map[any]int // seen maps the recorded keys to the id of the last level they were recorded in.
+	next  int
+}
+
+// Active returns true if a level was marked and not yet ended.
+func (j *Journal) Active() bool {
+	return len(j.marks) > 0
+}
+
+// Mark starts a new level and returns it.
+func (j *Journal) Mark() int {
+	if j.seen == nil {
+		j.seen = make(map[any]int)
+	}
+
+	j.next++
+	j.marks = append(j.marks, len(j.undo))
+	j.ids = append(j.ids, j.next)
+
+	return len(j.marks) - 1
+}
+
+// Record calls save the first time a key (such as a node descriptor) is recorded in the current level,
+// and keeps the function it returns, which undoes the changes made to the key from then on.
+// It does nothing if no level is active.
+func (j *Journal) Record(key any, save func() func()) {
+	if !j.Active() {
+		return
+	}
+
+	id := j.ids[len(j.ids)-1]
+	prev, found := j.seen[key]
+
+	if found && prev == id {
+		return
+	}
+
+	j.seen[key] = id
+	undo := save()
+
+	j.undo = append(j.undo, func() {
+		undo()
+
+		if found {
+			j.seen[key] = prev
+		} else {
+			delete(j.seen, key)
+		}
+	})
+}
+
+// Undo undoes the changes recorded since the level was marked, latest first, and ends the level
+// with the levels after it.
+func (j *Journal) Undo(level int) {
+	mark := j.marks[level]
+
+	for i := len(j.undo) - 1; i >= mark; i-- {
+		j.undo[i]()
+	}
+
+	clear(j.undo[mark:])
+	j.undo = j.undo[:mark]
+	j.end(level)
+}
+
+// Commit ends the level with the levels after it, keeping their changes. The changes are
+// still undone if an enclosing level is.
+func (j *Journal) Commit(level int) {
+	j.end(level)
+}
+
+func (j *Journal) end(level int) {
+	j.marks, j.ids = j.marks[:level], j.ids[:level]
+
+	if level == 0 {
+		j.undo, j.seen = nil, nil
+	}
+}
@@ -0,0 +1,624 @@
+package bp3
+
+import (
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Latched wraps an instance for concurrent use by multiple goroutines, where each node has its own
+// read/write latch. Operations descend from the root holding the latch of a node until the latch of
+// its child is taken (latch coupling), and writers keep the latches of the ancestors only while the
+// child may split or underflow, or holds the key as its separator, so that writes in different key
+// ranges proceed in parallel. Once wrapped, the instance must only be accessed through the wrapper
+// until Instance returns it.
+//
+// The nodes are read, written, created and deleted through the builder of the instance, so a latched
+// instance may be stored on disk. With exclusive reads, the calls to the builder and to the node
+// descriptors are serialized, for builders that load nodes lazily. The instance must have unique keys
+// and no copy-on-write mode, monoid, deadlines or hooks, as these change the ancestors of every
+// written leaf and would keep the writers latched at the root. The child counts are dropped when the
+// instance is wrapped and computed again by Instance.
+type Latched[K any, V any] struct {
+	mu      sync.RWMutex // mu guards the root and the minimum key of the instance.
+	gate    sync.RWMutex // gate is held shared by the operations, and exclusively while the instance is used whole.
+	access  sync.Mutex   // access serializes the node accesses with exclusive reads.
+	tree    *Instance[K, V]
+	latches sync.Map // latches maps the node descriptors to their latches.
+	size    atomic.Int64
+	opts    concurrentOptions
+}
+
+// NewLatched creates a new latched b+tree with the specified options.
+func NewLatched[K constraints.Ordered, V any](options ...Option) *Latched[K, V] {
+	return NewLatchedFunc[K, V](nil, options...)
+}
+
+// NewLatchedFunc creates a new latched b+tree with the specified options, where keys are ordered by the
+// given compare function, see NewFunc. Only the order options apply, it panics if duplicates, copy-on-write,
+// a monoid or a clock are requested, as they are not supported.
+func NewLatchedFunc[K any, V any](compare func(a, b K) int, options ...Option) *Latched[K, V] {
+	if opts := buildOptions(options...); opts.clock != nil {
+		panic("bp3: unsupported option for a latched tree")
+	}
+
+	return Latch(NewFunc[K, V](compare, options...))
+}
+
+// Latch wraps an instance for concurrent use with the specified options, see WithExclusiveReads and
+// WithFlush. It panics if the instance has duplicates, copy-on-write mode, a monoid, deadlines or hooks.
+func Latch[K any, V any](tree *Instance[K, V], options ...ConcurrentOption) *Latched[K, V] {
+	if tree.Duplicates || tree.CopyOnWrite || tree.Aggregator != nil || tree.scheduled() || tree.observed() {
+		panic("bp3: unsupported option for a latched tree")
+	}
+
+	l := &Latched[K, V]{tree: tree, opts: buildConcurrentOptions(options...)}
+	l.size.Store(int64(tree.Size))
+	tree.resolve()
+
+	if tree.Root != nil {
+		l.uncount(tree.Root)
+	}
+
+	return l
+}
+
+// Count returns the number of key-value pairs in the tree.
+func (l *Latched[K, V]) Count() int {
+	return int(l.size.Load())
+}
+
+// Find retrieves the value associated with the given key.
+// It returns the value and a boolean indicating whether the key was found.
+func (l *Latched[K, V]) Find(key K) (V, bool) {
+	l.gate.RLock()
+	defer l.gate.RUnlock()
+
+	leaf, _, _ := l.descend(key)
+
+	if leaf == nil {
+		return *new(V), false
+	}
+
+	defer l.latch(leaf).RUnlock()
+
+	values := l.read(leaf).Values
+
+	if i := l.tree.search(values, key, false); i < len(values) && l.tree.compare(values[i].Key, key) == 0 {
+		return values[i].Value, true
+	}
+
+	return *new(V), false
+}
+
+// Range returns a sequence of the key-value pairs within the specified range. The latch of a leaf
+// is held only while its pairs are copied, the pairs are returned in ascending order, and the pairs
+// added or removed after the sequence passed their key are not seen by it.
+func (l *Latched[K, V]) Range(from, to RangeValue[K]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t := l.tree
+
+		if t.compare(to.Value, from.Value) < 0 {
+			return
+		}
+
+		var batch []KeyValue[K, V]
+
+		for {
+			l.gate.RLock()
+			leaf, upper, bounded := l.descend(from.Value)
+			batch = batch[:0]
+
+			if leaf != nil {
+				for _, kv := range l.read(leaf).Values {
+					if t.after(kv.Key, to) {
+						bounded = false
+						break
+					}
+
+					if !t.before(kv.Key, from) {
+						batch = append(batch, kv)
+					}
+				}
+
+				l.latch(leaf).RUnlock()
+			}
+
+			l.gate.RUnlock()
+
+			for _, kv := range batch {
+				if !yield(kv.Key, kv.Value) {
+					return
+				}
+			}
+
+			// the next leaf starts at the separator above this one
+			if !bounded {
+				return
+			}
+
+			from = RangeValue[K]{upper, true}
+		}
+	}
+}
+
+// Insert adds a key-value pair to the tree, replacing the value of an existing key.
+// It returns the previous value associated with the key and a boolean indicating whether the key existed.
+func (l *Latched[K, V]) Insert(key K, value V) (V, bool) {
+	l.gate.RLock()
+	defer l.gate.RUnlock()
+
+	t := l.tree
+
+	// a new minimum key changes the minimum of the instance
+	p := l.lock(key, func(n *Node[K, V]) bool {
+		return n.Count() < t.capacity(n.Leaf())
+	}, func() bool {
+		return t.Root == nil || t.compare(key, t.Min) < 0
+	})
+
+	defer l.unlock(p)
+
+	if len(p.stack) == 0 {
+		t.Root, t.Min = l.create(&Node[K, V]{Values: []KeyValue[K, V]{{Key: key, Value: value}}}), key
+		l.size.Add(1)
+
+		return *new(V), false
+	}
+
+	leaf := p.stack[len(p.stack)-1]
+	values := l.read(leaf).Values
+	i := t.search(values, key, false)
+
+	if i < len(values) && t.compare(values[i].Key, key) == 0 {
+		old := values[i].Value
+		l.write(leaf).Values[i].Value = value
+		return old, true
+	}
+
+	l.write(leaf).Values = slices.Insert(values, i, KeyValue[K, V]{Key: key, Value: value})
+	l.size.Add(1)
+
+	if p.locked && t.compare(key, t.Min) < 0 {
+		t.Min = key
+	}
+
+	// split the overflowing nodes, the first ancestor kept is either safe or the root
+	for j := len(p.stack) - 1; j >= 0 && l.read(p.stack[j]).Count() > t.capacity(l.read(p.stack[j]).Leaf()); j-- {
+		right, separator := l.split(p.stack[j])
+
+		if j == 0 {
+			t.Root = l.create(&Node[K, V]{Mins: []K{separator}, Children: []NodeDescriptor[K, V]{p.stack[j], right}})
+			continue
+		}
+
+		parent, k := l.write(p.stack[j-1]), p.indices[j]
+		parent.Mins = slices.Insert(parent.Mins, k, separator)
+		parent.Children = slices.Insert(parent.Children, k+1, right)
+	}
+
+	return *new(V), false
+}
+
+// Delete removes the key-value pair associated with the specified key from the tree.
+// It returns the deleted value and a boolean indicating whether the key was found and deleted.
+func (l *Latched[K, V]) Delete(key K) (V, bool) {
+	l.gate.RLock()
+	defer l.gate.RUnlock()
+
+	t := l.tree
+
+	// removing the minimum key changes the minimum of the instance
+	p := l.lock(key, func(n *Node[K, V]) bool {
+		return n.Count() > t.least(n.Leaf())
+	}, func() bool {
+		return t.Root != nil && t.compare(key, t.Min) == 0
+	})
+
+	defer l.unlock(p)
+
+	if len(p.stack) == 0 {
+		return *new(V), false
+	}
+
+	leaf := p.stack[len(p.stack)-1]
+	values := l.read(leaf).Values
+	i := t.search(values, key, false)
+
+	if i == len(values) || t.compare(values[i].Key, key) != 0 {
+		return *new(V), false
+	}
+
+	v := values[i].Value
+	values = slices.Delete(values, i, i+1)
+	l.write(leaf).Values = values
+	l.size.Add(-1)
+
+	if len(values) == 0 {
+		// only the root leaf is left empty, and the root is locked for it
+		l.remove(p, leaf)
+		t.Root, t.Min = nil, *new(K)
+
+		return v, true
+	}
+
+	// the new first key of the leaf replaces the key as a separator, or as the minimum
+	if i == 0 {
+		if p.anchor >= 0 {
+			l.write(p.stack[p.anchor]).Mins[p.slot] = values[0].Key
+		} else if p.locked {
+			t.Min = values[0].Key
+		}
+	}
+
+	// rebalance the underflowing nodes, the first ancestor kept is either safe or the root
+	for j := len(p.stack) - 1; j > 0 && l.read(p.stack[j]).Count() < t.least(l.read(p.stack[j]).Leaf()); j-- {
+		l.rebalance(p, j)
+	}
+
+	// an internal root left with a single child is replaced by it
+	if root := p.stack[0]; p.locked && root == t.Root {
+		if node := l.read(root); !node.Leaf() && len(node.Children) == 1 {
+			t.Root = node.Children[0]
+			l.remove(p, root)
+		}
+	}
+
+	return v, true
+}
+
+// Instance returns the wrapped instance with its size and child counts up to date, for the rest of
+// the API once the concurrent work is done. It must not be called concurrently with the other methods
+// of the tree, and the instance must only be accessed through the tree again after it is used.
+func (l *Latched[K, V]) Instance() *Instance[K, V] {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+
+	l.sync()
+
+	if l.tree.Root != nil {
+		l.recount(l.tree.Root)
+	}
+
+	return l.tree
+}
+
+// Validate checks the structure of the wrapped instance, see Instance.Validate.
+// It must not be called concurrently with the other methods of the tree.
+func (l *Latched[K, V]) Validate() error {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+
+	l.sync()
+
+	return l.tree.Validate()
+}
+
+// Flush flushes the wrapped instance, with the function set by WithFlush or with its builder.
+// It waits for the operations in progress, and holds the next ones until it returns.
+func (l *Latched[K, V]) Flush() error {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+
+	l.sync()
+
+	if l.opts.flush != nil {
+		return l.opts.flush()
+	}
+
+	return l.tree.Builder.Flush()
+}
+
+// sync sets the size of the instance, and marks it as modified.
+func (l *Latched[K, V]) sync() {
+	l.tree.Size = l.Count()
+	l.tree.Version++
+}
+
+// uncount drops the child counts of the internal nodes of a subtree, as the writes do not update them.
+func (l *Latched[K, V]) uncount(d NodeDescriptor[K, V]) {
+	if node := d.Read(); !node.Leaf() {
+		if node.Counts != nil {
+			d.Write().Counts = nil
+		}
+
+		for _, child := range node.Children {
+			l.uncount(child)
+		}
+	}
+}
+
+// recount sets the child counts of the internal nodes of a subtree, and returns its number of pairs.
+func (l *Latched[K, V]) recount(d NodeDescriptor[K, V]) int {
+	node := d.Read()
+
+	if node.Leaf() {
+		return len(node.Values)
+	}
+
+	counts, n := make([]int, len(node.Children)), 0
+
+	for i, child := range node.Children {
+		counts[i] = l.recount(child)
+		n += counts[i]
+	}
+
+	d.Write().Counts = counts
+
+	return n
+}
+
+// latch returns the latch of a node.
+func (l *Latched[K, V]) latch(d NodeDescriptor[K, V]) *sync.RWMutex {
+	if m, found := l.latches.Load(d); found {
+		return m.(*sync.RWMutex)
+	}
+
+	m, _ := l.latches.LoadOrStore(d, &sync.RWMutex{})
+
+	return m.(*sync.RWMutex)
+}
+
+// read returns the node of a latched descriptor for reading.
+func (l *Latched[K, V]) read(d NodeDescriptor[K, V]) *Node[K, V] {
+	if l.opts.exclusiveReads {
+		l.access.Lock()
+		defer l.access.Unlock()
+	}
+
+	return d.Read()
+}
+
+// write returns the node of a write-latched descriptor for modification.
+func (l *Latched[K, V]) write(d NodeDescriptor[K, V]) *Node[K, V] {
+	if l.opts.exclusiveReads {
+		l.access.Lock()
+		defer l.access.Unlock()
+	}
+
+	return d.Write()
+}
+
+// create creates a node with the builder of the instance.
+func (l *Latched[K, V]) create(node *Node[K, V]) NodeDescriptor[K, V] {
+	if l.opts.exclusiveReads {
+		l.access.Lock()
+		defer l.access.Unlock()
+	}
+
+	return l.tree.Builder.Create(node)
+}
+
+// remove deletes a write-latched node that is no longer reachable. Its latch is dropped once the
+// path of the write is unlatched.
+func (l *Latched[K, V]) remove(p *latching[K, V], d NodeDescriptor[K, V]) {
+	if l.opts.exclusiveReads {
+		l.access.Lock()
+		defer l.access.Unlock()
+	}
+
+	l.tree.Builder.Delete(d)
+	p.removed = append(p.removed, d)
+}
+
+// descend returns the read-latched leaf where the key belongs, or nil if the tree is empty. It also
+// returns the separator above the leaf and a boolean indicating whether there is one (the leaf is not
+// the last).
+func (l *Latched[K, V]) descend(key K) (NodeDescriptor[K, V], K, bool) {
+	var upper K
+	var bounded bool
+
+	l.mu.RLock()
+	d := l.tree.Root
+
+	if d == nil {
+		l.mu.RUnlock()
+		return nil, upper, false
+	}
+
+	l.latch(d).RLock()
+	l.mu.RUnlock()
+
+	for node := l.read(d); !node.Leaf(); node = l.read(d) {
+		i := l.tree.child(node.Mins, key, false)
+
+		if i < len(node.Mins) {
+			upper, bounded = node.Mins[i], true
+		}
+
+		child := node.Children[i]
+		l.latch(child).RLock()
+		l.latch(d).RUnlock()
+		d = child
+	}
+
+	return d, upper, bounded
+}
+
+// latching is the write-latched path of a write, from the first node it keeps to the leaf.
+type latching[K any, V any] struct {
+	stack   []NodeDescriptor[K, V]
+	indices []int // indices are the indices of the nodes in their parents.
+	locked  bool  // locked is true while the root lock is held.
+	pinned  bool  // pinned is true if the root lock is held to the end, for the minimum key of the instance.
+	anchor  int   // anchor is the position of the node that has the key as a separator, -1 if none does.
+	slot    int   // slot is the index of the separator in the anchor.
+	removed []NodeDescriptor[K, V]
+}
+
+// lock write-latches the path from the root to the leaf where the key belongs. The latches of the
+// ancestors of a safe node (one that is not changed by changes to its children) are released along
+// the way, unless they hold the key as a separator, and so is the root lock, unless pinned returns
+// true. An empty path is returned with the root lock held if the tree is empty.
+func (l *Latched[K, V]) lock(key K, safe func(*Node[K, V]) bool, pinned func() bool) *latching[K, V] {
+	l.mu.Lock()
+
+	p := &latching[K, V]{locked: true, anchor: -1}
+	d := l.tree.Root
+
+	if d == nil {
+		return p
+	}
+
+	p.pinned = pinned()
+	l.latch(d).Lock()
+	p.stack, p.indices = append(p.stack, d), append(p.indices, 0)
+
+	// an internal root is replaced when left with a single child
+	if node := l.read(d); safe(node) && (node.Leaf() || len(node.Children) > 2) && !p.pinned {
+		l.mu.Unlock()
+		p.locked = false
+	}
+
+	for node := l.read(d); !node.Leaf(); node = l.read(d) {
+		i := l.tree.child(node.Mins, key, false)
+
+		if i > 0 && l.tree.compare(node.Mins[i-1], key) == 0 {
+			p.anchor, p.slot = len(p.stack)-1, i-1
+		}
+
+		child := node.Children[i]
+		l.latch(child).Lock()
+
+		if safe(l.read(child)) {
+			l.release(p)
+		}
+
+		p.stack, p.indices = append(p.stack, child), append(p.indices, i)
+		d = child
+	}
+
+	return p
+}
+
+// release unlatches the path above the anchor, or all of it if there is none, and the root lock unless it is pinned.
+func (l *Latched[K, V]) release(p *latching[K, V]) {
+	keep := len(p.stack)
+
+	if p.anchor >= 0 {
+		keep, p.anchor = p.anchor, 0
+	}
+
+	for _, d := range p.stack[:keep] {
+		l.latch(d).Unlock()
+	}
+
+	p.stack, p.indices = p.stack[keep:], p.indices[keep:]
+
+	if p.locked && !p.pinned {
+		l.mu.Unlock()
+		p.locked = false
+	}
+}
+
+// unlock unlatches the path, drops the latches of the nodes it removed, and releases the root lock if it is held.
+func (l *Latched[K, V]) unlock(p *latching[K, V]) {
+	for _, d := range p.stack {
+		l.latch(d).Unlock()
+	}
+
+	for _, d := range p.removed {
+		l.latches.Delete(d)
+	}
+
+	if p.locked {
+		l.mu.Unlock()
+	}
+}
+
+// split moves the upper half of an overflowing node to a new right sibling.
+// It returns the sibling and the separator between them.
+func (l *Latched[K, V]) split(d NodeDescriptor[K, V]) (NodeDescriptor[K, V], K) {
+	node := l.write(d)
+	mid := node.Count() / 2
+
+	if node.Leaf() {
+		right := l.create(&Node[K, V]{Values: slices.Clone(node.Values[mid:]), Next: node.Next, Prev: d})
+
+		// the previous link of the next leaf is only written by the writers latching the leaf before it
+		if node.Next != nil {
+			l.write(node.Next).Prev = right
+		}
+
+		separator := node.Values[mid].Key
+		node.Values, node.Next = node.Values[:mid], right
+
+		return right, separator
+	}
+
+	separator := node.Mins[mid-1]
+	right := l.create(&Node[K, V]{Mins: slices.Clone(node.Mins[mid:]), Children: slices.Clone(node.Children[mid:])})
+	node.Mins, node.Children = node.Mins[:mid-1], node.Children[:mid]
+
+	return right, separator
+}
+
+// rebalance fixes the underflowing node j of a write-latched path, by moving a child from
+// a sibling or merging with it.
+func (l *Latched[K, V]) rebalance(p *latching[K, V], j int) {
+	t := l.tree
+	parent, i := l.write(p.stack[j-1]), p.indices[j]
+	left, right := i-1, i
+
+	if i == 0 {
+		left, right = 0, 1
+	}
+
+	// the underflowing child is already latched
+	sibling := parent.Children[left]
+
+	if i == 0 {
+		sibling = parent.Children[right]
+	}
+
+	l.latch(sibling).Lock()
+	defer l.latch(sibling).Unlock()
+
+	a, b := l.write(parent.Children[left]), l.write(parent.Children[right])
+
+	switch {
+	case a.Count()+b.Count() <= t.capacity(a.Leaf()):
+		// merge b into a
+		if a.Leaf() {
+			a.Values, a.Next = append(a.Values, b.Values...), b.Next
+
+			if b.Next != nil {
+				l.write(b.Next).Prev = parent.Children[left]
+			}
+		} else {
+			a.Mins = append(append(a.Mins, parent.Mins[left]), b.Mins...)
+			a.Children = append(a.Children, b.Children...)
+		}
+
+		l.remove(p, parent.Children[right])
+		parent.Mins = slices.Delete(parent.Mins, left, left+1)
+		parent.Children = slices.Delete(parent.Children, right, right+1)
+	case a.Count() > t.least(a.Leaf()) && i > 0:
+		// from left to right
+		if a.Leaf() {
+			b.Values = slices.Insert(b.Values, 0, a.Values[len(a.Values)-1])
+			a.Values = a.Values[:len(a.Values)-1]
+			parent.Mins[left] = b.Values[0].Key
+		} else {
+			b.Mins = slices.Insert(b.Mins, 0, parent.Mins[left])
+			b.Children = slices.Insert(b.Children, 0, a.Children[len(a.Children)-1])
+			parent.Mins[left] = a.Mins[len(a.Mins)-1]
+			a.Mins, a.Children = a.Mins[:len(a.Mins)-1], a.Children[:len(a.Children)-1]
+		}
+	default:
+		// from right to left
+		if a.Leaf() {
+			a.Values = append(a.Values, b.Values[0])
+			b.Values = slices.Delete(b.Values, 0, 1)
+			parent.Mins[left] = b.Values[0].Key
+		} else {
+			a.Mins = append(a.Mins, parent.Mins[left])
+			a.Children = append(a.Children, b.Children[0])
+			parent.Mins[left] = b.Mins[0]
+			b.Mins, b.Children = slices.Delete(b.Mins, 0, 1), slices.Delete(b.Children, 0, 1)
+		}
+	}
+}
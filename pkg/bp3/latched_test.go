@@ -0,0 +1,296 @@
+package bp3_test
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestLatched(t *testing.T) {
+	test := func(order int, n int) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.NewLatched[int, int](bp3.WithOrder(order))
+		model := make(map[int]int)
+
+		for i := 0; i < n*4; i++ {
+			k := r.Intn(n)
+
+			if r.Intn(3) == 0 {
+				v, ok := tree.Delete(k)
+
+				if mv, mok := model[k]; ok != mok || v != mv {
+					t.Fatalf("delete %d: %d, %v != %d, %v", k, v, ok, mv, mok)
+				}
+
+				delete(model, k)
+			} else {
+				v, ok := tree.Insert(k, i)
+
+				if mv, mok := model[k]; ok != mok || v != mv {
+					t.Fatalf("insert %d: %d, %v != %d, %v", k, v, ok, mv, mok)
+				}
+
+				model[k] = i
+			}
+
+			if tree.Count() != len(model) {
+				t.Fatalf("count %d != %d", tree.Count(), len(model))
+			}
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("order %d, step %d: %v", order, i, err)
+			}
+		}
+
+		for k := -1; k <= n; k++ {
+			v, ok := tree.Find(k)
+
+			if mv, mok := model[k]; ok != mok || v != mv {
+				t.Fatalf("find %d: %d, %v != %d, %v", k, v, ok, mv, mok)
+			}
+		}
+
+		keys := slices.Sorted(maps.Keys(model))
+
+		for range 50 {
+			from := bp3.RangeValue[int]{Value: r.Intn(n+2) - 1, Closed: r.Intn(2) == 0}
+			to := bp3.RangeValue[int]{Value: r.Intn(n+2) - 1, Closed: r.Intn(2) == 0}
+
+			var got, want []int
+
+			for k, v := range tree.Range(from, to) {
+				if v != model[k] {
+					t.Fatalf("range value of %d: %d != %d", k, v, model[k])
+				}
+
+				got = append(got, k)
+			}
+
+			for _, k := range keys {
+				if (k > from.Value || (k == from.Value && from.Closed)) && (k < to.Value || (k == to.Value && to.Closed)) {
+					want = append(want, k)
+				}
+			}
+
+			if !slices.Equal(got, want) {
+				t.Fatalf("range %v, %v: %v != %v", from, to, got, want)
+			}
+		}
+
+		instance := tree.Instance()
+
+		if instance.Count() != len(model) {
+			t.Fatalf("count %d after conversion", instance.Count())
+		}
+
+		shape(t, instance.Root, order, true)
+
+		if err := instance.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		s := contents(t, instance)
+
+		for i, kv := range s {
+			if kv.Key != keys[i] || kv.Value != model[kv.Key] {
+				t.Fatalf("%d: %v != %d", i, kv, keys[i])
+			}
+
+			if rank := instance.Rank(kv.Key); rank != i {
+				t.Fatalf("rank %d: %d != %d", kv.Key, rank, i)
+			}
+		}
+
+		if len(s) != len(keys) {
+			t.Fatalf("slice %d != %d", len(s), len(keys))
+		}
+
+		for _, k := range keys {
+			if _, ok := instance.Delete(k); !ok {
+				t.Fatalf("delete %d after conversion", k)
+			}
+		}
+	}
+
+	for order := 3; order < 8; order++ {
+		for _, n := range []int{1, 10, 100, 1000} {
+			test(order, n)
+		}
+	}
+}
+
+func TestLatchedStress(t *testing.T) {
+	const workers = 8
+
+	for _, order := range []int{3, 4, 16} {
+		tree := bp3.NewLatched[int, int](bp3.WithOrder(order))
+		models := make([]map[int]int, workers)
+
+		var wg sync.WaitGroup
+
+		for w := 0; w < workers; w++ {
+			models[w] = make(map[int]int)
+			wg.Add(1)
+
+			go func(w int) {
+				defer wg.Done()
+
+				r := rand.New(rand.NewSource(int64(w)))
+				model := models[w]
+
+				// half of the workers share the key space, the others have ranges of their own
+				key := func() int {
+					if w%2 == 0 {
+						return r.Intn(500)*workers + w
+					}
+
+					return 100000*w + r.Intn(500)
+				}
+
+				for i := 0; i < 2000; i++ {
+					k := key()
+
+					if r.Intn(5) < 2 {
+						if _, ok := tree.Delete(k); ok != (model[k] != 0) {
+							t.Errorf("delete %d: %v", k, ok)
+						}
+
+						delete(model, k)
+					} else {
+						tree.Insert(k, k+1)
+						model[k] = k + 1
+					}
+
+					if v, ok := tree.Find(k); v != model[k] || ok != (v != 0) {
+						t.Errorf("find %d: %d, %v", k, v, ok)
+					}
+				}
+			}(w)
+		}
+
+		for w := 0; w < 2; w++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < 20; i++ {
+					prev := -1
+
+					for k, v := range tree.Range(bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 1 << 30, Closed: true}) {
+						if k <= prev || v != k+1 {
+							t.Errorf("%d: %d after %d", k, v, prev)
+						}
+
+						prev = k
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		want := make(map[int]int)
+
+		for _, model := range models {
+			maps.Copy(want, model)
+		}
+
+		if tree.Count() != len(want) {
+			t.Fatalf("count %d != %d", tree.Count(), len(want))
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		instance := tree.Instance()
+		shape(t, instance.Root, order, true)
+
+		if err := instance.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		keys := slices.Sorted(maps.Keys(want))
+		s := contents(t, instance)
+
+		if len(s) != len(keys) {
+			t.Fatalf("slice %d != %d", len(s), len(keys))
+		}
+
+		for i, kv := range s {
+			if kv.Key != keys[i] || kv.Value != want[kv.Key] {
+				t.Fatalf("%d: %v != %d", i, kv, keys[i])
+			}
+		}
+	}
+}
+
+func TestLatch(t *testing.T) {
+	const workers = 4
+
+	tree := bp3.New[int, int](bp3.WithOrder(4))
+
+	for i := range 1000 {
+		tree.Insert(i, i)
+	}
+
+	latched := bp3.Latch(tree)
+
+	var wg sync.WaitGroup
+
+	for w := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// each worker removes its own residue and adds it past the existing keys
+			for i := w; i < 1000; i += workers {
+				latched.Delete(i)
+				latched.Insert(1000+i, i)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := latched.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	instance := latched.Instance()
+
+	if instance != tree || instance.Count() != 1000 {
+		t.Fatalf("count %d", instance.Count())
+	}
+
+	shape(t, instance.Root, 4, true)
+
+	if k, _, _ := instance.First(); k != 1000 || instance.Rank(1500) != 500 {
+		t.Fatalf("first %d, rank %d", k, instance.Rank(1500))
+	}
+}
+
+func TestLatchedOptions(t *testing.T) {
+	for _, option := range []bp3.Option{bp3.WithDuplicates(), bp3.WithCopyOnWrite(), bp3.WithMonoid(sum), bp3.WithClock(time.Now)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("unsupported option accepted")
+				}
+			}()
+
+			bp3.NewLatched[int, int](option)
+		}()
+	}
+}
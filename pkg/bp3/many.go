@@ -0,0 +1,149 @@
+package bp3
+
+import (
+	"iter"
+	"slices"
+)
+
+// FindMany returns a sequence of the given keys that are found in the B+ Tree and their values, in the
+// order of the keys. In duplicates mode, it returns the value of the first pair with an equal key.
+// The path from the root to the leaf of the previous key is kept, and each key climbs it only as far as
+// needed, so that keys given in ascending order are looked up without descending from the root each time.
+// The sequence panics with ErrConcurrentModification if the instance is modified while it is being
+// consumed, unless the instance has tolerant sequences, in which case the following key is looked up
+// from the root.
+func (t *Instance[K, V]) FindMany(keys iter.Seq[K]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var p path[K, V]
+		var leaf NodeDescriptor[K, V]
+
+		version, root := t.Version, t.Root
+
+		for key := range keys {
+			if t.Version != version || t.Root != root {
+				if t.Version != version && !t.Tolerant {
+					panic(ErrConcurrentModification)
+				}
+
+				// a copy-on-write instance replaces the nodes on the path to a written value
+				p, leaf = nil, nil
+				version, root = t.Version, t.Root
+			}
+
+			var i int
+
+			if p, leaf, i = t.retrace(p, leaf, key, false); leaf == nil {
+				return
+			}
+
+			node := leaf
+
+			if t.Duplicates && i == len(node.Read().Values) {
+				// a run of equal keys may start at the following leaf
+				q := slices.Clone(p)
+
+				if next := q.next(); next != nil {
+					node, i = next, 0
+				}
+			}
+
+			if i == len(node.Read().Values) || t.compare(node.Read().Values[i].Key, key) != 0 {
+				continue
+			}
+
+			if kv := node.Read().Values[i]; !t.expired(node.Read(), i) && !yield(key, kv.Value) {
+				return
+			}
+		}
+	}
+}
+
+// RangeMany returns a sequence of the key-value pairs within any of the specified ranges, in ascending
+// order. The ranges are sorted and the overlapping ones are merged, and the leaves are walked once,
+// forward, climbing the path from the root only to skip the gaps between the ranges. The sequence
+// panics with ErrConcurrentModification if the instance is modified while it is being consumed,
+// even if the instance has tolerant sequences.
+func (t *Instance[K, V]) RangeMany(ranges []struct{ From, To RangeValue[K] }) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var p path[K, V]
+		var leaf NodeDescriptor[K, V]
+
+		version := t.Version
+
+		for _, r := range t.merge(ranges) {
+			var i int
+
+			if p, leaf, i = t.retrace(p, leaf, r.From.Value, !r.From.Closed); leaf == nil {
+				return
+			}
+
+			for {
+				values := leaf.Read().Values
+
+				if i == len(values) {
+					// the path is kept for the next range, so the leaves are not followed by their links
+					if leaf, i = p.next(), 0; leaf == nil {
+						return
+					}
+
+					continue
+				}
+
+				kv, expired := values[i], t.expired(leaf.Read(), i)
+				i++
+
+				if t.after(kv.Key, r.To) {
+					break
+				}
+
+				if !expired && !yield(kv.Key, kv.Value) {
+					return
+				}
+
+				t.check(version)
+			}
+		}
+	}
+}
+
+// merge returns the non-empty ranges sorted by their lower bounds, with the overlapping ones merged.
+func (t *Instance[K, V]) merge(ranges []struct{ From, To RangeValue[K] }) []struct{ From, To RangeValue[K] } {
+	var merged []struct{ From, To RangeValue[K] }
+
+	for _, r := range ranges {
+		if c := t.compare(r.To.Value, r.From.Value); c > 0 || (c == 0 && r.From.Closed && r.To.Closed) {
+			merged = append(merged, r)
+		}
+	}
+
+	slices.SortFunc(merged, func(a, b struct{ From, To RangeValue[K] }) int {
+		if c := t.compare(a.From.Value, b.From.Value); c != 0 || a.From.Closed == b.From.Closed {
+			return c
+		} else if a.From.Closed {
+			return -1
+		}
+
+		return 1
+	})
+
+	n := 0
+
+	for _, r := range merged {
+		if n > 0 {
+			last := &merged[n-1]
+
+			if c := t.compare(r.From.Value, last.To.Value); c < 0 || (c == 0 && (r.From.Closed || last.To.Closed)) {
+				if c := t.compare(r.To.Value, last.To.Value); c > 0 || (c == 0 && r.To.Closed) {
+					last.To = r.To
+				}
+
+				continue
+			}
+		}
+
+		merged[n] = r
+		n++
+	}
+
+	return merged[:n]
+}
@@ -0,0 +1,188 @@
+package bp3_test
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestFindMany(t *testing.T) {
+	test := func(order int, options ...bp3.Option) {
+		r := rand.New(rand.NewSource(int64(order)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order))...)
+
+		for _, i := range r.Perm(1000) {
+			tree.Insert(3*i, i)
+		}
+
+		check := func(keys []int) {
+			var want []int
+
+			for _, k := range keys {
+				if v, found := tree.Find(k); found {
+					want = append(want, k, v)
+				}
+			}
+
+			var got []int
+
+			for k, v := range tree.FindMany(slices.Values(keys)) {
+				got = append(got, k, v)
+			}
+
+			if !slices.Equal(got, want) {
+				t.Fatalf("order %d: got %v, expected %v", order, got, want)
+			}
+		}
+
+		keys := make([]int, 2000)
+
+		for i := range keys {
+			keys[i] = r.Intn(3100) - 50
+		}
+
+		check(keys)
+
+		slices.Sort(keys)
+		check(keys)
+
+		slices.Reverse(keys)
+		check(keys)
+
+		check(nil)
+	}
+
+	for _, order := range []int{3, 4, 5, 8, 33} {
+		test(order)
+		test(order, bp3.WithCopyOnWrite())
+		test(order, bp3.WithMonoid(sum))
+	}
+}
+
+func TestFindManyDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := range 300 {
+		tree.Insert(i%20, i)
+	}
+
+	var got []int
+
+	for _, v := range tree.FindMany(slices.Values([]int{-1, 0, 0, 5, 7, 19, 20})) {
+		got = append(got, v)
+	}
+
+	if want := []int{0, 0, 5, 7, 19}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
+
+func TestFindManyModified(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+
+	for i := range 100 {
+		tree.Insert(i, i)
+	}
+
+	modified(t, func() {
+		for k := range tree.FindMany(slices.Values([]int{1, 2, 3})) {
+			tree.Delete(k + 1)
+		}
+	})
+
+	tree.Tolerant = true
+
+	var got []int
+
+	for k := range tree.FindMany(slices.Values([]int{10, 11, 12, 13, 14})) {
+		got = append(got, k)
+		tree.Delete(k + 1)
+	}
+
+	if want := []int{10, 12, 14}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
+
+func TestRangeMany(t *testing.T) {
+	type span = struct{ From, To bp3.RangeValue[int] }
+
+	test := func(order int, options ...bp3.Option) {
+		r := rand.New(rand.NewSource(int64(order)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order))...)
+
+		for _, i := range r.Perm(1000) {
+			tree.Insert(2*i, i)
+		}
+
+		for range 50 {
+			ranges := make([]span, r.Intn(8))
+
+			for i := range ranges {
+				from := r.Intn(2100) - 50
+
+				ranges[i] = span{
+					From: bp3.RangeValue[int]{Value: from, Closed: r.Intn(2) == 0},
+					To:   bp3.RangeValue[int]{Value: from + r.Intn(200) - 10, Closed: r.Intn(2) == 0},
+				}
+			}
+
+			var want []int
+
+			for k := range tree.FromClosed(-100) {
+				for _, s := range ranges {
+					if (k > s.From.Value || (k == s.From.Value && s.From.Closed)) && (k < s.To.Value || (k == s.To.Value && s.To.Closed)) {
+						want = append(want, k)
+						break
+					}
+				}
+			}
+
+			var got []int
+
+			for k := range tree.RangeMany(ranges) {
+				got = append(got, k)
+			}
+
+			if !slices.Equal(got, want) {
+				t.Fatalf("order %d, ranges %v: got %v, expected %v", order, ranges, got, want)
+			}
+		}
+	}
+
+	for _, order := range []int{3, 4, 5, 8, 33} {
+		test(order)
+		test(order, bp3.WithCopyOnWrite())
+	}
+}
+
+func TestRangeManyDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := range 100 {
+		tree.Insert(i%10, i)
+	}
+
+	var got []int
+
+	for k := range tree.RangeMany([]struct{ From, To bp3.RangeValue[int] }{
+		{From: bp3.RangeValue[int]{Value: 7, Closed: true}, To: bp3.RangeValue[int]{Value: 7, Closed: true}},
+		{From: bp3.RangeValue[int]{Value: 2, Closed: false}, To: bp3.RangeValue[int]{Value: 4, Closed: true}},
+	}) {
+		got = append(got, k)
+	}
+
+	var want []int
+
+	for _, k := range []int{3, 4, 7} {
+		for range 10 {
+			want = append(want, k)
+		}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
@@ -1,11 +1,14 @@
 package bp3
 
 import (
+	"cmp"
+
 	"golang.org/x/exp/constraints"
 )
 
-type memoryNodeDescriptor[K constraints.Ordered, V any] struct {
-	node *Node[K, V]
+type memoryNodeDescriptor[K any, V any] struct {
+	node  *Node[K, V]
+	owner *memoryBuilder[K, V]
 }
 
 func (d *memoryNodeDescriptor[K, V]) Read() *Node[K, V] {
@@ -13,13 +16,40 @@ func (d *memoryNodeDescriptor[K, V]) Read() *Node[K, V] {
 }
 
 func (d *memoryNodeDescriptor[K, V]) Write() *Node[K, V] {
+	if d.owner.Active() {
+		d.owner.Record(d, func() func() {
+			image := d.node.Clone()
+
+			return func() {
+				*d.node = *image
+			}
+		})
+	}
+
 	return d.node
 }
 
-type memoryBuilder[K constraints.Ordered, V any] struct{}
+// memoryBuilder creates nodes in memory. In copy-on-write mode, each instance has its own
+// builder, and the nodes created by other builders are shared and copied before being written.
+// In a transaction, the journal keeps the nodes as they were before being written.
+type memoryBuilder[K any, V any] struct {
+	Journal
+	readOnly bool
+}
+
+func (b *memoryBuilder[K, V]) Create(node *Node[K, V]) NodeDescriptor[K, V] {
+	if b.readOnly {
+		panic("bp3: read-only snapshot")
+	}
+
+	d := &memoryNodeDescriptor[K, V]{node: node, owner: b}
 
-func (*memoryBuilder[K, V]) Create(node *Node[K, V]) NodeDescriptor[K, V] {
-	return &memoryNodeDescriptor[K, V]{node}
+	// a new node is not reachable once its creation is undone, there is nothing to restore
+	b.Record(d, func() func() {
+		return func() {}
+	})
+
+	return d
 }
 
 func (*memoryBuilder[K, V]) Update(d NodeDescriptor[K, V]) {}
@@ -30,20 +60,73 @@ func (*memoryBuilder[K, V]) Flush() error {
 	return nil
 }
 
+func (b *memoryBuilder[K, V]) Own(d NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+	if b.readOnly {
+		panic("bp3: read-only snapshot")
+	}
+
+	if md := d.(*memoryNodeDescriptor[K, V]); md.owner != b {
+		return b.Create(clone(md.node))
+	}
+
+	return d
+}
+
+func (*memoryBuilder[K, V]) Fork(readOnly bool) NodeBuilder[K, V] {
+	return &memoryBuilder[K, V]{readOnly: readOnly}
+}
+
 // New creates a new instance of b+tree structure with the specified options.
 func New[K constraints.Ordered, V any](options ...Option) *Instance[K, V] {
+	return NewFunc[K, V](cmp.Compare[K], options...)
+}
+
+// NewFunc creates a new instance of b+tree structure with the specified options,
+// where keys are ordered by the given compare function. The function must return
+// a negative number when a < b, a positive number when a > b and zero when a == b.
+// If it is nil, the keys are in their natural order, and NewFunc panics with ErrUnordered
+// if K has none, see NaturalOrder.
+func NewFunc[K any, V any](compare func(a, b K) int, options ...Option) *Instance[K, V] {
+	if compare == nil {
+		compare = natural[K]()
+	}
+
 	opts := buildOptions(options...)
-	order := max(opts.order, MinOrder)
-	return &Instance[K, V]{Order: order, Builder: &memoryBuilder[K, V]{}}
+	return &Instance[K, V]{
+		Order:        opts.internalOrder(),
+		LeafCapacity: opts.leafCapacity(),
+		Compare:      compare,
+		Duplicates:   opts.duplicates,
+		CopyOnWrite:  opts.copyOnWrite,
+		Builder:      &memoryBuilder[K, V]{},
+		Aggregator:   aggregatorOf[K, V](opts),
+		Clock:        opts.clock,
+		Tolerant:     opts.tolerant,
+	}
 }
 
 // Clear removes all key-value pairs from the B+ Tree, resetting its state.
-func Clear[K constraints.Ordered, V any](tree *Instance[K, V]) {
+func Clear[K any, V any](tree *Instance[K, V]) {
 	if _, ok := tree.Builder.(*memoryBuilder[K, V]); !ok {
 		panic("bp3: invalid tree instance")
 	}
 
+	var removed []KeyValue[K, V]
+
+	if tree.observed() {
+		removed = Slice(tree.Root)
+	}
+
 	tree.Root = nil
 	tree.Min = *new(K)
 	tree.Size = 0
+	tree.Version++
+
+	if tree.Expiry != nil {
+		Clear(tree.Expiry)
+	}
+
+	for _, kv := range removed {
+		tree.deleted(kv)
+	}
 }
@@ -2,10 +2,15 @@ package bp3_test
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"iter"
+	"math"
+	"math/rand"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/moshenahmias/bp3/pkg/bp3"
 	"golang.org/x/exp/constraints"
@@ -94,6 +99,129 @@ func TestDelete(t *testing.T) {
 	test(3, 1, map[int]bool{0: true})
 }
 
+func TestInsertOverwrite(t *testing.T) {
+	test := func(order int, n int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			if _, found := tree.Insert(i, fmt.Sprint(i)); found {
+				t.Fatalf("%d found before insert", i)
+			}
+		}
+
+		for i := 0; i < n; i += 2 {
+			if old, found := tree.Insert(i, "x"); !found || old != fmt.Sprint(i) {
+				t.Fatalf("%d: %s, %v", i, old, found)
+			}
+		}
+
+		if size := tree.Count(); size != n {
+			t.Fatalf("size %d != %d", size, n)
+		}
+
+		for i := 0; i < n; i++ {
+			if v, _ := tree.Find(i); (i%2 == 0) != (v == "x") {
+				t.Fatalf("%d: %s", i, v)
+			}
+		}
+	}
+
+	test(3, 100)
+	test(10, 1000)
+	test(15, 10000)
+}
+
+func TestInsertIfAbsent(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		if inserted := tree.InsertIfAbsent(i, "x"); inserted != (i%2 == 1) {
+			t.Fatalf("%d inserted %v", i, inserted)
+		}
+	}
+
+	if size := tree.Count(); size != 100 {
+		t.Fatalf("size %d != %d", size, 100)
+	}
+
+	for i := 0; i < 100; i++ {
+		if v, _ := tree.Find(i); (i%2 == 1) != (v == "x") {
+			t.Fatalf("%d: %s", i, v)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		if old, replaced := tree.Replace(i, "x"); replaced != (i%2 == 0) || (replaced && old != fmt.Sprint(i)) {
+			t.Fatalf("%d: %s, %v", i, old, replaced)
+		}
+	}
+
+	if size := tree.Count(); size != 50 {
+		t.Fatalf("size %d != %d", size, 50)
+	}
+
+	if _, found := tree.Find(1); found {
+		t.Fatal("1 should not be found")
+	}
+
+	empty := bp3.New[int, string]()
+
+	if _, replaced := empty.Replace(1, "1"); replaced || !empty.Empty() {
+		t.Fatal("replaced in an empty tree")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tree := bp3.New[string, int](bp3.WithOrder(3))
+	words := strings.Fields("a b c a b a d e f g a h i j k l m n o p")
+
+	for _, w := range words {
+		tree.Update(w, func(old int, _ bool) (int, bool) {
+			return old + 1, true
+		})
+	}
+
+	if size := tree.Count(); size != 16 {
+		t.Fatalf("size %d != %d", size, 16)
+	}
+
+	if v, _ := tree.Find("a"); v != 4 {
+		t.Fatalf("a: %d", v)
+	}
+
+	if v, ok := tree.Update("b", func(old int, ok bool) (int, bool) {
+		return old - 2, old > 2
+	}); ok || v != 0 {
+		t.Fatalf("b: %d, %v", v, ok)
+	}
+
+	if _, found := tree.Find("b"); found {
+		t.Fatal("b should be removed")
+	}
+
+	if _, ok := tree.Update("z", func(old int, ok bool) (int, bool) {
+		return 1, ok
+	}); ok {
+		t.Fatal("z should not be added")
+	}
+
+	if size := tree.Count(); size != 15 {
+		t.Fatalf("size %d != %d", size, 15)
+	}
+}
+
 func TestRangeClosed(t *testing.T) {
 	test := func(order int, n int, from, to int) {
 		tree := bp3.New[int, string](bp3.WithOrder(order))
@@ -345,6 +473,1048 @@ func TestToOpened(t *testing.T) {
 	test(15, 10000, 500)
 }
 
+func TestRangeReverse(t *testing.T) {
+	test := func(order int, n int, from, to bp3.RangeValue[int]) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		s := slices.Collect(SeqFirst(tree.RangeReverse(from, to)))
+		master := slices.Collect(SeqFirst(tree.Range(from, to)))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+	}
+
+	for _, closed := range [][2]bool{{true, true}, {false, false}, {false, true}, {true, false}} {
+		test(3, 100, bp3.RangeValue[int]{3, closed[0]}, bp3.RangeValue[int]{50, closed[1]})
+		test(10, 1000, bp3.RangeValue[int]{100, closed[0]}, bp3.RangeValue[int]{700, closed[1]})
+		test(15, 10000, bp3.RangeValue[int]{500, closed[0]}, bp3.RangeValue[int]{2005, closed[1]})
+		test(3, 100, bp3.RangeValue[int]{-10, closed[0]}, bp3.RangeValue[int]{200, closed[1]})
+		test(3, 100, bp3.RangeValue[int]{50, closed[0]}, bp3.RangeValue[int]{50, closed[1]})
+	}
+}
+
+func TestRangeReverseClosed(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	for i := 20; i < 30; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	for i := 31; i < 50; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	s := slices.Collect(SeqFirst(tree.RangeReverseClosed(10, 30)))
+	master := slices.Collect(Range_(20, 30))
+	slices.Reverse(master)
+
+	if slices.Compare(s, master) != 0 {
+		t.Fatalf("%v, %v", s, master)
+	}
+}
+
+func TestFromReverse(t *testing.T) {
+	test := func(order int, n int, from int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		s := slices.Collect(SeqFirst(tree.FromReverseClosed(from)))
+		master := slices.Collect(Range_(from, n))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+
+		s = slices.Collect(SeqFirst(tree.FromReverseOpened(from)))
+		master = slices.Collect(Range_(from+1, n))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+	}
+
+	test(3, 100, 3)
+	test(10, 1000, 100)
+	test(15, 10000, 500)
+}
+
+func TestToReverse(t *testing.T) {
+	test := func(order int, n int, to int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		s := slices.Collect(SeqFirst(tree.ToReverseClosed(to)))
+		master := slices.Collect(Range_(0, min(to+1, n)))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+
+		s = slices.Collect(SeqFirst(tree.ToReverseOpened(to)))
+		master = slices.Collect(Range_(0, min(to, n)))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+	}
+
+	test(3, 100, 3)
+	test(3, 100, 0)
+	test(3, 100, 200)
+	test(10, 1000, 100)
+	test(15, 10000, 500)
+}
+
+func TestBackward(t *testing.T) {
+	test := func(order int, n int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		s := slices.Collect(SeqFirst(tree.Backward()))
+		master := slices.Collect(Range_(0, n))
+		slices.Reverse(master)
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+	}
+
+	test(3, 0)
+	test(3, 100)
+	test(10, 1000)
+	test(15, 10000)
+}
+
+func TestNewFunc(t *testing.T) {
+	tree := bp3.NewFunc[string, int](func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}, bp3.WithOrder(3))
+
+	words := []string{"delta", "Alpha", "charlie", "Echo", "bravo", "Foxtrot", "golf"}
+
+	for i, w := range words {
+		tree.Insert(w, i)
+	}
+
+	if v, found := tree.Find("ALPHA"); !found || v != 1 {
+		t.Fatalf("ALPHA: %d, %v", v, found)
+	}
+
+	s := slices.Collect(SeqFirst(tree.RangeClosed("b", "E")))
+	master := []string{"bravo", "charlie", "delta"}
+
+	if slices.Compare(s, master) != 0 {
+		t.Fatalf("%v, %v", s, master)
+	}
+
+	if _, deleted := tree.Delete("CHARLIE"); !deleted {
+		t.Fatal("failed to delete CHARLIE")
+	}
+
+	s = slices.Collect(SeqFirst(tree.RangeReverseClosed("b", "e")))
+	master = []string{"delta", "bravo"}
+
+	if slices.Compare(s, master) != 0 {
+		t.Fatalf("%v, %v", s, master)
+	}
+}
+
+func TestNewFuncTime(t *testing.T) {
+	test := func(order int, n int) {
+		tree := bp3.NewFunc[time.Time, int](time.Time.Compare, bp3.WithOrder(order))
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for i := n - 1; i >= 0; i-- {
+			tree.Insert(start.Add(time.Duration(i)*time.Minute), i)
+		}
+
+		for i := 0; i < n; i += 2 {
+			if _, deleted := tree.Delete(start.Add(time.Duration(i) * time.Minute)); !deleted {
+				t.Fatalf("failed to delete %d", i)
+			}
+		}
+
+		s := slices.Collect(SeqSecond(tree.RangeClosed(start, start.Add(time.Duration(n)*time.Minute))))
+		master := slices.Collect(Range_(0, n/2))
+
+		for i := range master {
+			master[i] = master[i]*2 + 1
+		}
+
+		if slices.Compare(s, master) != 0 {
+			t.Fatalf("%v, %v", s, master)
+		}
+	}
+
+	test(3, 100)
+	test(10, 1000)
+}
+
+func TestNaturalOrder(t *testing.T) {
+	type level int8
+	type name string
+
+	levels := bp3.NewFunc[level, int](nil, bp3.WithOrder(3))
+
+	for i := 100; i >= -100; i-- {
+		levels.Insert(level(i), i)
+	}
+
+	if k, _, _ := levels.First(); k != -100 {
+		t.Fatalf("first %d", k)
+	}
+
+	if err := levels.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an instance that was not created by a constructor orders its keys naturally
+	names := &bp3.Instance[name, int]{Order: 3, Builder: bp3.New[name, int]().Builder}
+
+	for i, n := range []name{"delta", "alpha", "charlie", "bravo"} {
+		names.Insert(n, i)
+	}
+
+	if s := slices.Collect(SeqFirst(names.FromClosed(""))); !slices.Equal(s, []name{"alpha", "bravo", "charlie", "delta"}) {
+		t.Fatalf("%v", s)
+	}
+
+	if _, err := bp3.NaturalOrder[struct{ a int }](); !errors.Is(err, bp3.ErrUnordered) {
+		t.Fatal(err)
+	}
+
+	if _, err := bp3.BulkLoadFunc[time.Time, int](nil, nil); !errors.Is(err, bp3.ErrUnordered) {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if r := recover(); r != bp3.ErrUnordered {
+			t.Fatalf("recovered %v", r)
+		}
+	}()
+
+	bp3.NewFunc[time.Time, int](nil)
+}
+
+func TestBulkLoad(t *testing.T) {
+	test := func(order int, n int, fill float64) {
+		seq := func(yield func(int, string) bool) {
+			for i := 0; i < n; i++ {
+				if !yield(i*2, fmt.Sprint(i*2)) {
+					return
+				}
+			}
+		}
+
+		tree, err := bp3.BulkLoad(seq, bp3.WithOrder(order), bp3.WithFillFactor(fill))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size := tree.Size; size != n {
+			t.Fatalf("size %d != %d", size, n)
+		}
+
+		shape(t, tree.Root, order, true)
+
+		master := slices.Collect(Range_(0, n))
+
+		for i := range master {
+			master[i] *= 2
+		}
+
+		for _, s := range [][]bp3.KeyValue[int, string]{bp3.Slice(tree.Root), slice(tree.Root)} {
+			if slices.CompareFunc(s, master, func(kv bp3.KeyValue[int, string], x int) int {
+				return cmp.Compare(kv.Key, x)
+			}) != 0 {
+				t.Fatalf("%v, %v", s, master)
+			}
+		}
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i*2+1, fmt.Sprint(i*2+1))
+		}
+
+		for i := 0; i < n; i += 3 {
+			if _, deleted := tree.Delete(i); !deleted {
+				t.Fatalf("failed to delete %d", i)
+			}
+		}
+
+		shape(t, tree.Root, order, true)
+
+		for i := 0; i < 2*n; i++ {
+			if _, found := tree.Find(i); found == (i%3 == 0 && i < n) {
+				t.Fatalf("%d found %v", i, found)
+			}
+		}
+	}
+
+	for n := range 100 {
+		test(3, n, 1)
+		test(4, n, 0.5)
+		test(5, n, 0.8)
+	}
+
+	test(3, 100, 1)
+	test(4, 100, 0.5)
+	test(10, 1000, 0.7)
+	test(10, 6, 0.5)
+	test(15, 10000, 1)
+}
+
+func TestBulkLoadUnsorted(t *testing.T) {
+	seq := func(yield func(int, string) bool) {
+		_ = yield(1, "1") && yield(3, "3") && yield(2, "2")
+	}
+
+	if _, err := bp3.BulkLoad(seq); !errors.Is(err, bp3.ErrUnsorted) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	seq = func(yield func(int, string) bool) {
+		_ = yield(1, "1") && yield(2, "2") && yield(2, "2")
+	}
+
+	if _, err := bp3.BulkLoad(seq); !errors.Is(err, bp3.ErrDuplicateKey) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tree := bp3.New[int, string]()
+	tree.Insert(1, "1")
+
+	if err := tree.Build(seq, 1); !errors.Is(err, bp3.ErrNotEmpty) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// shape verifies that all leaves are at the same depth, that every node, except
+// for the root, holds between half and all of the order, and that the subtree counts are correct.
+func shape[K constraints.Ordered, V any](t *testing.T, root bp3.NodeDescriptor[K, V], order int, isRoot bool) int {
+	t.Helper()
+
+	if root == nil {
+		return 0
+	}
+
+	node := root.Read()
+	count := node.Count()
+
+	if count > order || (!isRoot && count < (order+1)/2) {
+		t.Fatalf("node with %d children, order %d", count, order)
+	}
+
+	if node.Leaf() {
+		return 1
+	}
+
+	depth := -1
+
+	for i, child := range node.Children {
+		if n := len(slice(child)); node.Counts[i] != n {
+			t.Fatalf("child count %d != %d", node.Counts[i], n)
+		}
+
+		if d := shape(t, child, order, false); depth >= 0 && d != depth {
+			t.Fatalf("leaves at depths %d and %d", d+1, depth+1)
+		} else {
+			depth = d
+		}
+	}
+
+	return depth + 1
+}
+
+func TestRankAt(t *testing.T) {
+	test := func(order int, n int, del int) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for _, i := range r.Perm(n) {
+			tree.Insert(i*2, fmt.Sprint(i*2))
+		}
+
+		for _, i := range r.Perm(n)[:del] {
+			tree.Delete(i * 2)
+		}
+
+		shape(t, tree.Root, order, true)
+
+		s := bp3.Slice(tree.Root)
+
+		for i, kv := range s {
+			if rank := tree.Rank(kv.Key); rank != i {
+				t.Fatalf("rank %d: %d != %d", kv.Key, rank, i)
+			}
+
+			if rank := tree.Rank(kv.Key + 1); rank != i+1 {
+				t.Fatalf("rank %d: %d != %d", kv.Key+1, rank, i+1)
+			}
+
+			if k, v, ok := tree.At(i); !ok || k != kv.Key || v != kv.Value {
+				t.Fatalf("at %d: %d, %s, %v", i, k, v, ok)
+			}
+		}
+
+		if _, _, ok := tree.At(len(s)); ok {
+			t.Fatalf("at %d is out of range", len(s))
+		}
+
+		if _, _, ok := tree.At(-1); ok {
+			t.Fatal("at -1 is out of range")
+		}
+
+		for range 100 {
+			from := bp3.RangeValue[int]{Value: r.Intn(n*2+2) - 1, Closed: r.Intn(2) == 0}
+			to := bp3.RangeValue[int]{Value: r.Intn(n*2+2) - 1, Closed: r.Intn(2) == 0}
+
+			count := 0
+
+			for range tree.Range(from, to) {
+				count++
+			}
+
+			if c := tree.CountRange(from, to); c != count {
+				t.Fatalf("count %v-%v: %d != %d", from, to, c, count)
+			}
+		}
+	}
+
+	test(3, 0, 0)
+	test(3, 1, 0)
+	test(3, 100, 50)
+	test(4, 500, 400)
+	test(10, 1000, 300)
+	test(15, 10000, 5000)
+}
+
+func TestRankDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := 0; i < 300; i++ {
+		tree.Insert(i%10, i)
+	}
+
+	for k := 0; k < 10; k++ {
+		if rank := tree.Rank(k); rank != k*30 {
+			t.Fatalf("rank %d: %d != %d", k, rank, k*30)
+		}
+
+		if c := tree.CountRange(bp3.RangeValue[int]{Value: k, Closed: true}, bp3.RangeValue[int]{Value: k, Closed: true}); c != 30 {
+			t.Fatalf("count %d: %d != %d", k, c, 30)
+		}
+	}
+
+	if key, _, _ := tree.At(151); key != 5 {
+		t.Fatalf("at 151: %d", key)
+	}
+}
+
+func TestNeighbours(t *testing.T) {
+	test := func(order int, n int) {
+		tree := bp3.New[int, string](bp3.WithOrder(order))
+
+		for _, i := range rand.New(rand.NewSource(int64(order * n))).Perm(n) {
+			tree.Insert(i*2, fmt.Sprint(i*2))
+		}
+
+		check := func(name string, k int, v string, ok bool, want int) {
+			if valid := want >= 0 && want < n*2; ok != valid || (ok && (k != want || v != fmt.Sprint(want))) {
+				t.Fatalf("%s: %d, %s, %v (want %d)", name, k, v, ok, want)
+			}
+		}
+
+		for key := -1; key <= n*2; key++ {
+			floor, ceiling := key-key%2, key+key%2
+
+			if key < 0 {
+				floor, ceiling = -2, 0
+			}
+
+			floor = min(floor, (n-1)*2)
+
+			k, v, ok := tree.Floor(key)
+			check(fmt.Sprint("floor ", key), k, v, ok, floor)
+
+			k, v, ok = tree.Ceiling(key)
+			check(fmt.Sprint("ceiling ", key), k, v, ok, ceiling)
+
+			if floor == key {
+				floor -= 2
+			}
+
+			if ceiling == key {
+				ceiling += 2
+			}
+
+			k, v, ok = tree.Lower(key)
+			check(fmt.Sprint("lower ", key), k, v, ok, floor)
+
+			k, v, ok = tree.Higher(key)
+			check(fmt.Sprint("higher ", key), k, v, ok, ceiling)
+		}
+	}
+
+	test(3, 0)
+	test(3, 1)
+	test(3, 100)
+	test(4, 500)
+	test(10, 1000)
+}
+
+func TestNearest(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	for _, i := range []int{1, 4, 6, 10, 15, 16, 30} {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	distance := func(a, b int) float64 {
+		return math.Abs(float64(a - b))
+	}
+
+	var keys []int
+
+	for k, v := range tree.Nearest(11, 5, distance) {
+		if v != fmt.Sprint(k) {
+			t.Fatalf("nearest %d: %s", k, v)
+		}
+
+		keys = append(keys, k)
+	}
+
+	if expected := []int{10, 15, 16, 6, 4}; !slices.Equal(keys, expected) {
+		t.Fatalf("nearest: %v != %v", keys, expected)
+	}
+
+	keys = keys[:0]
+
+	for k := range tree.Nearest(0, 100, distance) {
+		keys = append(keys, k)
+	}
+
+	if expected := []int{1, 4, 6, 10, 15, 16, 30}; !slices.Equal(keys, expected) {
+		t.Fatalf("nearest: %v != %v", keys, expected)
+	}
+
+	for range tree.Nearest(5, 0, distance) {
+		t.Fatal("nearest with n = 0")
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	tree := bp3.New[int, string](bp3.WithOrder(3))
+
+	if _, _, ok := tree.First(); ok {
+		t.Fatal("first of an empty tree")
+	}
+
+	if _, _, ok := tree.Last(); ok {
+		t.Fatal("last of an empty tree")
+	}
+
+	for i := 0; i < 50; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	if k, v, ok := tree.First(); !ok || k != 0 || v != "0" {
+		t.Fatalf("first: %d, %s, %v", k, v, ok)
+	}
+
+	if k, v, ok := tree.Last(); !ok || k != 49 || v != "49" {
+		t.Fatalf("last: %d, %s, %v", k, v, ok)
+	}
+}
+
+func TestPop(t *testing.T) {
+	test := func(order int, n int, duplicates bool) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+
+		options := []bp3.Option{bp3.WithOrder(order)}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.New[int, int](options...)
+
+		var master []int
+
+		for _, i := range r.Perm(n) {
+			if duplicates {
+				i /= 3
+			}
+
+			tree.Insert(i, i)
+			master = append(master, i)
+		}
+
+		slices.Sort(master)
+
+		for len(master) > 0 {
+			var k, v int
+			var ok bool
+
+			switch r.Intn(3) {
+			case 0:
+				k, v, ok = tree.PopMin()
+
+				if !ok || k != master[0] || v != k {
+					t.Fatalf("pop min: %d, %d, %v != %d", k, v, ok, master[0])
+				}
+
+				master = master[1:]
+			case 1:
+				k, v, ok = tree.PopMax()
+
+				if !ok || k != master[len(master)-1] || v != k {
+					t.Fatalf("pop max: %d, %d, %v != %d", k, v, ok, master[len(master)-1])
+				}
+
+				master = master[:len(master)-1]
+			default:
+				c := r.Intn(5)
+				s := tree.PopMinN(c)
+				c = min(c, len(master))
+
+				if len(s) != c {
+					t.Fatalf("pop min %d: %d", c, len(s))
+				}
+
+				for i, kv := range s {
+					if kv.Key != master[i] || kv.Value != kv.Key {
+						t.Fatalf("pop min %d: %v != %d", i, kv, master[i])
+					}
+				}
+
+				master = master[c:]
+			}
+
+			if tree.Count() != len(master) {
+				t.Fatalf("count %d != %d", tree.Count(), len(master))
+			}
+
+			shape(t, tree.Root, order, true)
+		}
+
+		if _, _, ok := tree.PopMin(); ok {
+			t.Fatal("pop min of an empty tree")
+		}
+
+		if _, _, ok := tree.PopMax(); ok {
+			t.Fatal("pop max of an empty tree")
+		}
+
+		if s := tree.PopMinN(3); len(s) != 0 {
+			t.Fatalf("pop min of an empty tree: %v", s)
+		}
+	}
+
+	test(3, 0, false)
+	test(3, 1, false)
+	test(3, 100, false)
+	test(4, 500, true)
+	test(10, 1000, false)
+	test(15, 3000, true)
+}
+
+func TestDeleteRangeRandom(t *testing.T) {
+	test := func(order int, n int, duplicates bool) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+
+		options := []bp3.Option{bp3.WithOrder(order)}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.New[int, int](options...)
+
+		var master []int
+
+		for _, i := range r.Perm(n) {
+			if duplicates {
+				i /= 3
+			}
+
+			tree.Insert(i, i)
+			master = append(master, i)
+		}
+
+		slices.Sort(master)
+
+		for len(master) > 0 {
+			from := bp3.RangeValue[int]{Value: r.Intn(n+2) - 1, Closed: r.Intn(2) == 0}
+			to := bp3.RangeValue[int]{Value: from.Value + r.Intn(n/4+2), Closed: r.Intn(2) == 0}
+
+			var rest []int
+
+			for _, k := range master {
+				if (k < from.Value || (k == from.Value && !from.Closed)) || (k > to.Value || (k == to.Value && !to.Closed)) {
+					rest = append(rest, k)
+				}
+			}
+
+			if c := tree.DeleteRange(from, to); c != len(master)-len(rest) {
+				t.Fatalf("delete range %v-%v: %d != %d", from, to, c, len(master)-len(rest))
+			}
+
+			master = rest
+
+			if tree.Count() != len(master) {
+				t.Fatalf("count %d != %d", tree.Count(), len(master))
+			}
+
+			shape(t, tree.Root, order, true)
+
+			var s []int
+
+			for _, kv := range bp3.Slice(tree.Root) {
+				s = append(s, kv.Key)
+			}
+
+			if !slices.Equal(s, master) {
+				t.Fatalf("%v != %v", s, master)
+			}
+
+			s = s[:0]
+
+			for k := range tree.Backward() {
+				s = append(s, k)
+			}
+
+			slices.Reverse(s)
+
+			if !slices.Equal(s, master) {
+				t.Fatalf("backward %v != %v", s, master)
+			}
+
+			for _, k := range master {
+				if v, ok := tree.Find(k); !ok || v != k {
+					t.Fatalf("find %d: %d, %v", k, v, ok)
+				}
+			}
+
+			if len(master) > 0 {
+				if k, _, _ := tree.First(); k != master[0] || tree.Min != k {
+					t.Fatalf("first %d, min %d != %d", k, tree.Min, master[0])
+				}
+			}
+		}
+
+		if tree.Root != nil {
+			t.Fatal("root of an empty tree")
+		}
+	}
+
+	test(3, 0, false)
+	test(3, 1, false)
+	test(3, 100, false)
+	test(4, 500, true)
+	test(5, 1000, false)
+	test(10, 1000, true)
+	test(15, 10000, false)
+}
+
+func TestDeleteRangeAll(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, i)
+	}
+
+	if c := tree.DeleteRange(bp3.RangeValue[int]{Value: 10, Closed: true}, bp3.RangeValue[int]{Value: 5, Closed: true}); c != 0 {
+		t.Fatalf("empty range: %d", c)
+	}
+
+	if c := tree.DeleteRange(bp3.RangeValue[int]{Value: 0, Closed: true}, bp3.RangeValue[int]{Value: 999, Closed: false}); c != 999 {
+		t.Fatalf("delete range: %d", c)
+	}
+
+	if k, _, ok := tree.First(); !ok || k != 999 || tree.Count() != 1 {
+		t.Fatalf("first: %d, %v, %d", k, ok, tree.Count())
+	}
+
+	tree.Insert(5, 5)
+
+	if c := tree.DeleteRange(bp3.RangeValue[int]{Value: -1, Closed: true}, bp3.RangeValue[int]{Value: 1000, Closed: true}); c != 2 || !tree.Empty() || tree.Root != nil {
+		t.Fatalf("delete range: %d, %d", c, tree.Count())
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	check := func(tree *bp3.Instance[int, int], order int, master []int) {
+		t.Helper()
+
+		if tree.Count() != len(master) {
+			t.Fatalf("count %d != %d", tree.Count(), len(master))
+		}
+
+		shape(t, tree.Root, order, true)
+
+		var s []int
+
+		for _, kv := range bp3.Slice(tree.Root) {
+			s = append(s, kv.Key)
+		}
+
+		if !slices.Equal(s, master) {
+			t.Fatalf("%v != %v", s, master)
+		}
+
+		s = s[:0]
+
+		for k := range tree.Backward() {
+			s = append(s, k)
+		}
+
+		slices.Reverse(s)
+
+		if !slices.Equal(s, master) {
+			t.Fatalf("backward %v != %v", s, master)
+		}
+
+		for _, k := range master {
+			if v, ok := tree.Find(k); !ok || v != k {
+				t.Fatalf("find %d: %d, %v", k, v, ok)
+			}
+		}
+
+		if len(master) > 0 && tree.Min != master[0] {
+			t.Fatalf("min %d != %d", tree.Min, master[0])
+		}
+	}
+
+	test := func(order int, n int, duplicates bool) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+
+		options := []bp3.Option{bp3.WithOrder(order)}
+
+		if duplicates {
+			options = append(options, bp3.WithDuplicates())
+		}
+
+		tree := bp3.New[int, int](options...)
+
+		var master []int
+
+		for _, i := range r.Perm(n) {
+			if duplicates {
+				i /= 3
+			}
+
+			tree.Insert(i, i)
+			master = append(master, i)
+		}
+
+		slices.Sort(master)
+
+		for range 20 {
+			key := r.Intn(n+2) - 1
+			i, _ := slices.BinarySearch(master, key)
+
+			left, right := tree.SplitAt(key)
+
+			if !tree.Empty() || tree.Root != nil {
+				t.Fatal("split instance is not empty")
+			}
+
+			check(left, order, master[:i])
+			check(right, order, master[i:])
+
+			joined, err := bp3.Join(left, right)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !left.Empty() || !right.Empty() {
+				t.Fatal("joined instances are not empty")
+			}
+
+			check(joined, order, master)
+
+			tree = joined
+		}
+
+		low, high := -1, n
+
+		for range 20 {
+			key := r.Intn(n+2) - 1
+			i, _ := slices.BinarySearch(master, key)
+
+			left, right := tree.SplitAt(key)
+
+			// grow one of the halves with new keys so that their heights differ
+			if c := r.Intn(n + 1); r.Intn(2) == 0 {
+				var extra []int
+
+				for range c {
+					low--
+					left.Insert(low, low)
+					extra = append(extra, low)
+				}
+
+				slices.Reverse(extra)
+				master = append(extra, master...)
+				i += c
+			} else {
+				for range c {
+					high++
+					right.Insert(high, high)
+					master = append(master, high)
+				}
+			}
+
+			check(left, order, master[:i])
+			check(right, order, master[i:])
+
+			joined, err := bp3.Join(left, right)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			check(joined, order, master)
+
+			tree = joined
+		}
+	}
+
+	test(3, 0, false)
+	test(3, 1, false)
+	test(3, 100, false)
+	test(4, 500, true)
+	test(5, 1000, false)
+	test(10, 1000, true)
+	test(15, 2000, false)
+}
+
+func TestJoinOverlap(t *testing.T) {
+	left := bp3.New[int, int](bp3.WithOrder(3))
+	right := bp3.New[int, int](bp3.WithOrder(3))
+
+	for i := 0; i < 10; i++ {
+		left.Insert(i, i)
+		right.Insert(i+9, i)
+	}
+
+	if _, err := bp3.Join(left, right); !errors.Is(err, bp3.ErrOverlap) {
+		t.Fatal(err)
+	}
+
+	if left.Count() != 10 || right.Count() != 10 {
+		t.Fatalf("count %d, %d", left.Count(), right.Count())
+	}
+}
+
+func TestLeafCapacity(t *testing.T) {
+	test := func(order int, leaf int, n int) {
+		r := rand.New(rand.NewSource(int64(order*leaf + n)))
+		options := []bp3.Option{bp3.WithInternalOrder(order), bp3.WithLeafCapacity(leaf)}
+		tree := bp3.New[int, int](options...)
+
+		if tree.Order != order || tree.LeafCapacity != leaf {
+			t.Fatalf("order %d, leaf capacity %d", tree.Order, tree.LeafCapacity)
+		}
+
+		for i := 0; i < 20; i++ {
+			mutate(r, tree, n, n/2)
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("order %d, leaf %d: %v", order, leaf, err)
+			}
+		}
+
+		for _, i := range r.Perm(n) {
+			tree.Insert(i, i)
+		}
+
+		// the leaves fill up to their own capacity
+		if s := tree.Stats(0); s.Height > 1 && s.Leaves > (n+leaf/2)/(leaf/2) {
+			t.Fatalf("order %d, leaf %d: %d leaves for %d pairs", order, leaf, s.Leaves, n)
+		}
+
+		left, right := tree.SplitAt(n / 3)
+
+		for _, half := range []*bp3.Instance[int, int]{left, right} {
+			if err := half.Validate(); err != nil {
+				t.Fatalf("order %d, leaf %d: split: %v", order, leaf, err)
+			}
+		}
+
+		joined, err := bp3.Join(left, right)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := joined.Validate(); err != nil || joined.Count() != n {
+			t.Fatalf("order %d, leaf %d: join: %v, count %d", order, leaf, err, joined.Count())
+		}
+
+		loaded, err := bp3.BulkLoad(joined.FromClosed(0), options...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := loaded.Validate(); err != nil || loaded.Count() != n {
+			t.Fatalf("order %d, leaf %d: bulk load: %v, count %d", order, leaf, err, loaded.Count())
+		}
+	}
+
+	test(3, 64, 2000)
+	test(4, 3, 1000)
+	test(16, 5, 2000)
+	test(5, 32, 3000)
+}
+
+func TestInternalOrder(t *testing.T) {
+	// the internal order alone keeps the leaves at the capacity of the order
+	tree := bp3.New[int, int](bp3.WithOrder(4), bp3.WithInternalOrder(64))
+
+	if tree.Order != 64 || tree.LeafCapacity != 4 {
+		t.Fatalf("order %d, leaf capacity %d", tree.Order, tree.LeafCapacity)
+	}
+
+	for i := range 1000 {
+		tree.Insert(i, i)
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := tree.Stats(0); s.Height != 3 {
+		t.Fatalf("height %d", s.Height)
+	}
+
+	if tree := bp3.New[int, int](bp3.WithInternalOrder(64)); tree.Order != 64 || tree.LeafCapacity != bp3.MinOrder {
+		t.Fatalf("order %d, leaf capacity %d", tree.Order, tree.LeafCapacity)
+	}
+}
+
 func TestMinimum(t *testing.T) {
 	tree := bp3.New[int, string](bp3.WithOrder(3))
 
@@ -0,0 +1,68 @@
+package bp3
+
+import "iter"
+
+// Floor returns the key-value pair with the greatest key less than or equal to the given key,
+// and a boolean indicating whether such a pair exists.
+func (t *Instance[K, V]) Floor(key K) (K, V, bool) {
+	return t.neighbour(key, true, true)
+}
+
+// Ceiling returns the key-value pair with the least key greater than or equal to the given key,
+// and a boolean indicating whether such a pair exists.
+func (t *Instance[K, V]) Ceiling(key K) (K, V, bool) {
+	return t.neighbour(key, false, false)
+}
+
+// Lower returns the key-value pair with the greatest key strictly less than the given key,
+// and a boolean indicating whether such a pair exists.
+func (t *Instance[K, V]) Lower(key K) (K, V, bool) {
+	return t.neighbour(key, false, true)
+}
+
+// Higher returns the key-value pair with the least key strictly greater than the given key,
+// and a boolean indicating whether such a pair exists.
+func (t *Instance[K, V]) Higher(key K) (K, V, bool) {
+	return t.neighbour(key, true, false)
+}
+
+// Nearest returns a sequence of up to n key-value pairs closest to the given key, in ascending
+// order of their distance from it. The distance function must grow as keys move away from
+// the given key in either direction. Ties are broken in favor of the greater key. The sequence
+// panics with ErrConcurrentModification if the instance is modified while it is being consumed,
+// even if the instance has tolerant sequences.
+func (t *Instance[K, V]) Nearest(key K, n int, distance func(a, b K) float64) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		version := t.Version
+		lower, higher := t.Cursor(), t.Cursor()
+		hasLower, hasHigher := lower.seek(key, false, true), higher.seek(key, false, false)
+
+		for ; n > 0 && (hasLower || hasHigher); n-- {
+			if hasHigher && (!hasLower || distance(key, higher.Key()) <= distance(key, lower.Key())) {
+				if !yield(higher.Key(), higher.Value()) {
+					return
+				}
+
+				t.check(version)
+				hasHigher = higher.Next()
+			} else {
+				if !yield(lower.Key(), lower.Value()) {
+					return
+				}
+
+				t.check(version)
+				hasLower = lower.Prev()
+			}
+		}
+	}
+}
+
+func (t *Instance[K, V]) neighbour(key K, after, back bool) (K, V, bool) {
+	c := t.Cursor()
+
+	if !c.seek(key, after, back) {
+		return *new(K), *new(V), false
+	}
+
+	return c.Key(), c.Value(), true
+}
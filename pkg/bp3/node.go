@@ -1,25 +1,26 @@
 package bp3
 
-import (
-	"golang.org/x/exp/constraints"
-)
+import "slices"
 
 // KeyValue represents a key-value pair
-// The generic parameters K and V are for the key and value types, respectively, where K must be ordered.
-type KeyValue[K constraints.Ordered, V any] struct {
+// The generic parameters K and V are for the key and value types, respectively.
+type KeyValue[K any, V any] struct {
 	Key   K
 	Value V
 }
 
 // Node represents a node in the tree. It contains minimum keys, children node descriptors,
 // key-value pairs, and pointers to the next and previous nodes. The generic parameters K and V are
-// for the key and value types, respectively, where K must be ordered.
-type Node[K constraints.Ordered, V any] struct {
-	Mins     []K                    // Mins are the minimum keys for each child node, starting from the 2nd child.
-	Children []NodeDescriptor[K, V] // Children are the descriptors for the child nodes.
-	Values   []KeyValue[K, V]       // Values are the key-value pairs stored in the node.
-	Next     NodeDescriptor[K, V]   // Next is the descriptor for the next node.
-	Prev     NodeDescriptor[K, V]   // Prev is the descriptor for the previous node.
+// for the key and value types, respectively.
+type Node[K any, V any] struct {
+	Mins       []K                    // Mins are the minimum keys for each child node, starting from the 2nd child.
+	Children   []NodeDescriptor[K, V] // Children are the descriptors for the child nodes.
+	Counts     []int                  // Counts are the number of key-value pairs in each child subtree.
+	Aggregates []any                  // Aggregates are the aggregates of each child subtree, if the instance has a monoid.
+	Values     []KeyValue[K, V]       // Values are the key-value pairs stored in the node.
+	Deadlines  []int64                // Deadlines are the deadlines of the values in Unix nanoseconds, zero for those that do not expire, or nil if none expires.
+	Next       NodeDescriptor[K, V]   // Next is the descriptor for the next node.
+	Prev       NodeDescriptor[K, V]   // Prev is the descriptor for the previous node.
 }
 
 // Count returns the total number of children in the node.
@@ -31,3 +32,17 @@ func (n *Node[K, V]) Count() int {
 func (n *Node[K, V]) Leaf() bool {
 	return len(n.Values) > 0
 }
+
+// Clone returns a copy of the node that shares no slices with it.
+func (n *Node[K, V]) Clone() *Node[K, V] {
+	return &Node[K, V]{
+		Mins:       slices.Clone(n.Mins),
+		Children:   slices.Clone(n.Children),
+		Counts:     slices.Clone(n.Counts),
+		Aggregates: slices.Clone(n.Aggregates),
+		Values:     slices.Clone(n.Values),
+		Deadlines:  slices.Clone(n.Deadlines),
+		Next:       n.Next,
+		Prev:       n.Prev,
+	}
+}
@@ -1,14 +1,66 @@
 package bp3
 
+import "time"
+
 type options struct {
-	order int
+	order       int
+	internal    int
+	leaf        int
+	fill        float64
+	duplicates  bool
+	copyOnWrite bool
+	aggregator  any
+	clock       func() time.Time
+	tolerant    bool
 }
 
 type Option func(*options)
 
+// internalOrder returns the order of an instance, the one given with WithInternalOrder if any.
+func (o options) internalOrder() int {
+	if o.internal > 0 {
+		return max(o.internal, MinOrder)
+	}
+
+	return max(o.order, MinOrder)
+}
+
+// leafCapacity returns the leaf capacity of an instance, zero if it is the order. Without WithLeafCapacity,
+// the leaves of an instance with an internal order keep the capacity given with WithOrder.
+func (o options) leafCapacity() int {
+	leaf := o.leaf
+
+	if leaf <= 0 && o.internal > 0 {
+		leaf = o.order
+	}
+
+	if leaf <= 0 {
+		return 0
+	}
+
+	return max(leaf, MinOrder)
+}
+
+// aggregatorOf returns the aggregator of the monoid given with WithMonoid, nil if none was given.
+// It panics if the monoid has other key or value types.
+func aggregatorOf[K any, V any](o options) Aggregator[K, V] {
+	if o.aggregator == nil {
+		return nil
+	}
+
+	a, ok := o.aggregator.(Aggregator[K, V])
+
+	if !ok {
+		panic("bp3: monoid of other key or value types")
+	}
+
+	return a
+}
+
 func buildOptions(options_ ...Option) options {
 	opts := options{
 		order: MinOrder,
+		fill:  1,
 	}
 
 	for _, opt := range options_ {
@@ -24,3 +76,95 @@ func WithOrder(order int) Option {
 		o.order = order
 	}
 }
+
+// WithInternalOrder sets the maximum number of children of an internal node of the B+ Tree,
+// without changing the maximum number of key-value pairs in a leaf.
+func WithInternalOrder(order int) Option {
+	return func(o *options) {
+		o.internal = order
+	}
+}
+
+// WithLeafCapacity sets the maximum number of key-value pairs in a leaf of the B+ Tree.
+func WithLeafCapacity(capacity int) Option {
+	return func(o *options) {
+		o.leaf = capacity
+	}
+}
+
+// WithDuplicates allows the B+ Tree to hold multiple key-value pairs with equal keys.
+func WithDuplicates() Option {
+	return func(o *options) {
+		o.duplicates = true
+	}
+}
+
+// WithFillFactor sets the fraction (0, 1] of each node that is filled when bulk loading the B+ Tree.
+func WithFillFactor(fill float64) Option {
+	return func(o *options) {
+		o.fill = fill
+	}
+}
+
+// WithCopyOnWrite makes the B+ Tree copy the nodes it shares with its clones and snapshots
+// before writing them. Its leaves are not linked to their neighbours in this mode.
+func WithCopyOnWrite() Option {
+	return func(o *options) {
+		o.copyOnWrite = true
+	}
+}
+
+// WithMonoid makes the B+ Tree cache the aggregate of each child subtree under the given monoid,
+// see Aggregate. The key and value types of the monoid must match the ones of the B+ Tree.
+func WithMonoid[K any, V any, A any](m Monoid[K, V, A]) Option {
+	return func(o *options) {
+		o.aggregator = Aggregating(m)
+	}
+}
+
+// WithClock sets the function that returns the current time for the deadlines of the B+ Tree pairs, instead of time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithTolerantIterators makes the sequences of the B+ Tree resume after the last pair they returned
+// when the B+ Tree is modified while they are being consumed, instead of panicking.
+func WithTolerantIterators() Option {
+	return func(o *options) {
+		o.tolerant = true
+	}
+}
+
+type concurrentOptions struct {
+	exclusiveReads bool
+	flush          func() error
+}
+
+type ConcurrentOption func(*concurrentOptions)
+
+func buildConcurrentOptions(options_ ...ConcurrentOption) concurrentOptions {
+	var opts concurrentOptions
+
+	for _, opt := range options_ {
+		opt(&opts)
+	}
+
+	return opts
+}
+
+// WithExclusiveReads makes the reads of a concurrent B+ Tree take the lock exclusively, and serializes
+// the node accesses of a latched one, for builders whose nodes are not safe to read concurrently.
+func WithExclusiveReads() ConcurrentOption {
+	return func(o *concurrentOptions) {
+		o.exclusiveReads = true
+	}
+}
+
+// WithFlush sets the function that flushes a concurrent or latched B+ Tree, instead of flushing its builder.
+func WithFlush(flush func() error) ConcurrentOption {
+	return func(o *concurrentOptions) {
+		o.flush = flush
+	}
+}
@@ -0,0 +1,167 @@
+package bp3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrPageLimit = errors.New("bp3: page limit is not positive")
+	ErrPageToken = errors.New("bp3: invalid page token")
+)
+
+// PageQuery describes the key-value pairs to page through: optional bounds, the direction, and the
+// token of the previous page. If the token is set, the bounds and the direction are taken from it
+// and the other fields are ignored. The generic parameter K is for the key type.
+type PageQuery[K any] struct {
+	From    *RangeValue[K] // From is the lower bound of the keys, if nil, none.
+	To      *RangeValue[K] // To is the upper bound of the keys, if nil, none.
+	Reverse bool           // Reverse returns the pairs in descending order.
+	Token   PageToken      // Token is the token of the previous page, empty for the first page.
+}
+
+// PageToken is an opaque continuation token that Page returns for the following page. It is a URL-safe
+// string that encodes the query and the last returned key, so that it can be passed between processes
+// and used with the instance after it was modified. It is empty after the last page.
+type PageToken string
+
+// bookmark is the encoded content of a page token. The bounds are held by value, with flags for
+// their presence, as gob does not tell a pointer to a zero value from a nil one. Skip is the number
+// of pairs with a key equal to the last one that were already returned, for duplicates mode.
+type bookmark[K any] struct {
+	From    RangeValue[K]
+	To      RangeValue[K]
+	Lower   bool
+	Upper   bool
+	Reverse bool
+	Started bool
+	Last    K
+	Skip    int
+}
+
+// Page returns up to limit key-value pairs of a query, in ascending order or in descending order if the
+// query is reversed, and the token of the following page, empty if there are no more pairs. A page
+// resumes after the last key of the previous page, as positioned in the instance when the page is
+// requested, so that pairs added or removed between the pages are not returned twice nor skip others.
+// In duplicates mode, the pairs with a key equal to the last one are skipped by their number, so removing
+// such pairs between the pages may skip others. It returns ErrPageLimit if limit is not positive, and
+// an error wrapping ErrPageToken if the token cannot be decoded for the key type.
+func (t *Instance[K, V]) Page(query PageQuery[K], limit int) ([]KeyValue[K, V], PageToken, error) {
+	if limit <= 0 {
+		return nil, "", ErrPageLimit
+	}
+
+	c := bookmark[K]{Lower: query.From != nil, Upper: query.To != nil, Reverse: query.Reverse}
+
+	if c.Lower {
+		c.From = *query.From
+	}
+
+	if c.Upper {
+		c.To = *query.To
+	}
+
+	if query.Token != "" {
+		c = bookmark[K]{}
+
+		if err := query.Token.decode(&c); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var from, to *RangeValue[K]
+
+	if c.Lower {
+		from = &c.From
+	}
+
+	if c.Upper {
+		to = &c.To
+	}
+
+	if c.Started {
+		// equal keys are visited again in duplicates mode, to be skipped by their number
+		bound := &RangeValue[K]{Value: c.Last, Closed: t.Duplicates}
+
+		if c.Reverse {
+			to = bound
+		} else {
+			from = bound
+		}
+	}
+
+	var items []KeyValue[K, V]
+
+	skip := c.Skip
+	more := false
+
+	for k, v := range t.scan(from, to, c.Reverse) {
+		if skip > 0 && t.compare(k, c.Last) == 0 {
+			skip--
+			continue
+		}
+
+		skip = 0
+
+		if len(items) == limit {
+			more = true
+			break
+		}
+
+		items = append(items, KeyValue[K, V]{Key: k, Value: v})
+	}
+
+	if !more {
+		return items, "", nil
+	}
+
+	last := items[len(items)-1].Key
+	n := 0
+
+	if t.Duplicates {
+		for i := len(items) - 1; i >= 0 && t.compare(items[i].Key, last) == 0; i-- {
+			n++
+		}
+
+		if n == len(items) && c.Started && t.compare(last, c.Last) == 0 {
+			n += c.Skip
+		}
+	}
+
+	c.Started, c.Last, c.Skip = true, last, n
+
+	next, err := c.encode()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return items, next, nil
+}
+
+func (c *bookmark[K]) encode() (PageToken, error) {
+	var b bytes.Buffer
+
+	if err := gob.NewEncoder(&b).Encode(c); err != nil {
+		return "", err
+	}
+
+	return PageToken(base64.RawURLEncoding.EncodeToString(b.Bytes())), nil
+}
+
+func (token PageToken) decode(c any) error {
+	b, err := base64.RawURLEncoding.DecodeString(string(token))
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPageToken, err)
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(c); err != nil {
+		return fmt.Errorf("%w: %v", ErrPageToken, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package bp3_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func pages(t *testing.T, tree *bp3.Instance[int, int], query bp3.PageQuery[int], limit int, between func()) []int {
+	t.Helper()
+
+	var keys []int
+
+	for {
+		items, next, err := tree.Page(query, limit)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(items) > limit || (next != "" && len(items) != limit) {
+			t.Fatalf("page of %d pairs, limit %d, token %q", len(items), limit, next)
+		}
+
+		for _, kv := range items {
+			keys = append(keys, kv.Key)
+		}
+
+		if next == "" {
+			return keys
+		}
+
+		if between != nil {
+			between()
+		}
+
+		query = bp3.PageQuery[int]{Token: next}
+	}
+}
+
+func TestPage(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+
+	for i := range 100 {
+		tree.Insert(i, i)
+	}
+
+	from, to := bp3.RangeValue[int]{Value: 0, Closed: false}, bp3.RangeValue[int]{Value: 50, Closed: true}
+
+	for _, limit := range []int{1, 3, 7, 50, 100} {
+		var want []int
+
+		for i := 1; i <= 50; i++ {
+			want = append(want, i)
+		}
+
+		if got := pages(t, tree, bp3.PageQuery[int]{From: &from, To: &to}, limit, nil); !slices.Equal(got, want) {
+			t.Fatalf("limit %d: got %v, expected %v", limit, got, want)
+		}
+
+		slices.Reverse(want)
+
+		if got := pages(t, tree, bp3.PageQuery[int]{From: &from, To: &to, Reverse: true}, limit, nil); !slices.Equal(got, want) {
+			t.Fatalf("limit %d, reverse: got %v, expected %v", limit, got, want)
+		}
+	}
+
+	if got := pages(t, tree, bp3.PageQuery[int]{}, 30, nil); len(got) != 100 {
+		t.Fatalf("%d keys in unbounded pages", len(got))
+	}
+
+	if _, _, err := tree.Page(bp3.PageQuery[int]{}, 0); !errors.Is(err, bp3.ErrPageLimit) {
+		t.Fatalf("error %v, expected %v", err, bp3.ErrPageLimit)
+	}
+
+	if _, _, err := tree.Page(bp3.PageQuery[int]{Token: "not a token"}, 10); !errors.Is(err, bp3.ErrPageToken) {
+		t.Fatalf("error %v, expected %v", err, bp3.ErrPageToken)
+	}
+
+	_, next, _ := tree.Page(bp3.PageQuery[int]{}, 10)
+
+	if _, _, err := bp3.New[string, int]().Page(bp3.PageQuery[string]{Token: next}, 10); !errors.Is(err, bp3.ErrPageToken) {
+		t.Fatalf("error %v, expected %v", err, bp3.ErrPageToken)
+	}
+}
+
+func TestPageModified(t *testing.T) {
+	test := func(reverse bool) {
+		tree := bp3.New[int, int](bp3.WithOrder(4))
+
+		for i := range 100 {
+			tree.Insert(2*i, i)
+		}
+
+		n := 0
+
+		// between the pages, remove an even key and add odd keys
+		got := pages(t, tree, bp3.PageQuery[int]{Reverse: reverse}, 5, func() {
+			n++
+			tree.Delete(100 + 10*n)
+			tree.Insert(1, 0)
+			tree.Insert(99+10*n, 0)
+		})
+
+		seen := make(map[int]bool)
+
+		for _, k := range got {
+			if seen[k] {
+				t.Fatalf("reverse %v: key %d returned twice", reverse, k)
+			}
+
+			seen[k] = true
+		}
+
+		for i := range 100 {
+			if k := 2 * i; !seen[k] && (k <= 100 || (k-100)%10 != 0) {
+				t.Fatalf("reverse %v: key %d skipped", reverse, k)
+			}
+		}
+
+		ascending := slices.Clone(got)
+
+		if reverse {
+			slices.Reverse(ascending)
+		}
+
+		if !slices.IsSorted(ascending) {
+			t.Fatalf("reverse %v: keys out of order %v", reverse, got)
+		}
+	}
+
+	test(false)
+	test(true)
+}
+
+func TestPageDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates())
+
+	for i := range 60 {
+		tree.Insert(i%4, i)
+	}
+
+	for _, reverse := range []bool{false, true} {
+		var want []int
+
+		for i := range 4 {
+			for j := range 15 {
+				want = append(want, i*100+j)
+			}
+		}
+
+		var got []int
+		query := bp3.PageQuery[int]{Reverse: reverse}
+
+		for {
+			items, next, err := tree.Page(query, 4)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, kv := range items {
+				got = append(got, kv.Key*100+kv.Value/4)
+			}
+
+			if next == "" {
+				break
+			}
+
+			query = bp3.PageQuery[int]{Token: next}
+		}
+
+		if reverse {
+			// the pairs with equal keys are returned in reverse insertion order
+			slices.Sort(got)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("reverse %v: got %v, expected %v", reverse, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package bp3
+
+import "iter"
+
+// Prefix returns a sequence of the key-value pairs of an instance whose key starts with the given prefix,
+// in ascending order. The keys must be ordered byte-wise, as strings are by default.
+func Prefix[K ~string, V any](t *Instance[K, V], prefix string) iter.Seq2[K, V] {
+	from := RangeValue[K]{K(prefix), true}
+
+	if end, ok := successor(prefix); ok {
+		return t.Range(from, RangeValue[K]{K(end), false})
+	}
+
+	return t.From(from)
+}
+
+// CountPrefix returns the number of key-value pairs of an instance whose key starts with the given prefix.
+func CountPrefix[K ~string, V any](t *Instance[K, V], prefix string) int {
+	return t.CountRange(prefixRange(t, prefix))
+}
+
+// DeletePrefix removes all the key-value pairs of an instance whose key starts with the given prefix,
+// and returns their number.
+func DeletePrefix[K ~string, V any](t *Instance[K, V], prefix string) int {
+	return t.DeleteRange(prefixRange(t, prefix))
+}
+
+// prefixRange returns the range of the keys of an instance that start with the given prefix.
+func prefixRange[K ~string, V any](t *Instance[K, V], prefix string) (RangeValue[K], RangeValue[K]) {
+	from := RangeValue[K]{K(prefix), true}
+
+	if end, ok := successor(prefix); ok {
+		return from, RangeValue[K]{K(end), false}
+	}
+
+	// no string follows all those with the prefix, the range ends at the last key
+	last, _, _ := t.Last()
+
+	return from, RangeValue[K]{last, true}
+}
+
+// successor returns the least string that is greater than all the strings with the given prefix,
+// and false if there is none (the prefix is empty or made of 0xff bytes only). The prefix is
+// treated as bytes, so the successor may not be valid UTF-8 and is meant to be used as a bound only.
+func successor(prefix string) (string, bool) {
+	end := []byte(prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,90 @@
+package bp3_test
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+type path string
+
+func TestPrefix(t *testing.T) {
+	r := rand.New(rand.NewSource(19))
+	tree := bp3.New[path, int](bp3.WithOrder(4))
+
+	parts := []string{"a", "ab", "é", "日本", "\xff", "z"}
+	var keys []string
+
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("%s/%d/%s", parts[r.Intn(len(parts))], r.Intn(20), parts[r.Intn(len(parts))])
+
+		if _, found := tree.Insert(path(key), i); !found {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	matching := func(prefix string) []string {
+		var result []string
+
+		for _, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				result = append(result, key)
+			}
+		}
+
+		return result
+	}
+
+	prefixes := []string{"", "a", "a/", "ab/1", "é", "é/1/", "日", "日本/3/\xff", "\xff", "\xff/", "\xff\xff", "zz", "b"}
+
+	for _, prefix := range prefixes {
+		expected := matching(prefix)
+		var actual []string
+
+		for k := range bp3.Prefix(tree, prefix) {
+			actual = append(actual, string(k))
+		}
+
+		if !slices.Equal(actual, expected) {
+			t.Fatalf("prefix %q: %q != %q", prefix, actual, expected)
+		}
+
+		if count := bp3.CountPrefix(tree, prefix); count != len(expected) {
+			t.Fatalf("prefix %q: count %d != %d", prefix, count, len(expected))
+		}
+	}
+
+	for _, prefix := range prefixes[1:] {
+		expected := matching(prefix)
+
+		if n := bp3.DeletePrefix(tree, prefix); n != len(expected) {
+			t.Fatalf("prefix %q: deleted %d != %d", prefix, n, len(expected))
+		}
+
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return strings.HasPrefix(key, prefix)
+		})
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if count := bp3.CountPrefix(tree, ""); count != len(keys) || tree.Count() != len(keys) {
+			t.Fatalf("prefix %q: count %d, %d != %d", prefix, count, tree.Count(), len(keys))
+		}
+	}
+
+	if n := bp3.DeletePrefix(tree, ""); n != len(keys) || !tree.Empty() {
+		t.Fatalf("deleted %d != %d", n, len(keys))
+	}
+
+	if n := bp3.DeletePrefix(tree, ""); n != 0 || bp3.CountPrefix(tree, "a") != 0 {
+		t.Fatalf("deleted %d from an empty tree", n)
+	}
+}
@@ -0,0 +1,271 @@
+package bp3
+
+import "slices"
+
+// DeleteRange removes all the key-value pairs within the specified range and returns their number.
+// Subtrees that are fully covered by the range are detached as a whole, and only the nodes
+// along the two boundaries of the range are rebalanced.
+func (t *Instance[K, V]) DeleteRange(from, to RangeValue[K]) int {
+	if t.Root == nil || t.compare(to.Value, from.Value) < 0 {
+		return 0
+	}
+
+	lo, hi := t.rank(t.Root, from.Value, !from.Closed), t.rank(t.Root, to.Value, to.Closed)
+
+	if lo >= hi {
+		return 0
+	}
+
+	var removed []KeyValue[K, V]
+	var deadlines []int64
+
+	if t.observed() || t.scheduled() {
+		p, leaf, i := t.walk(from.Value, !from.Closed)
+		removed, deadlines = t.collect(p, leaf, i, hi-lo)
+	}
+
+	t.prune(lo, hi)
+	t.forget(removed, deadlines)
+
+	return hi - lo
+}
+
+// collect returns n key-value pairs in ascending order, from the i-th pair of a leaf, reached by the
+// given path, on, and their deadlines, nil if the instance has none.
+func (t *Instance[K, V]) collect(p path[K, V], leaf NodeDescriptor[K, V], i, n int) ([]KeyValue[K, V], []int64) {
+	s := make([]KeyValue[K, V], 0, n)
+
+	var deadlines []int64
+
+	for ; len(s) < n; leaf, i = t.next(&p, leaf), 0 {
+		node := leaf.Read()
+		j := min(len(node.Values), i+n-len(s))
+
+		if t.scheduled() {
+			for k := i; k < j; k++ {
+				deadlines = append(deadlines, node.deadline(k))
+			}
+		}
+
+		s = append(s, node.Values[i:j]...)
+	}
+
+	return s, deadlines
+}
+
+// forget removes the deadlines of the key-value pairs removed by prune, and then calls the hooks for them.
+func (t *Instance[K, V]) forget(removed []KeyValue[K, V], deadlines []int64) {
+	for i, deadline := range deadlines {
+		t.unschedule(removed[i].Key, deadline)
+	}
+
+	for _, kv := range removed {
+		t.deleted(kv)
+	}
+}
+
+// prune removes the key-value pairs at positions lo (inclusive) to hi (exclusive), where lo < hi.
+func (t *Instance[K, V]) prune(lo, hi int) {
+	if !t.CopyOnWrite {
+		t.unlink(lo, hi)
+	}
+
+	if lo == 0 && hi == weight(t.Root) {
+		t.drop(t.Root)
+		t.Root = nil
+	} else {
+		t.Root = t.copy(t.Root)
+		t.cut(t.Root, lo, hi)
+
+		for !t.Root.Read().Leaf() && len(t.Root.Read().Children) == 1 {
+			root := t.Root
+			t.Root = root.Read().Children[0]
+			t.Builder.Delete(root)
+		}
+	}
+
+	t.Size -= hi - lo
+	t.Version++
+	t.Min = *new(K)
+
+	if node := minimum(t.Root); node != nil {
+		t.Min = node.Read().Values[0].Key
+	}
+}
+
+// unlink links the leaves around the pairs at positions lo (inclusive) to hi (exclusive)
+// to each other, skipping the leaves in between that are about to be dropped.
+func (t *Instance[K, V]) unlink(lo, hi int) {
+	first, i := at(t.Root, lo)
+	last, j := at(t.Root, hi-1)
+
+	prev, next := first, last
+
+	if i == 0 {
+		prev = first.Read().Prev
+	}
+
+	if j == len(last.Read().Values)-1 {
+		next = last.Read().Next
+	}
+
+	if prev != next {
+		if prev != nil {
+			prev.Write().Next = next
+		}
+
+		if next != nil {
+			next.Write().Prev = prev
+		}
+	}
+}
+
+// cut removes the key-value pairs at positions lo (inclusive) to hi (exclusive) of a subtree
+// that are not all of its pairs. The root of the subtree may be left underfull.
+func (t *Instance[K, V]) cut(root NodeDescriptor[K, V], lo, hi int) {
+	if root.Read().Leaf() {
+		root.Write().Values = slices.Delete(root.Read().Values, lo, hi)
+		root.Write().untimed(lo, hi)
+		return
+	}
+
+	recount(root)
+
+	node := root.Read()
+
+	var children []NodeDescriptor[K, V]
+	var mins []K
+	var weights []int
+
+	n := 0
+
+	for i, child := range node.Children {
+		c := node.Counts[i]
+		from, to := max(lo-n, 0), min(hi-n, c)
+		n += c
+
+		if from == 0 && to == c {
+			t.drop(child)
+			continue
+		}
+
+		if from < to {
+			child = t.mutable(root, i)
+			t.cut(child, from, to)
+			c -= to - from
+		}
+
+		if len(children) > 0 {
+			separator := node.Mins[i-1]
+
+			// the child lost its minimum
+			if from == 0 && from < to {
+				separator = minimum(child).Read().Values[0].Key
+			}
+
+			mins = append(mins, separator)
+		}
+
+		children = append(children, child)
+		weights = append(weights, c)
+	}
+
+	root.Write().Children, root.Write().Mins, root.Write().Counts = children, mins, weights
+
+	t.settle(root)
+}
+
+// drop deletes all the nodes of a subtree.
+func (t *Instance[K, V]) drop(root NodeDescriptor[K, V]) {
+	for _, child := range root.Read().Children {
+		t.drop(child)
+	}
+
+	t.Builder.Delete(root)
+}
+
+// settle merges or redistributes the underfull children of an internal node with their siblings,
+// until all of them are full enough or a single child is left.
+func (t *Instance[K, V]) settle(root NodeDescriptor[K, V]) {
+	for i := 0; i < len(root.Read().Children) && len(root.Read().Children) > 1; {
+		if child := root.Read().Children[i].Read(); child.Count() >= t.least(child.Leaf()) {
+			i++
+			continue
+		}
+
+		i = min(i, len(root.Read().Children)-2)
+		t.combine(root, i)
+	}
+
+	t.reaggregate(root)
+}
+
+// combine merges the i-th child of an internal node with the following one, or redistributes
+// their children evenly between them when they do not fit in a single node.
+func (t *Instance[K, V]) combine(root NodeDescriptor[K, V], i int) {
+	left, right := t.mutable(root, i), t.mutable(root, i+1)
+	total := left.Read().Count() + right.Read().Count()
+	merge := total <= t.capacity(left.Read().Leaf())
+	m := total / 2
+
+	if merge {
+		m = total
+	}
+
+	if left.Read().Leaf() {
+		values := append(slices.Clone(left.Read().Values), right.Read().Values...)
+		deadlines := spread(left.Read(), right.Read())
+		left.Write().Values, right.Write().Values = values[:m], slices.Clone(values[m:])
+		left.Write().Deadlines, right.Write().Deadlines = nil, nil
+
+		if deadlines != nil {
+			left.Write().Deadlines, right.Write().Deadlines = deadlines[:m], slices.Clone(deadlines[m:])
+		}
+
+		if merge {
+			left.Write().Next = right.Read().Next
+
+			if right.Read().Next != nil {
+				right.Read().Next.Write().Prev = left
+			}
+		} else {
+			root.Write().Mins[i] = values[m].Key
+		}
+	} else {
+		recount(left)
+		recount(right)
+
+		children := append(slices.Clone(left.Read().Children), right.Read().Children...)
+		weights := append(slices.Clone(left.Read().Counts), right.Read().Counts...)
+		mins := append(append(slices.Clone(left.Read().Mins), root.Read().Mins[i]), right.Read().Mins...)
+
+		left.Write().Children, right.Write().Children = children[:m], slices.Clone(children[m:])
+		left.Write().Counts, right.Write().Counts = weights[:m], slices.Clone(weights[m:])
+
+		if merge {
+			left.Write().Mins, right.Write().Mins = mins, nil
+		} else {
+			left.Write().Mins, right.Write().Mins = mins[:m-1], slices.Clone(mins[m:])
+			root.Write().Mins[i] = mins[m-1]
+		}
+	}
+
+	if merge {
+		t.Builder.Delete(right)
+		root.Write().Counts[i] += root.Read().Counts[i+1]
+		root.Write().Counts = slices.Delete(root.Read().Counts, i+1, i+2)
+		root.Write().Children = slices.Delete(root.Read().Children, i+1, i+2)
+		root.Write().Mins = slices.Delete(root.Read().Mins, i, i+1)
+	} else {
+		root.Write().Counts[i], root.Write().Counts[i+1] = weight(left), weight(right)
+	}
+
+	// the children that met at the seam may be underfull themselves
+	if !left.Read().Leaf() {
+		t.settle(left)
+
+		if !merge {
+			t.settle(right)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package bp3
+
+// Rank returns the number of key-value pairs whose key is less than the given key.
+func (t *Instance[K, V]) Rank(key K) int {
+	return t.rank(t.Root, key, false)
+}
+
+// At returns the key-value pair at the given zero-based position in ascending key order,
+// and a boolean indicating whether the position is within the instance.
+func (t *Instance[K, V]) At(i int) (K, V, bool) {
+	if t.Root == nil || i < 0 || i >= weight(t.Root) {
+		return *new(K), *new(V), false
+	}
+
+	leaf, i := at(t.Root, i)
+	kv := leaf.Read().Values[i]
+
+	return kv.Key, kv.Value, true
+}
+
+// CountRange returns the number of key-value pairs within the specified range.
+// The range is defined by the 'from' and 'to' RangeValue parameters.
+func (t *Instance[K, V]) CountRange(from, to RangeValue[K]) int {
+	if t.compare(to.Value, from.Value) < 0 {
+		return 0
+	}
+
+	return max(t.rank(t.Root, to.Value, to.Closed)-t.rank(t.Root, from.Value, !from.Closed), 0)
+}
+
+// rank returns the number of key-value pairs whose key is less than the given key,
+// or not greater than it if after is set.
+func (t *Instance[K, V]) rank(root NodeDescriptor[K, V], key K, after bool) int {
+	n := 0
+
+	for root != nil {
+		node := root.Read()
+
+		if node.Leaf() {
+			return n + t.search(node.Values, key, after)
+		}
+
+		i := t.child(node.Mins, key, after)
+
+		for _, c := range counts(node)[:i] {
+			n += c
+		}
+
+		root = node.Children[i]
+	}
+
+	return n
+}
+
+// at returns the leaf and the index of the key-value pair at the given position of a subtree.
+func at[K any, V any](root NodeDescriptor[K, V], i int) (NodeDescriptor[K, V], int) {
+	for !root.Read().Leaf() {
+		c := counts(root.Read())
+		j := 0
+
+		for j < len(c)-1 && i >= c[j] {
+			i -= c[j]
+			j++
+		}
+
+		root = root.Read().Children[j]
+	}
+
+	return root, i
+}
+
+// counts returns the number of key-value pairs in each child subtree of an internal node,
+// computing them if the node was built without counts.
+func counts[K any, V any](node *Node[K, V]) []int {
+	if len(node.Counts) == len(node.Children) {
+		return node.Counts
+	}
+
+	c := make([]int, len(node.Children))
+
+	for i, child := range node.Children {
+		c[i] = weight(child)
+	}
+
+	return c
+}
+
+// weight returns the number of key-value pairs in the subtree of a node.
+func weight[K any, V any](d NodeDescriptor[K, V]) int {
+	node := d.Read()
+
+	if node.Leaf() {
+		return len(node.Values)
+	}
+
+	n := 0
+
+	for _, c := range counts(node) {
+		n += c
+	}
+
+	return n
+}
+
+// recount sets the counts of an internal node that was built without them, before they are updated.
+func recount[K any, V any](d NodeDescriptor[K, V]) {
+	if node := d.Read(); len(node.Counts) != len(node.Children) {
+		d.Write().Counts = counts(node)
+	}
+}
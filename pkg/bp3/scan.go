@@ -0,0 +1,138 @@
+package bp3
+
+import (
+	"errors"
+	"iter"
+)
+
+// ErrConcurrentModification is the value the sequences of an instance panic with when the instance
+// is modified while they are being consumed, unless the instance has tolerant sequences.
+var ErrConcurrentModification = errors.New("bp3: instance modified during iteration")
+
+// scan returns a sequence of the key-value pairs between optional bounds, in ascending order or in
+// descending order if reverse is set. The version of the instance is checked after each returned pair.
+// If it changed, the sequence panics with ErrConcurrentModification, or if the instance has tolerant
+// sequences, it resumes after the last returned pair, as positioned in the modified instance.
+func (t *Instance[K, V]) scan(from, to *RangeValue[K], reverse bool) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if from != nil && to != nil && t.compare(to.Value, from.Value) < 0 {
+			return
+		}
+
+		version := t.Version
+		p, node, i := t.start(from, to, reverse)
+
+		var last K
+
+		returned := 0 // the number of visited pairs with a key equal to the last one
+		skip := 0     // the number of pairs with a key equal to the last one to skip after resuming
+
+		for node != nil && node.Read() != nil {
+			values := node.Read().Values
+
+			if i < 0 || i >= len(values) {
+				node, i = t.step(&p, node, reverse)
+				continue
+			}
+
+			kv, expired := values[i], t.expired(node.Read(), i)
+
+			if reverse {
+				i--
+			} else {
+				i++
+			}
+
+			if (!reverse && to != nil && t.after(kv.Key, *to)) || (reverse && from != nil && t.before(kv.Key, *from)) {
+				return
+			}
+
+			if skip > 0 {
+				if t.compare(kv.Key, last) == 0 {
+					skip--
+					continue
+				}
+
+				skip = 0
+			}
+
+			if returned > 0 && t.compare(kv.Key, last) == 0 {
+				returned++
+			} else {
+				returned = 1
+			}
+
+			last = kv.Key
+
+			if !expired && !yield(kv.Key, kv.Value) {
+				return
+			}
+
+			if t.Version != version {
+				if !t.Tolerant {
+					panic(ErrConcurrentModification)
+				}
+
+				version = t.Version
+				p, node, i = t.resume(last, reverse)
+				skip = returned
+			}
+		}
+	}
+}
+
+// start returns the path to the leaf and the index of the first key-value pair of a sequence between
+// optional bounds, in ascending order or in descending order if reverse is set. The index may be out
+// of the bounds of the leaf.
+func (t *Instance[K, V]) start(from, to *RangeValue[K], reverse bool) (path[K, V], NodeDescriptor[K, V], int) {
+	switch {
+	case !reverse && from != nil:
+		return t.walk(from.Value, !from.Closed)
+	case !reverse:
+		p, node := t.first()
+		return p, node, 0
+	case to != nil:
+		p, node, i := t.walk(to.Value, to.Closed)
+		return p, node, i - 1
+	default:
+		p, node := t.last()
+
+		if node == nil {
+			return p, node, 0
+		}
+
+		return p, node, len(node.Read().Values) - 1
+	}
+}
+
+// resume returns the path to the leaf and the index of the first key-value pair whose key is not less
+// than the given key, or of the last one whose key is not greater than it if reverse is set.
+func (t *Instance[K, V]) resume(last K, reverse bool) (path[K, V], NodeDescriptor[K, V], int) {
+	if reverse {
+		p, node, i := t.walk(last, true)
+		return p, node, i - 1
+	}
+
+	return t.walk(last, false)
+}
+
+// step returns the leaf that follows the given one and the index of its first key-value pair,
+// or the leaf that precedes it and the index of its last pair if reverse is set.
+func (t *Instance[K, V]) step(p *path[K, V], leaf NodeDescriptor[K, V], reverse bool) (NodeDescriptor[K, V], int) {
+	if !reverse {
+		return t.next(p, leaf), 0
+	}
+
+	if leaf = t.prev(p, leaf); leaf != nil && leaf.Read() != nil {
+		return leaf, len(leaf.Read().Values) - 1
+	}
+
+	return leaf, 0
+}
+
+// check panics with ErrConcurrentModification if the instance version is not the given one.
+func (t *Instance[K, V]) check(version uint64) {
+	if t.Version != version {
+		panic(ErrConcurrentModification)
+	}
+}
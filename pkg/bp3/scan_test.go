@@ -0,0 +1,167 @@
+package bp3_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func modified(t *testing.T, fn func()) {
+	t.Helper()
+
+	defer func() {
+		t.Helper()
+
+		r := recover()
+
+		if err, ok := r.(error); !ok || !errors.Is(err, bp3.ErrConcurrentModification) {
+			t.Fatalf("recovered %v, expected %v", r, bp3.ErrConcurrentModification)
+		}
+	}()
+
+	fn()
+}
+
+func TestScanFailFast(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+
+	for i := range 100 {
+		tree.Insert(i, i)
+	}
+
+	modified(t, func() {
+		for k := range tree.RangeClosed(10, 50) {
+			tree.Insert(k+1000, k)
+		}
+	})
+
+	modified(t, func() {
+		for k := range tree.Backward() {
+			tree.Delete(k)
+		}
+	})
+
+	modified(t, func() {
+		for range tree.Nearest(50, 10, func(a, b int) float64 { return float64(a - b) }) {
+			bp3.Clear(tree)
+		}
+	})
+
+	// replacing values is not a modification
+	for k, v := range tree.FromClosed(0) {
+		tree.Insert(k, v+1)
+	}
+
+	c := tree.Cursor()
+
+	for ok := c.SeekFirst(); ok; ok = c.Next() {
+		if c.Value() != c.Key()+1 {
+			t.Fatalf("value of %d is %d", c.Key(), c.Value())
+		}
+	}
+}
+
+func TestScanTolerant(t *testing.T) {
+	test := func(order int, reverse bool, options ...bp3.Option) {
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order), bp3.WithTolerantIterators())...)
+
+		for i := range 300 {
+			tree.Insert(2*i, i)
+		}
+
+		seq := tree.RangeClosed(100, 500)
+
+		if reverse {
+			seq = tree.RangeReverseClosed(100, 500)
+		}
+
+		var got []int
+
+		for k := range seq {
+			got = append(got, k)
+
+			// on an even key, remove the next even key and add the odd one between them
+			if k%2 != 0 {
+				continue
+			}
+
+			if reverse {
+				tree.Delete(k - 2)
+				tree.Insert(k-1, 0)
+			} else {
+				tree.Delete(k + 2)
+				tree.Insert(k+1, 0)
+			}
+		}
+
+		var want []int
+
+		for i := 100; i <= 500; i += 4 {
+			want = append(want, i, i+1)
+		}
+
+		want = want[:len(want)-1]
+
+		if reverse {
+			want = nil
+
+			for i := 500; i >= 100; i -= 4 {
+				want = append(want, i, i-1)
+			}
+
+			want = want[:len(want)-1]
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("order %d, reverse %v: got %v, expected %v", order, reverse, got, want)
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, order := range []int{3, 4, 5, 8, 33} {
+		for _, reverse := range []bool{false, true} {
+			test(order, reverse)
+			test(order, reverse, bp3.WithCopyOnWrite())
+		}
+	}
+}
+
+func TestScanTolerantDuplicates(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates(), bp3.WithTolerantIterators())
+
+	for i := range 30 {
+		tree.Insert(i%3, i)
+	}
+
+	var got []int
+
+	for k, v := range tree.FromClosed(0) {
+		got = append(got, v)
+
+		if k == 1 && v == 1 {
+			tree.Insert(1, 100)
+			tree.Delete(0)
+		}
+	}
+
+	want := []int{0, 3, 6, 9, 12, 15, 18, 21, 24, 27}
+
+	for i := 1; i < 30; i += 3 {
+		want = append(want, i)
+	}
+
+	want = append(want, 100)
+
+	for i := 2; i < 30; i += 3 {
+		want = append(want, i)
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, expected %v", got, want)
+	}
+}
@@ -0,0 +1,307 @@
+package bp3
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrOverlap = errors.New("bp3: overlapping key ranges")
+
+// SplitAt cuts the instance into two along the path of the given key. The first holds the
+// key-value pairs whose keys are less than the given key, and the second holds the rest.
+// The halves reuse the nodes of the instance and share its builder, and the instance is left empty.
+// The deadlines of the pairs are moved to new expiry indexes of the halves.
+func (t *Instance[K, V]) SplitAt(key K) (*Instance[K, V], *Instance[K, V]) {
+	left, right := t.sibling(), t.sibling()
+	left.Expiry, right.Expiry = t.partition(key)
+	removed := t.pairs()
+
+	if t.Root != nil {
+		left.Size = t.rank(t.Root, key, false)
+		right.Size = t.Size - left.Size
+		left.Root, _, right.Root, _ = t.split(t.copy(t.Root), height(t.Root), key)
+
+		if left.Root != nil {
+			left.Min = t.Min
+		}
+
+		right.Min, _, _ = right.First()
+	}
+
+	t.Root, t.Min, t.Size = nil, *new(K), 0
+	t.Version++
+
+	for _, kv := range removed {
+		t.deleted(kv)
+	}
+
+	return left, right
+}
+
+// Join concatenates two instances into one by grafting the lower tree into the taller one
+// at its height. All the keys of left must be less than the keys of right, or not greater
+// in duplicates mode, otherwise ErrOverlap is returned. The nodes of both instances are reused,
+// so they must be built by the same builder, and both instances are left empty. The deadlines
+// of the pairs are moved to a new expiry index of the joined instance.
+func Join[K any, V any](left, right *Instance[K, V]) (*Instance[K, V], error) {
+	var sep K
+
+	if left.Root != nil && right.Root != nil {
+		last, first := maximum(left.Root), minimum(right.Root)
+		sep = first.Read().Values[0].Key
+
+		if c := left.compare(last.Read().Values[len(last.Read().Values)-1].Key, sep); c > 0 || (c == 0 && !left.Duplicates) {
+			return nil, ErrOverlap
+		}
+
+		if !left.CopyOnWrite {
+			last.Write().Next, first.Write().Prev = first, last
+		}
+	}
+
+	moved := [][]KeyValue[K, V]{left.pairs(), right.pairs()}
+
+	tree := left.sibling()
+	tree.Root, _ = left.join(left.Root, height(left.Root), right.Root, height(right.Root), sep)
+	tree.Size = left.Size + right.Size
+	tree.Min = right.Min
+	tree.Expiry = merge(left.Expiry, right.Expiry)
+
+	if left.Root != nil {
+		tree.Min = left.Min
+	}
+
+	left.Root, left.Min, left.Size = nil, *new(K), 0
+	right.Root, right.Min, right.Size = nil, *new(K), 0
+	left.Version++
+	right.Version++
+
+	for i, t := range []*Instance[K, V]{left, right} {
+		for _, kv := range moved[i] {
+			t.deleted(kv)
+		}
+	}
+
+	return tree, nil
+}
+
+// pairs returns all the key-value pairs of the instance if it has hooks, to call them for the pairs
+// after they are moved to another instance, and nil otherwise.
+func (t *Instance[K, V]) pairs() []KeyValue[K, V] {
+	if !t.observed() || t.Root == nil {
+		return nil
+	}
+
+	p, leaf := t.first()
+	s, _ := t.collect(p, leaf, 0, t.Size)
+
+	return s
+}
+
+// sibling returns an empty instance with the same settings and builder.
+func (t *Instance[K, V]) sibling() *Instance[K, V] {
+	return &Instance[K, V]{Order: t.Order, LeafCapacity: t.LeafCapacity, Compare: t.Compare, Duplicates: t.Duplicates, Builder: t.Builder, CopyOnWrite: t.CopyOnWrite, Aggregator: t.Aggregator, Clock: t.Clock, Tolerant: t.Tolerant}
+}
+
+// split cuts a subtree of the given height along the path of a key, and returns the subtrees (and their
+// heights) of the key-value pairs whose keys are less than the key, and of the rest. Either may be nil.
+func (t *Instance[K, V]) split(root NodeDescriptor[K, V], h int, key K) (NodeDescriptor[K, V], int, NodeDescriptor[K, V], int) {
+	node := root.Read()
+
+	if node.Leaf() {
+		i := t.search(node.Values, key, false)
+
+		if i == 0 {
+			if node.Prev != nil {
+				node.Prev.Write().Next = nil
+				root.Write().Prev = nil
+			}
+
+			return nil, 0, root, 0
+		}
+
+		if i == len(node.Values) {
+			if node.Next != nil {
+				node.Next.Write().Prev = nil
+				root.Write().Next = nil
+			}
+
+			return root, 0, nil, 0
+		}
+
+		brother := t.Builder.Create(&Node[K, V]{Values: slices.Clone(node.Values[i:]), Deadlines: root.Write().cut(i), Next: node.Next})
+
+		if node.Next != nil {
+			node.Next.Write().Prev = brother
+		}
+
+		root.Write().Values = node.Values[:i]
+		root.Write().Next = nil
+
+		return root, 0, brother, 0
+	}
+
+	recount(root)
+
+	j := t.child(node.Mins, key, false)
+	left, lh, right, rh := t.split(t.mutable(root, j), h-1, key)
+
+	// the children before and after the path are grafted to the two halves
+	var lower, upper NodeDescriptor[K, V]
+	var lowerSep, upperSep K
+
+	lowerHeight, upperHeight := h, h
+
+	if j > 0 {
+		lowerSep = node.Mins[j-1]
+	}
+
+	if j < len(node.Mins) {
+		upperSep = node.Mins[j]
+	}
+
+	switch k := len(node.Children) - j - 1; {
+	case k == 1:
+		upper, upperHeight = node.Children[j+1], h-1
+	case k > 1:
+		upper = t.Builder.Create(&Node[K, V]{
+			Children: slices.Clone(node.Children[j+1:]),
+			Mins:     slices.Clone(node.Mins[j+1:]),
+			Counts:   slices.Clone(node.Counts[j+1:]),
+		})
+
+		t.reaggregate(upper)
+	}
+
+	switch {
+	case j == 1:
+		lower, lowerHeight = node.Children[0], h-1
+		t.Builder.Delete(root)
+	case j > 1:
+		lower = root
+		root.Write().Children = node.Children[:j]
+		root.Write().Mins = node.Mins[:j-1]
+		root.Write().Counts = node.Counts[:j]
+		t.reaggregate(root)
+	default:
+		t.Builder.Delete(root)
+	}
+
+	left, lh = t.join(lower, lowerHeight, left, lh, lowerSep)
+	right, rh = t.join(right, rh, upper, upperHeight, upperSep)
+
+	return left, lh, right, rh
+}
+
+// join concatenates two subtrees of the given heights, whose leaves are already linked, and returns
+// the joined subtree and its height. The separator must not be less than the keys of the first subtree,
+// nor greater than the keys of the second.
+func (t *Instance[K, V]) join(a NodeDescriptor[K, V], ah int, b NodeDescriptor[K, V], bh int, sep K) (NodeDescriptor[K, V], int) {
+	if a == nil {
+		return b, bh
+	}
+
+	if b == nil {
+		return a, ah
+	}
+
+	if ah == bh {
+		root := t.Builder.Create(&Node[K, V]{
+			Children: []NodeDescriptor[K, V]{a, b},
+			Mins:     []K{sep},
+			Counts:   []int{weight(a), weight(b)},
+		})
+
+		t.settle(root)
+
+		if child := root.Read().Children[0]; len(root.Read().Children) == 1 {
+			t.Builder.Delete(root)
+			return child, ah
+		}
+
+		return root, ah + 1
+	}
+
+	var root, brother NodeDescriptor[K, V]
+	var brotherMin K
+	var h int
+
+	if ah > bh {
+		root, h = t.copy(a), ah
+		brother, brotherMin = t.graft(root, ah, b, bh, sep, false)
+	} else {
+		root, h = t.copy(b), bh
+		brother, brotherMin = t.graft(root, bh, a, ah, sep, true)
+	}
+
+	if brother == nil {
+		return root, h
+	}
+
+	root = t.Builder.Create(&Node[K, V]{
+		Children: []NodeDescriptor[K, V]{root, brother},
+		Mins:     []K{brotherMin},
+		Counts:   []int{weight(root), weight(brother)},
+	})
+
+	t.reaggregate(root)
+
+	return root, h + 1
+}
+
+// graft adds a lower subtree as the first (or last) child of the node at the matching height along
+// the leftmost (or rightmost) path of a subtree. It returns the brother of the subtree root and its
+// minimum if the root was split.
+func (t *Instance[K, V]) graft(root NodeDescriptor[K, V], h int, sub NodeDescriptor[K, V], sh int, sep K, first bool) (NodeDescriptor[K, V], K) {
+	recount(root)
+
+	i := 0
+
+	if !first {
+		i = len(root.Read().Children) - 1
+	}
+
+	if h == sh+1 {
+		if first {
+			root.Write().Children = slices.Insert(root.Read().Children, 0, sub)
+			root.Write().Mins = slices.Insert(root.Read().Mins, 0, sep)
+			root.Write().Counts = slices.Insert(root.Read().Counts, 0, weight(sub))
+		} else {
+			root.Write().Children = append(root.Read().Children, sub)
+			root.Write().Mins = append(root.Read().Mins, sep)
+			root.Write().Counts = append(root.Read().Counts, weight(sub))
+		}
+
+		t.settle(root)
+	} else {
+		child := t.mutable(root, i)
+		brother, brotherMin := t.graft(child, h-1, sub, sh, sep, first)
+		root.Write().Counts[i] = weight(child)
+
+		if brother != nil {
+			root.Write().Children = slices.Insert(root.Read().Children, i+1, brother)
+			root.Write().Mins = slices.Insert(root.Read().Mins, i, brotherMin)
+			root.Write().Counts = slices.Insert(root.Read().Counts, i+1, weight(brother))
+		}
+
+		t.reaggregate(root)
+	}
+
+	if len(root.Read().Children) <= t.Order {
+		return nil, *new(K)
+	}
+
+	return t.divide(root)
+}
+
+// height returns the number of internal levels above the leaves of a subtree.
+func height[K any, V any](root NodeDescriptor[K, V]) int {
+	h := 0
+
+	for root != nil && !root.Read().Leaf() {
+		root = root.Read().Children[0]
+		h++
+	}
+
+	return h
+}
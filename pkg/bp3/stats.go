@@ -0,0 +1,125 @@
+package bp3
+
+import "math/rand/v2"
+
+// Stats describes the shape of an instance.
+type Stats struct {
+	Height    int          // Height is the number of levels, zero for an empty instance.
+	Internal  int          // Internal is the number of internal nodes.
+	Leaves    int          // Leaves is the number of leaves.
+	LeafChain int          // LeafChain is the number of leaves linked from the first one, counted by exact stats only.
+	Levels    []LevelStats // Levels describes each level, from the root down.
+	Sampled   bool         // Sampled is true if the stats are estimated from a sample of paths.
+}
+
+// LevelStats describes a level of an instance.
+type LevelStats struct {
+	Nodes     int     // Nodes is the number of nodes in the level.
+	Visited   int     // Visited is the number of nodes in the level that the rest of the stats are of.
+	Fill      float64 // Fill is the average number of entries in a node relative to its capacity.
+	Histogram [10]int // Histogram counts the nodes by their fill, in tenths of their capacity.
+	Sizes     []int64 // Sizes are the encoded sizes of the nodes, if their descriptors implement NodeSizer.
+}
+
+// Stats returns the shape of the instance. If samples is positive, the stats are estimated from
+// that many random paths from the root to a leaf, and only the nodes along them are read (and loaded).
+// Otherwise, all the nodes are read and the stats are exact.
+func (t *Instance[K, V]) Stats(samples int) Stats {
+	if t.Root == nil || t.Root.Read() == nil {
+		return Stats{}
+	}
+
+	if samples > 0 {
+		return t.sample(samples)
+	}
+
+	var s Stats
+
+	for level := []NodeDescriptor[K, V]{t.Root}; len(level) > 0; {
+		var next []NodeDescriptor[K, V]
+
+		ls := LevelStats{Nodes: len(level)}
+
+		for _, d := range level {
+			t.measure(&ls, d)
+			next = append(next, d.Read().Children...)
+		}
+
+		s.add(ls)
+		level = next
+	}
+
+	for leaf := minimum(t.Root); leaf != nil && !t.CopyOnWrite; leaf = leaf.Read().Next {
+		s.LeafChain++
+	}
+
+	return s
+}
+
+// sample estimates the stats from random paths. The number of nodes in a level is estimated
+// from the average number of children of the visited nodes in the level above it.
+func (t *Instance[K, V]) sample(samples int) Stats {
+	var levels []map[NodeDescriptor[K, V]]bool
+
+	for range samples {
+		d := t.Root
+
+		for i := 0; ; i++ {
+			if i == len(levels) {
+				levels = append(levels, make(map[NodeDescriptor[K, V]]bool))
+			}
+
+			levels[i][d] = true
+			node := d.Read()
+
+			if node.Leaf() || len(node.Children) == 0 {
+				break
+			}
+
+			d = node.Children[rand.IntN(len(node.Children))]
+		}
+	}
+
+	s := Stats{Sampled: true}
+	nodes := 1.0
+
+	for _, level := range levels {
+		ls := LevelStats{Nodes: int(nodes + 0.5)}
+		children := 0
+
+		for d := range level {
+			t.measure(&ls, d)
+			children += len(d.Read().Children)
+		}
+
+		s.add(ls)
+		nodes *= float64(children) / float64(len(level))
+	}
+
+	return s
+}
+
+// measure adds a node to the stats of its level.
+func (t *Instance[K, V]) measure(ls *LevelStats, d NodeDescriptor[K, V]) {
+	node := d.Read()
+	fill := float64(node.Count()) / float64(t.capacity(node.Leaf()))
+
+	ls.Fill = (ls.Fill*float64(ls.Visited) + fill) / float64(ls.Visited+1)
+	ls.Visited++
+	ls.Histogram[min(int(fill*10), 9)]++
+
+	if sizer, ok := d.(NodeSizer); ok {
+		ls.Sizes = append(ls.Sizes, sizer.Size())
+	}
+}
+
+// add adds a level below the levels of the stats.
+func (s *Stats) add(ls LevelStats) {
+	if s.Height > 0 {
+		s.Internal += s.Levels[s.Height-1].Nodes
+	}
+
+	s.Levels = append(s.Levels, ls)
+	s.Height++
+	s.Leaves = ls.Nodes
+}
@@ -0,0 +1,105 @@
+package bp3_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestStats(t *testing.T) {
+	if s := bp3.New[int, int]().Stats(0); s.Height != 0 || s.Leaves != 0 || len(s.Levels) != 0 {
+		t.Fatalf("empty: %+v", s)
+	}
+
+	test := func(order int, n int) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.New[int, int](bp3.WithOrder(order))
+
+		for _, i := range r.Perm(n) {
+			tree.Insert(i, i)
+		}
+
+		s := tree.Stats(0)
+		height := shape(t, tree.Root, order, true)
+
+		if s.Sampled || s.Height != height || len(s.Levels) != height {
+			t.Fatalf("order %d, n %d: height %d != %d", order, n, s.Height, height)
+		}
+
+		if s.Leaves != s.LeafChain || s.Leaves != s.Levels[height-1].Nodes || s.Levels[0].Nodes != 1 {
+			t.Fatalf("order %d, n %d: leaves %d, chain %d, %+v", order, n, s.Leaves, s.LeafChain, s.Levels)
+		}
+
+		internal := 0
+
+		for i, level := range s.Levels {
+			histogram := 0
+
+			for _, c := range level.Histogram {
+				histogram += c
+			}
+
+			if level.Visited != level.Nodes || histogram != level.Nodes || level.Sizes != nil {
+				t.Fatalf("order %d, n %d: level %d: %+v", order, n, i, level)
+			}
+
+			if i > 0 && level.Fill < 0.5 {
+				t.Fatalf("order %d, n %d: level %d fill %f", order, n, i, level.Fill)
+			}
+
+			if i < height-1 {
+				internal += level.Nodes
+
+				// the entries of a level are the nodes of the next one
+				if entries := level.Fill * float64(order*level.Nodes); math.Abs(entries-float64(s.Levels[i+1].Nodes)) > 1e-6 {
+					t.Fatalf("order %d, n %d: level %d has %f entries, %d nodes below", order, n, i, entries, s.Levels[i+1].Nodes)
+				}
+			}
+		}
+
+		if internal != s.Internal {
+			t.Fatalf("order %d, n %d: internal %d != %d", order, n, s.Internal, internal)
+		}
+
+		if entries := s.Levels[height-1].Fill * float64(order*s.Leaves); math.Abs(entries-float64(n)) > 1e-6 {
+			t.Fatalf("order %d, n %d: %f pairs in the leaves", order, n, entries)
+		}
+
+		sampled := tree.Stats(10)
+
+		if !sampled.Sampled || sampled.Height != height || sampled.Levels[0].Nodes != 1 || sampled.LeafChain != 0 {
+			t.Fatalf("order %d, n %d: sampled %+v", order, n, sampled)
+		}
+
+		for i, level := range sampled.Levels {
+			if level.Visited > 10 || level.Visited > s.Levels[i].Nodes {
+				t.Fatalf("order %d, n %d: level %d: visited %d", order, n, i, level.Visited)
+			}
+		}
+	}
+
+	for order := 3; order < 10; order++ {
+		for _, n := range []int{1, 10, 100, 1000} {
+			test(order, n)
+		}
+	}
+
+	// a full tree with a uniform fanout is estimated exactly
+	tree := bp3.New[int, int](bp3.WithOrder(4))
+
+	if err := tree.Build(func(yield func(int, int) bool) {
+		for i := 0; i < 4*4*4*4; i++ {
+			if !yield(i, i) {
+				return
+			}
+		}
+	}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := tree.Stats(100); s.Height != 4 || s.Leaves != 64 || s.Internal != 21 || s.Levels[3].Fill != 1 {
+		t.Fatalf("full: %+v", s)
+	}
+}
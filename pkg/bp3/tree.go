@@ -1,12 +1,10 @@
 package bp3
 
 import (
-	"cmp"
 	"iter"
-	"math"
 	"slices"
-
-	"golang.org/x/exp/constraints"
+	"sort"
+	"time"
 )
 
 const (
@@ -14,20 +12,126 @@ const (
 )
 
 // Instance represents a b+tree instance structure that contains a root node descriptor,
-// a minimum value, the order of the structure, its size, and a node builder. The generic
-// parameters K and V are for the key and value types, respectively.
-type Instance[K constraints.Ordered, V any] struct {
-	Root    NodeDescriptor[K, V] // Root is the descriptor for the root node.
-	Min     K                    // Min is the minimum key value in the instance.
-	Order   int                  // Order is the order of the structure.
-	Size    int                  // Size is the number of elements in the instance.
-	Builder NodeBuilder[K, V]    // Builder is used to create new nodes within the instance.
-}
-
-// Insert adds a key-value pair to the B+ Tree.
-func (t *Instance[K, V]) Insert(key K, value V) {
-	kv := KeyValue[K, V]{Key: key, Value: value}
-	child, minimum, brother, brotherMin := t.insert(t.Root, t.Min, kv)
+// a minimum value, the order of the structure, its size, a key compare function and a node
+// builder. The generic parameters K and V are for the key and value types, respectively.
+type Instance[K any, V any] struct {
+	Root         NodeDescriptor[K, V] // Root is the descriptor for the root node.
+	Min          K                    // Min is the minimum key value in the instance.
+	Order        int                  // Order is the order of the structure, the maximum number of children of an internal node.
+	LeafCapacity int                  // LeafCapacity is the maximum number of key-value pairs in a leaf, if zero, Order.
+	Size         int                  // Size is the number of elements in the instance.
+	Compare      func(a, b K) int     // Compare orders the keys, if nil, the natural order of K, see NaturalOrder.
+	Duplicates   bool                 // Duplicates allows multiple key-value pairs with equal keys.
+	Builder      NodeBuilder[K, V]    // Builder is used to create new nodes within the instance.
+	CopyOnWrite  bool                 // CopyOnWrite copies shared nodes before writing them, the builder must implement NodeCopier.
+	Aggregator   Aggregator[K, V]     // Aggregator is the monoid whose aggregates are cached for each child subtree, if nil, none.
+	Clock        func() time.Time     // Clock returns the current time for the deadlines of the pairs, if nil, time.Now.
+	Expiry       *Instance[int64, K]  // Expiry is the index of the deadlines of the pairs, created by the first InsertWithTTL if nil.
+	Version      uint64               // Version is incremented by each change that adds or removes pairs, checked by the sequences.
+	Tolerant     bool                 // Tolerant makes the sequences resume after a change instead of panicking with ErrConcurrentModification.
+	hooks        *hooks[K, V]
+	natural      func(a, b K) int // natural is the natural order of K, resolved by the first comparison without Compare.
+}
+
+// Insert adds a key-value pair to the B+ Tree, replacing the value of an existing key and clearing its deadline.
+// It returns the previous value associated with the key and a boolean indicating whether the key existed.
+// In duplicates mode, the pair is always added after the pairs with an equal key and nothing is replaced.
+func (t *Instance[K, V]) Insert(key K, value V) (V, bool) {
+	item := &insertion[K, V]{key: key, retime: true, put: func(V, bool) (V, bool) {
+		return value, true
+	}}
+
+	t.put(item)
+
+	return item.old, item.found
+}
+
+// InsertIfAbsent adds a key-value pair to the B+ Tree only if the key does not exist.
+// It returns true if the pair was added.
+// In duplicates mode, InsertIfAbsent, Replace and Update apply to the first pair with an equal key.
+func (t *Instance[K, V]) InsertIfAbsent(key K, value V) bool {
+	_, found := t.upsert(key, func(_ V, found bool) (V, bool) {
+		return value, !found
+	})
+
+	return !found
+}
+
+// Replace replaces the value associated with the given key only if the key exists.
+// It returns the previous value and a boolean indicating whether the value was replaced.
+func (t *Instance[K, V]) Replace(key K, value V) (V, bool) {
+	return t.upsert(key, func(_ V, found bool) (V, bool) {
+		return value, found
+	})
+}
+
+// Update sets the value associated with the given key to the one returned by fn, which receives the
+// current value and a boolean indicating whether the key exists. If fn returns false, the key is
+// removed from the B+ Tree (or not added). It returns the new value and a boolean indicating
+// whether the key exists after the update.
+func (t *Instance[K, V]) Update(key K, fn func(old V, ok bool) (V, bool)) (V, bool) {
+	var value V
+	var keep bool
+
+	_, found := t.upsert(key, func(old V, ok bool) (V, bool) {
+		value, keep = fn(old, ok)
+		return value, keep
+	})
+
+	if !keep {
+		if found {
+			t.Delete(key)
+		}
+
+		return *new(V), false
+	}
+
+	return value, true
+}
+
+// insertion describes a single write into the B+ Tree. The put function receives the current
+// value of the key and whether it exists, and returns the value to store and whether to store it.
+// A new pair is stored with the given deadline, as is a replaced one if retime is set. The stored
+// pair and its deadline are kept in kv and deadline if it was inserted or replaced, and the replaced
+// pair and its deadline in prev and due.
+type insertion[K any, V any] struct {
+	key      K
+	put      func(V, bool) (V, bool)
+	expires  int64
+	retime   bool
+	old      V
+	found    bool
+	inserted bool
+	replaced bool
+	kv       KeyValue[K, V]
+	deadline int64
+	prev     KeyValue[K, V]
+	due      int64
+}
+
+func (t *Instance[K, V]) upsert(key K, put func(V, bool) (V, bool)) (V, bool) {
+	if t.Duplicates {
+		// the first pair of a run of equal keys may be in a leaf before the one an insertion descends to
+		if p, node, i, found := t.find(key); found && !t.expired(node.Read(), i) {
+			prev := node.Read().Values[i]
+
+			if value, ok := put(prev.Value, true); ok {
+				t.own(p, node).Write().Values[i].Value = value
+				t.regatherPath(p)
+				t.replaced(prev, node.Read().Values[i])
+			}
+
+			return prev.Value, true
+		}
+	}
+
+	item := &insertion[K, V]{key: key, put: put}
+	t.put(item)
+	return item.old, item.found
+}
+
+func (t *Instance[K, V]) put(item *insertion[K, V]) {
+	child, minimum, brother, brotherMin := t.insert(t.copy(t.Root), t.Min, item)
 	t.Min = minimum
 
 	if brother == nil {
@@ -35,25 +139,51 @@ func (t *Instance[K, V]) Insert(key K, value V) {
 	} else {
 		children := []NodeDescriptor[K, V]{child, brother}
 		mins := []K{brotherMin}
-		t.Root = t.Builder.Create(&Node[K, V]{Children: children, Mins: mins})
+		counts := []int{weight(child), weight(brother)}
+		t.Root = t.Builder.Create(&Node[K, V]{Children: children, Mins: mins, Counts: counts})
+		t.reaggregate(t.Root)
 	}
 
-	t.Size++
+	if item.inserted {
+		t.Size++
+		t.Version++
+		t.schedule(item.key, item.deadline)
+		t.inserted(item.kv)
+	} else if item.replaced {
+		if item.due != item.deadline {
+			t.unschedule(item.key, item.due)
+			t.schedule(item.key, item.deadline)
+		}
+
+		t.replaced(item.prev, item.kv)
+	}
 }
 
 // Find retrieves the value associated with the given key from the B+ Tree,
 // returning the value and a boolean indicating success.
+// In duplicates mode, it retrieves the value of the first pair with an equal key.
 func (t *Instance[K, V]) Find(key K) (V, bool) {
-	if node, i, found := find(t.Root, key); found {
+	if _, node, i, found := t.find(key); found && !t.expired(node.Read(), i) {
 		return node.Read().Values[i].Value, true
 	}
 
 	return *new(V), false
 }
 
+// FindAll returns a sequence of the values associated with the given key, in insertion order.
+func (t *Instance[K, V]) FindAll(key K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range t.RangeClosed(key, key) {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
 // RangeValue represents a range with a value and a flag indicating whether the range is closed.
-// The generic parameter K is for the key type which must be ordered.
-type RangeValue[K constraints.Ordered] struct {
+// The generic parameter K is for the key type.
+type RangeValue[K any] struct {
 	Value  K
 	Closed bool
 }
@@ -61,38 +191,7 @@ type RangeValue[K constraints.Ordered] struct {
 // Range returns a sequence of key-value pairs within the specified range.
 // The range is defined by the 'from' and 'to' RangeValue parameters.
 func (t *Instance[K, V]) Range(from, to RangeValue[K]) iter.Seq2[K, V] {
-	return func(yield func(K, V) bool) {
-		if to.Value < from.Value {
-			return
-		}
-
-		node, i, _ := find(t.Root, from.Value)
-
-		for node != nil && node.Read() != nil {
-			for i < len(node.Read().Values) {
-				key := node.Read().Values[i].Key
-
-				if key > to.Value {
-					return
-				}
-
-				if !to.Closed && key == to.Value {
-					return
-				}
-
-				if !(key < from.Value || (!from.Closed && key == from.Value)) {
-					if !yield(key, node.Read().Values[i].Value) {
-						return
-					}
-				}
-
-				i++
-			}
-
-			i = 0
-			node = node.Read().Next
-		}
-	}
+	return t.scan(&from, &to, false)
 }
 
 // RangeClosed returns a sequence of key-value pairs within the specified closed range [from, to].
@@ -117,26 +216,7 @@ func (t *Instance[K, V]) RangeHighHalfOpened(from, to K) iter.Seq2[K, V] {
 
 // From returns a sequence of key-value pairs starting from the specified range value.
 func (t *Instance[K, V]) From(from RangeValue[K]) iter.Seq2[K, V] {
-	return func(yield func(K, V) bool) {
-		node, i, _ := find(t.Root, from.Value)
-
-		for node != nil && node.Read() != nil {
-			for i < len(node.Read().Values) {
-				key := node.Read().Values[i].Key
-
-				if !(key < from.Value || (!from.Closed && key == from.Value)) {
-					if !yield(key, node.Read().Values[i].Value) {
-						return
-					}
-				}
-
-				i++
-			}
-
-			i = 0
-			node = node.Read().Next
-		}
-	}
+	return t.scan(&from, nil, false)
 }
 
 // FromClosed returns a sequence of key-value pairs starting from the specified key, including the key itself.
@@ -151,33 +231,7 @@ func (t *Instance[K, V]) FromOpened(from K) iter.Seq2[K, V] {
 
 // To returns a sequence of key-value pairs up to the specified range value.
 func (t *Instance[K, V]) To(to RangeValue[K]) iter.Seq2[K, V] {
-	return func(yield func(K, V) bool) {
-		node := minimum(t.Root)
-		i := 0
-
-		for node != nil && node.Read() != nil {
-			for i < len(node.Read().Values) {
-				key := node.Read().Values[i].Key
-
-				if key > to.Value {
-					return
-				}
-
-				if !to.Closed && key == to.Value {
-					return
-				}
-
-				if !yield(key, node.Read().Values[i].Value) {
-					return
-				}
-
-				i++
-			}
-
-			i = 0
-			node = node.Read().Next
-		}
-	}
+	return t.scan(nil, &to, false)
 }
 
 // ToClosed returns a sequence of key-value pairs up to and including the specified key.
@@ -190,13 +244,118 @@ func (t *Instance[K, V]) ToOpened(to K) iter.Seq2[K, V] {
 	return t.To(RangeValue[K]{to, false})
 }
 
+// RangeReverse returns a sequence of key-value pairs within the specified range, in descending order.
+// The range is defined by the 'from' and 'to' RangeValue parameters, where 'from' is the lower bound.
+func (t *Instance[K, V]) RangeReverse(from, to RangeValue[K]) iter.Seq2[K, V] {
+	return t.scan(&from, &to, true)
+}
+
+// RangeReverseClosed returns a sequence of key-value pairs within the specified closed range [from, to], in descending order.
+func (t *Instance[K, V]) RangeReverseClosed(from, to K) iter.Seq2[K, V] {
+	return t.RangeReverse(RangeValue[K]{from, true}, RangeValue[K]{to, true})
+}
+
+// RangeReverseOpened returns a sequence of key-value pairs within the specified open range (from, to), in descending order.
+func (t *Instance[K, V]) RangeReverseOpened(from, to K) iter.Seq2[K, V] {
+	return t.RangeReverse(RangeValue[K]{from, false}, RangeValue[K]{to, false})
+}
+
+// RangeReverseLowHalfOpened returns a sequence of key-value pairs within the specified range (from, to], in descending order.
+func (t *Instance[K, V]) RangeReverseLowHalfOpened(from, to K) iter.Seq2[K, V] {
+	return t.RangeReverse(RangeValue[K]{from, false}, RangeValue[K]{to, true})
+}
+
+// RangeReverseHighHalfOpened returns a sequence of key-value pairs within the specified range [from, to), in descending order.
+func (t *Instance[K, V]) RangeReverseHighHalfOpened(from, to K) iter.Seq2[K, V] {
+	return t.RangeReverse(RangeValue[K]{from, true}, RangeValue[K]{to, false})
+}
+
+// FromReverse returns a sequence of key-value pairs down to the specified range value,
+// starting from the maximum key, in descending order.
+func (t *Instance[K, V]) FromReverse(from RangeValue[K]) iter.Seq2[K, V] {
+	return t.scan(&from, nil, true)
+}
+
+// FromReverseClosed returns a sequence of key-value pairs down to and including the specified key, in descending order.
+func (t *Instance[K, V]) FromReverseClosed(from K) iter.Seq2[K, V] {
+	return t.FromReverse(RangeValue[K]{from, true})
+}
+
+// FromReverseOpened returns a sequence of key-value pairs down to but excluding the specified key, in descending order.
+func (t *Instance[K, V]) FromReverseOpened(from K) iter.Seq2[K, V] {
+	return t.FromReverse(RangeValue[K]{from, false})
+}
+
+// ToReverse returns a sequence of key-value pairs starting from the specified range value
+// down to the minimum key, in descending order.
+func (t *Instance[K, V]) ToReverse(to RangeValue[K]) iter.Seq2[K, V] {
+	return t.scan(nil, &to, true)
+}
+
+// ToReverseClosed returns a sequence of key-value pairs starting from the specified key, including the key itself,
+// in descending order.
+func (t *Instance[K, V]) ToReverseClosed(to K) iter.Seq2[K, V] {
+	return t.ToReverse(RangeValue[K]{to, true})
+}
+
+// ToReverseOpened returns a sequence of key-value pairs starting below the specified key, in descending order.
+func (t *Instance[K, V]) ToReverseOpened(to K) iter.Seq2[K, V] {
+	return t.ToReverse(RangeValue[K]{to, false})
+}
+
+// Backward returns a sequence of all the key-value pairs in the instance, in descending order.
+func (t *Instance[K, V]) Backward() iter.Seq2[K, V] {
+	return t.scan(nil, nil, true)
+}
+
 // Delete removes the key-value pair associated with the specified key from the instance.
 // It returns the value associated with the deleted key and a boolean indicating whether the key was found and deleted.
+// In duplicates mode, it removes the first pair with an equal key.
 func (t *Instance[K, V]) Delete(key K) (V, bool) {
-	v, deleted, newMin := t.delete(t.Root, key, t.Min)
+	return t.remove(&deletion[K, V]{key: key})
+}
+
+// DeleteOne removes the first key-value pair with the specified key whose value satisfies match.
+// It returns the deleted value and a boolean indicating whether a pair was found and deleted.
+func (t *Instance[K, V]) DeleteOne(key K, match func(V) bool) (V, bool) {
+	return t.remove(&deletion[K, V]{key: key, match: match})
+}
+
+// DeleteAll removes all the key-value pairs with the specified key and returns their number.
+func (t *Instance[K, V]) DeleteAll(key K) int {
+	n := 0
+
+	for {
+		if _, deleted := t.Delete(key); !deleted {
+			return n
+		}
+
+		n++
+	}
+}
+
+// deletion describes the removal of a single key-value pair. The pair is the first with
+// an equal key whose value satisfies match (if set), after skipping the given number of such pairs.
+// If edge is set, the first (negative) or last (positive) pair is removed instead, and its key is
+// stored in key. If expired is set, only pairs whose deadline is not after it are removed.
+// The removed pair and its deadline are kept in kv and deadline.
+type deletion[K any, V any] struct {
+	key      K
+	match    func(V) bool
+	skip     int
+	edge     int
+	expired  int64
+	kv       KeyValue[K, V]
+	deadline int64
+}
+
+func (t *Instance[K, V]) remove(item *deletion[K, V]) (V, bool) {
+	t.Root = t.copy(t.Root)
+	v, deleted, newMin := t.delete(t.Root, item, t.Min)
 
 	if deleted {
 		t.Size--
+		t.Version++
 		t.Min = newMin
 
 		if len(t.Root.Read().Children) == 1 {
@@ -204,11 +363,92 @@ func (t *Instance[K, V]) Delete(key K) (V, bool) {
 		} else if t.Root.Read().Count() == 0 {
 			t.Root = nil
 		}
+
+		t.unschedule(item.kv.Key, item.deadline)
+		t.deleted(item.kv)
 	}
 
 	return v, deleted
 }
 
+// PopMin removes the key-value pair with the minimum key from the instance and returns it,
+// with a boolean indicating whether the instance was not empty.
+func (t *Instance[K, V]) PopMin() (K, V, bool) {
+	return t.pop(-1)
+}
+
+// PopMax removes the key-value pair with the maximum key from the instance and returns it,
+// with a boolean indicating whether the instance was not empty.
+func (t *Instance[K, V]) PopMax() (K, V, bool) {
+	return t.pop(1)
+}
+
+// PopMinN removes up to n key-value pairs with the minimum keys from the instance
+// and returns them in ascending order. The pairs are removed at once, as DeleteRange
+// removes them, so that only the nodes along the right boundary of the removed pairs
+// are written and rebalanced. Expired pairs before the last returned one are removed
+// as well, without being returned.
+func (t *Instance[K, V]) PopMinN(n int) []KeyValue[K, V] {
+	if n = min(n, t.Size); n <= 0 || t.Root == nil {
+		return nil
+	}
+
+	if !t.scheduled() {
+		p, leaf := t.first()
+		s, _ := t.collect(p, leaf, 0, n)
+
+		t.prune(0, n)
+		t.forget(s, nil)
+
+		return s
+	}
+
+	// take the pairs up to the n-th one that has not expired
+	s := make([]KeyValue[K, V], 0, n)
+	m := 0
+
+	for p, leaf := t.first(); leaf != nil && len(s) < n; leaf = t.next(&p, leaf) {
+		for i := 0; i < len(leaf.Read().Values) && len(s) < n; i++ {
+			if m++; !t.expired(leaf.Read(), i) {
+				s = append(s, leaf.Read().Values[i])
+			}
+		}
+	}
+
+	p, leaf := t.first()
+	removed, deadlines := t.collect(p, leaf, 0, m)
+
+	t.prune(0, m)
+	t.forget(removed, deadlines)
+
+	return s
+}
+
+func (t *Instance[K, V]) pop(edge int) (K, V, bool) {
+	if t.scheduled() {
+		// the pair at the edge may have expired, so find the live one through a cursor
+		c := t.Cursor()
+
+		if (edge < 0 && !c.SeekFirst()) || (edge > 0 && !c.SeekLast()) {
+			return *new(K), *new(V), false
+		}
+
+		key := c.Key()
+		v, _ := c.remove()
+
+		return key, v, true
+	}
+
+	item := &deletion[K, V]{edge: edge}
+	v, deleted := t.remove(item)
+
+	if !deleted {
+		return *new(K), v, false
+	}
+
+	return item.key, v, true
+}
+
 // Count returns the number of elements in the instance.
 func (t *Instance[K, V]) Count() int {
 	return t.Size
@@ -219,11 +459,31 @@ func (t *Instance[K, V]) Empty() bool {
 	return t.Count() == 0
 }
 
+// First returns the key-value pair with the minimum key in the instance,
+// and a boolean indicating whether the instance is not empty.
+func (t *Instance[K, V]) First() (K, V, bool) {
+	if c := t.Cursor(); c.SeekFirst() {
+		return c.Key(), c.Value(), true
+	}
+
+	return *new(K), *new(V), false
+}
+
+// Last returns the key-value pair with the maximum key in the instance,
+// and a boolean indicating whether the instance is not empty.
+func (t *Instance[K, V]) Last() (K, V, bool) {
+	if c := t.Cursor(); c.SeekLast() {
+		return c.Key(), c.Value(), true
+	}
+
+	return *new(K), *new(V), false
+}
+
 // Minimum returns the minimum value in the instance.
 // It panics if the instance is empty.
 func (t *Instance[K, V]) Minimum() V {
-	if node := minimum(t.Root); node != nil && node.Read() != nil {
-		return node.Read().Values[0].Value
+	if _, v, ok := t.First(); ok {
+		return v
 	}
 
 	panic("bp3: empty tree")
@@ -232,8 +492,8 @@ func (t *Instance[K, V]) Minimum() V {
 // Maximum returns the maximum value in the instance.
 // It panics if the instance is empty.
 func (t *Instance[K, V]) Maximum() V {
-	if node := maximum(t.Root); node != nil && node.Read() != nil {
-		return node.Read().Values[len(node.Read().Values)-1].Value
+	if _, v, ok := t.Last(); ok {
+		return v
 	}
 
 	panic("bp3: empty tree")
@@ -242,82 +502,140 @@ func (t *Instance[K, V]) Maximum() V {
 // Slice traverses the nodes starting from the given root NodeDescriptor
 // collects all the key-value pairs from the leaf nodes, and returns them as a slice.
 // It iterates through the nodes in ascending order based on the keys.
-func Slice[K constraints.Ordered, V any](root NodeDescriptor[K, V]) []KeyValue[K, V] {
+func Slice[K any, V any](root NodeDescriptor[K, V]) []KeyValue[K, V] {
 	var s []KeyValue[K, V]
+	var collect func(NodeDescriptor[K, V])
 
-	node := minimum(root)
-
-	for node != nil && node.Read() != nil {
+	collect = func(node NodeDescriptor[K, V]) {
+		if node == nil || node.Read() == nil {
+			return
+		}
 
-		if !node.Read().Leaf() {
-			panic("!")
+		if node.Read().Leaf() {
+			s = append(s, node.Read().Values...)
+			return
 		}
 
-		s = append(s, node.Read().Values...)
-		node = node.Read().Next
+		for _, child := range node.Read().Children {
+			collect(child)
+		}
 	}
 
+	collect(root)
+
 	return s
 }
 
-func (t *Instance[K, V]) insert(root NodeDescriptor[K, V], minimum K, item KeyValue[K, V]) (NodeDescriptor[K, V], K, NodeDescriptor[K, V], K) {
+func (t *Instance[K, V]) insert(root NodeDescriptor[K, V], minimum K, item *insertion[K, V]) (NodeDescriptor[K, V], K, NodeDescriptor[K, V], K) {
 
 	if root == nil || root.Read() == nil {
-		kv := KeyValue[K, V]{Key: item.Key, Value: item.Value}
-		return t.Builder.Create(&Node[K, V]{Values: []KeyValue[K, V]{kv}}), item.Key, nil, *new(K)
+		value, ok := item.put(*new(V), false)
+
+		if !ok {
+			return root, minimum, nil, *new(K)
+		}
+
+		item.inserted = true
+		kv := KeyValue[K, V]{Key: item.key, Value: value}
+		item.kv, item.deadline = kv, item.expires
+		node := &Node[K, V]{Values: []KeyValue[K, V]{kv}}
+		node.expire(0, item.expires)
+		return t.Builder.Create(node), item.key, nil, *new(K)
 	}
 
 	if root.Read().Leaf() {
-		kv := KeyValue[K, V]{Key: item.Key, Value: item.Value}
-
-		i, found := slices.BinarySearchFunc(root.Read().Values, kv, func(a, b KeyValue[K, V]) int {
-			return cmp.Compare(a.Key, b.Key)
+		i, found := slices.BinarySearchFunc(root.Read().Values, item.key, func(a KeyValue[K, V], b K) int {
+			return t.compare(a.Key, b)
 		})
 
+		if t.Duplicates {
+			i, found = t.search(root.Read().Values, item.key, true), false
+		}
+
+		if found && t.expired(root.Read(), i) {
+			// an expired pair is overwritten as if it was absent
+			if value, ok := item.put(*new(V), false); ok {
+				item.prev, item.due = root.Read().Values[i], root.Read().deadline(i)
+				root.Write().Values[i] = KeyValue[K, V]{Key: item.key, Value: value}
+				root.Write().expire(i, item.expires)
+				item.replaced, item.kv, item.deadline = true, root.Read().Values[i], item.expires
+			}
+
+			return root, root.Read().Values[0].Key, nil, *new(K)
+		}
+
 		if found {
-			root.Write().Values[i] = kv
-		} else {
-			root.Write().Values = slices.Insert(root.Read().Values, i, kv)
+			item.prev, item.due = root.Read().Values[i], root.Read().deadline(i)
+			item.old, item.found = item.prev.Value, true
+
+			if value, ok := item.put(item.old, true); ok {
+				root.Write().Values[i].Value = value
+
+				if item.retime {
+					root.Write().expire(i, item.expires)
+				}
+
+				item.replaced, item.kv, item.deadline = true, root.Read().Values[i], root.Read().deadline(i)
+			}
+
+			return root, root.Read().Values[0].Key, nil, *new(K)
+		}
+
+		value, ok := item.put(*new(V), false)
+
+		if !ok {
+			return root, root.Read().Values[0].Key, nil, *new(K)
 		}
 
+		item.inserted = true
+		kv := KeyValue[K, V]{Key: item.key, Value: value}
+		item.kv, item.deadline = kv, item.expires
+		root.Write().Values = slices.Insert(root.Read().Values, i, kv)
+		root.Write().timed(i, item.expires)
+
 		count := len(root.Read().Values)
 
-		if count <= t.Order {
+		if count <= t.capacity(true) {
 			return root, root.Read().Values[0].Key, nil, *new(K)
 		}
 
-		brother := t.Builder.Create(&Node[K, V]{Values: slices.Clone(root.Read().Values[count/2:])})
+		brother := t.Builder.Create(&Node[K, V]{Values: slices.Clone(root.Read().Values[count/2:]), Deadlines: root.Write().cut(count / 2)})
 
 		root.Write().Values = root.Read().Values[:count/2]
 
-		if root.Read().Next != nil {
-			brother.Read().Next = root.Read().Next
-			root.Read().Next.Write().Prev = brother
-		}
+		if !t.CopyOnWrite {
+			if root.Read().Next != nil {
+				brother.Read().Next = root.Read().Next
+				root.Read().Next.Write().Prev = brother
+			}
 
-		brother.Read().Prev = root
-		root.Write().Next = brother
+			brother.Read().Prev = root
+			root.Write().Next = brother
+		}
 
 		return root, root.Read().Values[0].Key, brother, brother.Read().Values[0].Key
 	}
 
-	parentIdx, found := slices.BinarySearch(root.Read().Mins, item.Key)
-
-	if !found {
-		parentIdx = parentIdx - 1
-	}
+	recount(root)
 
+	parentIdx := t.child(root.Read().Mins, item.key, true) - 1
 	parentMin := minimum
 
 	if parentIdx > -1 {
 		parentMin = root.Read().Mins[parentIdx]
 	}
 
-	parent := root.Read().Children[parentIdx+1]
+	parent := t.mutable(root, parentIdx+1)
 
 	_, parentMin, split, splitMin := t.insert(parent, parentMin, item)
 
+	if item.inserted {
+		root.Write().Counts[parentIdx+1]++
+	}
+
 	if split == nil {
+		t.regather(root, parentIdx+1)
+
 		if parentIdx > -1 {
 
 			if parentIdx == 0 {
@@ -327,25 +645,40 @@ func (t *Instance[K, V]) insert(root NodeDescriptor[K, V], minimum K, item KeyVa
 			return root, minimum, nil, *new(K)
 		}
 
-		return root, min(minimum, parentMin), nil, *new(K)
+		return root, t.min(minimum, parentMin), nil, *new(K)
 	}
 
 	root.Write().Children = slices.Insert(root.Read().Children, parentIdx+2, split)
 	root.Write().Mins = slices.Insert(root.Read().Mins, parentIdx+1, splitMin)
+	root.Write().Counts = slices.Insert(root.Read().Counts, parentIdx+2, weight(split))
+	root.Write().Counts[parentIdx+1] -= root.Read().Counts[parentIdx+2]
 
 	if parentIdx < 0 {
 		root.Write().Mins[0] = splitMin
 	}
 
-	count := len(root.Read().Children)
-
-	if count <= t.Order {
-		return root, min(minimum, parentMin), nil, *new(K)
+	if len(root.Read().Children) <= t.Order {
+		t.reaggregate(root)
+		return root, t.min(minimum, parentMin), nil, *new(K)
 	}
 
-	brother := t.Builder.Create(&Node[K, V]{Children: slices.Clone(root.Read().Children[count/2:])})
+	brother, brotherMin := t.divide(root)
+
+	return root, t.min(minimum, parentMin), brother, brotherMin
+}
+
+// divide moves the upper half of the children of an overfull internal node to a new brother,
+// and returns it with its minimum.
+func (t *Instance[K, V]) divide(root NodeDescriptor[K, V]) (NodeDescriptor[K, V], K) {
+	count := len(root.Read().Children)
+
+	brother := t.Builder.Create(&Node[K, V]{
+		Children: slices.Clone(root.Read().Children[count/2:]),
+		Counts:   slices.Clone(root.Read().Counts[count/2:]),
+	})
 
 	root.Write().Children = root.Read().Children[:count/2]
+	root.Write().Counts = root.Read().Counts[:count/2]
 
 	c := len(root.Read().Mins)
 
@@ -361,25 +694,58 @@ func (t *Instance[K, V]) insert(root NodeDescriptor[K, V], minimum K, item KeyVa
 		root.Write().Mins = root.Read().Mins[:c/2]
 	}
 
-	return root, min(minimum, parentMin), brother, brotherMin
+	t.reaggregate(root)
+	t.reaggregate(brother)
+
+	return brother, brotherMin
 }
 
-func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V, bool, K) {
+func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], item *deletion[K, V], minimum K) (V, bool, K) {
 	if root == nil {
 		return *new(V), false, minimum
 	}
 
 	if root.Read().Leaf() {
-		i, found := slices.BinarySearchFunc(root.Read().Values, key, func(a KeyValue[K, V], b K) int {
-			return cmp.Compare(a.Key, b)
-		})
+		values := root.Read().Values
+
+		if item.edge != 0 && len(values) > 0 {
+			if item.edge > 0 {
+				item.key = values[len(values)-1].Key
+			} else {
+				item.key = values[0].Key
+			}
+		}
+
+		i := t.search(values, item.key, false)
+
+		if item.edge > 0 {
+			i = max(len(values)-1, 0)
+		}
+
+		for ; i < len(values) && t.compare(values[i].Key, item.key) == 0; i++ {
+			if item.match != nil && !item.match(values[i].Value) {
+				continue
+			}
+
+			if deadline := root.Read().deadline(i); item.expired != 0 && (deadline == 0 || deadline > item.expired) {
+				continue
+			}
+
+			if item.skip == 0 {
+				break
+			}
+
+			item.skip--
+		}
 
-		if !found {
+		if i == len(values) || t.compare(values[i].Key, item.key) != 0 {
 			return *new(V), false, minimum
 		}
 
-		v := root.Read().Values[i].Value
+		item.kv, item.deadline = root.Read().Values[i], root.Read().deadline(i)
+		v := item.kv.Value
 		root.Write().Values = slices.Delete(root.Read().Values, i, i+1)
+		root.Write().untimed(i, i+1)
 
 		if len(root.Read().Values) == 0 {
 			return v, true, *new(K)
@@ -388,35 +754,57 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 		return v, true, root.Read().Values[0].Key
 	}
 
-	parentIdx, found := slices.BinarySearch(root.Read().Mins, key)
+	recount(root)
 
-	if !found {
-		parentIdx = parentIdx - 1
-	}
+	var v V
+	var deleted bool
+	var parent NodeDescriptor[K, V]
+	var parentIdx int
+	var parentMin K
 
-	parent := root.Read().Children[parentIdx+1]
-	parentMin := minimum
+	// in duplicates mode, a run of equal keys may span several children
+	first, last := t.child(root.Read().Mins, item.key, false), t.child(root.Read().Mins, item.key, true)
 
-	if parentIdx > -1 {
-		parentMin = root.Read().Mins[parentIdx]
+	if item.edge < 0 {
+		first, last = 0, 0
+	} else if item.edge > 0 {
+		first, last = len(root.Read().Children)-1, len(root.Read().Children)-1
 	}
 
-	v, deleted, parentMin := t.delete(parent, key, parentMin)
+	for i := first; i <= last && !deleted; i++ {
+		parentIdx = i - 1
+		parent = t.mutable(root, i)
+		parentMin = minimum
+
+		if parentIdx > -1 {
+			parentMin = root.Read().Mins[parentIdx]
+		}
+
+		v, deleted, parentMin = t.delete(parent, item, parentMin)
+	}
 
 	if !deleted {
 		return v, deleted, minimum
 	}
 
+	root.Write().Counts[parentIdx+1]--
+
+	// keep the separator the minimum of its child
+	if parentIdx > -1 && t.compare(root.Read().Mins[parentIdx], parentMin) != 0 {
+		root.Write().Mins[parentIdx] = parentMin
+	}
+
 	newMin := minimum
 
 	if parentIdx < 0 {
 		newMin = parentMin
 	}
 
-	childMin := int(math.Ceil(float64(t.Order) / 2))
+	childMin := t.least(parent.Read().Leaf())
 	parentCount := parent.Read().Count()
 
 	if childMin <= parentCount {
+		t.regather(root, parentIdx+1)
 		return v, deleted, newMin
 	}
 
@@ -426,11 +814,11 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 
 	if parentIdx < 0 {
 		uncleIdx = parentIdx + 1
-		rightUncle = root.Read().Children[uncleIdx+1]
+		rightUncle = t.mutable(root, uncleIdx+1)
 		uncleCount = rightUncle.Read().Count()
 	} else {
 		uncleIdx = parentIdx - 1
-		leftUncle = root.Read().Children[uncleIdx+1]
+		leftUncle = t.mutable(root, uncleIdx+1)
 		uncleCount = leftUncle.Read().Count()
 	}
 
@@ -440,18 +828,28 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 
 			if leftUncle != nil {
 				// from left to right
-				kv := leftUncle.Read().Values[uncleCount-1]
+				kv, deadline := leftUncle.Read().Values[uncleCount-1], leftUncle.Read().deadline(uncleCount-1)
 				parent.Write().Values = slices.Insert(parent.Read().Values, 0, kv)
+				parent.Write().timed(0, deadline)
 				leftUncle.Write().Values = leftUncle.Read().Values[:uncleCount-1]
+				leftUncle.Write().untimed(uncleCount-1, uncleCount)
 				parentMin = kv.Key
 				root.Write().Mins[parentIdx] = parentMin
 			} else {
 				// from right to left
+				deadline := rightUncle.Read().deadline(0)
 				parent.Write().Values = append(parent.Read().Values, rightUncle.Read().Values[0])
+				parent.Write().timed(len(parent.Read().Values)-1, deadline)
 				rightUncle.Write().Values = rightUncle.Read().Values[1:]
+				rightUncle.Write().untimed(0, 1)
 				root.Write().Mins[uncleIdx] = rightUncle.Read().Values[0].Key
 			}
 
+			root.Write().Counts[parentIdx+1]++
+			root.Write().Counts[uncleIdx+1]--
+			t.regather(root, parentIdx+1)
+			t.regather(root, uncleIdx+1)
+
 			return v, deleted, newMin
 		}
 
@@ -460,14 +858,18 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 
 		if leftUncle != nil {
 			// from right parent to left uncle
+			deadlines := spread(leftUncle.Read(), parent.Read())
 			leftUncle.Write().Values = append(leftUncle.Read().Values, parent.Read().Values...)
+			leftUncle.Write().Deadlines = deadlines
 		} else {
 			// from left parent to right uncle
+			deadlines := spread(parent.Read(), rightUncle.Read())
 			rightUncle.Write().Values = append(parent.Read().Values, rightUncle.Read().Values...)
+			rightUncle.Write().Deadlines = deadlines
 			root.Write().Mins[uncleIdx] = rightUncle.Read().Values[0].Key
 		}
 
-		parent.Write().Values = nil
+		parent.Write().Values, parent.Write().Deadlines = nil, nil
 
 		if parent.Read().Prev != nil && parent.Read().Next != nil {
 			// middle
@@ -481,6 +883,8 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 		}
 
 		t.Builder.Delete(parent)
+		root.Write().Counts[uncleIdx+1] += root.Read().Counts[parentIdx+1]
+		root.Write().Counts = slices.Delete(root.Read().Counts, parentIdx+1, parentIdx+2)
 		root.Write().Children = slices.Delete(root.Read().Children, parentIdx+1, parentIdx+2)
 
 		if parentIdx < 0 {
@@ -489,32 +893,62 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 			root.Write().Mins = slices.Delete(root.Read().Mins, parentIdx, parentIdx+1)
 		}
 
+		t.reaggregate(root)
+
 		return v, deleted, newMin
 	}
 
 	// not a leaf
 
+	if leftUncle != nil {
+		recount(leftUncle)
+	} else {
+		recount(rightUncle)
+	}
+
 	if uncleCount > childMin {
 		// transfer child from uncle to parent
 
+		var w int
+
 		if leftUncle != nil {
 			// from left to right
 			kv := leftUncle.Read().Children[uncleCount-1]
+			w = leftUncle.Read().Counts[uncleCount-1]
 			parent.Write().Children = slices.Insert(parent.Read().Children, 0, kv)
+			parent.Write().Counts = slices.Insert(parent.Read().Counts, 0, w)
 			leftUncle.Write().Children = leftUncle.Read().Children[:uncleCount-1]
+			leftUncle.Write().Counts = leftUncle.Read().Counts[:uncleCount-1]
 			parent.Write().Mins = slices.Insert(parent.Read().Mins, 0, parentMin)
 			parentMin = leftUncle.Read().Mins[uncleCount-2]
 			leftUncle.Write().Mins = leftUncle.Read().Mins[:uncleCount-2]
 			root.Write().Mins[parentIdx] = parentMin
 		} else {
 			// from right to left
+			w = rightUncle.Read().Counts[0]
 			parent.Write().Children = append(parent.Read().Children, rightUncle.Read().Children[0])
+			parent.Write().Counts = append(parent.Read().Counts, w)
 			rightUncle.Write().Children = rightUncle.Read().Children[1:]
+			rightUncle.Write().Counts = rightUncle.Read().Counts[1:]
 			parent.Write().Mins = append(parent.Read().Mins, root.Read().Mins[uncleIdx])
 			root.Write().Mins[uncleIdx] = rightUncle.Read().Mins[0]
 			rightUncle.Write().Mins = rightUncle.Read().Mins[1:]
 		}
 
+		root.Write().Counts[parentIdx+1] += w
+		root.Write().Counts[uncleIdx+1] -= w
+
+		t.reaggregate(parent)
+
+		if leftUncle != nil {
+			t.reaggregate(leftUncle)
+		} else {
+			t.reaggregate(rightUncle)
+		}
+
+		t.regather(root, parentIdx+1)
+		t.regather(root, uncleIdx+1)
+
 		return v, deleted, newMin
 	}
 
@@ -524,16 +958,20 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 	if leftUncle != nil {
 		// from right parent to left uncle
 		leftUncle.Write().Children = append(leftUncle.Read().Children, parent.Read().Children...)
+		leftUncle.Write().Counts = append(leftUncle.Read().Counts, parent.Read().Counts...)
 		leftUncle.Write().Mins = append(append(leftUncle.Read().Mins, parentMin), parent.Read().Mins...)
 	} else {
 		// from left parent to right uncle
 		rightUncle.Write().Children = append(parent.Read().Children, rightUncle.Read().Children...)
+		rightUncle.Write().Counts = append(parent.Read().Counts, rightUncle.Read().Counts...)
 		rightUncle.Write().Mins = append(append(parent.Read().Mins, root.Read().Mins[uncleIdx]), rightUncle.Read().Mins...)
 		root.Write().Mins[uncleIdx] = parentMin
 	}
 
-	parent.Read().Children = nil
+	parent.Write().Children = nil
 	t.Builder.Delete(parent)
+	root.Write().Counts[uncleIdx+1] += root.Read().Counts[parentIdx+1]
+	root.Write().Counts = slices.Delete(root.Read().Counts, parentIdx+1, parentIdx+2)
 	root.Write().Children = slices.Delete(root.Read().Children, parentIdx+1, parentIdx+2)
 
 	if parentIdx < 0 {
@@ -542,32 +980,82 @@ func (t *Instance[K, V]) delete(root NodeDescriptor[K, V], key K, minimum K) (V,
 		root.Write().Mins = slices.Delete(root.Read().Mins, parentIdx, parentIdx+1)
 	}
 
+	if leftUncle != nil {
+		t.reaggregate(leftUncle)
+	} else {
+		t.reaggregate(rightUncle)
+	}
+
+	t.reaggregate(root)
+
 	return v, deleted, newMin
 }
 
-func find[K constraints.Ordered, V any](root NodeDescriptor[K, V], key K) (NodeDescriptor[K, V], int, bool) {
+func (t *Instance[K, V]) find(key K) (path[K, V], NodeDescriptor[K, V], int, bool) {
+	p, node, i := t.walk(key, false)
+
+	if node == nil {
+		return nil, nil, 0, false
+	}
+
+	if t.Duplicates && i == len(node.Read().Values) {
+		// a run of equal keys may start at the following leaf
+		if next := t.next(&p, node); next != nil {
+			node, i = next, 0
+		}
+	}
+
+	return p, node, i, i < len(node.Read().Values) && t.compare(node.Read().Values[i].Key, key) == 0
+}
+
+// seek returns the leaf and the index of the first key-value pair whose key is not less than
+// the given key, or greater than it if after is set. The index may be past the last pair of the leaf.
+func (t *Instance[K, V]) seek(root NodeDescriptor[K, V], key K, after bool) (NodeDescriptor[K, V], int) {
 	if root == nil {
-		return nil, *new(int), false
+		return nil, 0
 	}
 
 	if root.Read().Leaf() {
-		i, found := slices.BinarySearchFunc(root.Read().Values, key, func(a KeyValue[K, V], b K) int {
-			return cmp.Compare(a.Key, b)
-		})
-
-		return root, i, found
+		return root, t.search(root.Read().Values, key, after)
 	}
 
-	i, found := slices.BinarySearch(root.Read().Mins, key)
+	return t.seek(root.Read().Children[t.child(root.Read().Mins, key, after)], key, after)
+}
+
+// search returns the index of the first key-value pair whose key is not less than
+// the given key, or greater than it if after is set.
+func (t *Instance[K, V]) search(values []KeyValue[K, V], key K, after bool) int {
+	return sort.Search(len(values), func(i int) bool {
+		c := t.compare(values[i].Key, key)
+		return c > 0 || (c == 0 && !after)
+	})
+}
+
+// child returns the index of the child that holds the first key-value pair whose key is not less
+// than the given key, or greater than it if after is set. Without duplicates, equal keys are never
+// stored left of their minimum, so both cases descend to the same child.
+func (t *Instance[K, V]) child(mins []K, key K, after bool) int {
+	return sort.Search(len(mins), func(i int) bool {
+		c := t.compare(mins[i], key)
+		return c > 0 || (c == 0 && !after && t.Duplicates)
+	})
+}
 
-	if found {
-		return find(root.Read().Children[i+1], key)
+// capacity returns the maximum number of entries of a node, pairs for a leaf and children otherwise.
+func (t *Instance[K, V]) capacity(leaf bool) int {
+	if leaf && t.LeafCapacity > 0 {
+		return t.LeafCapacity
 	}
 
-	return find(root.Read().Children[i], key)
+	return t.Order
+}
+
+// least returns the minimum number of entries of a node other than the root.
+func (t *Instance[K, V]) least(leaf bool) int {
+	return (t.capacity(leaf) + 1) / 2
 }
 
-func minimum[K constraints.Ordered, V any](root NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+func minimum[K any, V any](root NodeDescriptor[K, V]) NodeDescriptor[K, V] {
 	if root == nil || root.Read().Leaf() {
 		return root
 	}
@@ -575,7 +1063,7 @@ func minimum[K constraints.Ordered, V any](root NodeDescriptor[K, V]) NodeDescri
 	return minimum(root.Read().Children[0])
 }
 
-func maximum[K constraints.Ordered, V any](root NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+func maximum[K any, V any](root NodeDescriptor[K, V]) NodeDescriptor[K, V] {
 	if root == nil || root.Read().Leaf() {
 		return root
 	}
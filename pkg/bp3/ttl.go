@@ -0,0 +1,269 @@
+package bp3
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+	"time"
+)
+
+// InsertWithTTL adds a key-value pair to the B+ Tree that expires after the given duration, replacing
+// the value of an existing key, as Insert does. An expired pair is hidden from Find, the sequences and
+// the cursors, and so from Floor, Ceiling, Lower, Higher, Nearest, First, Last, Minimum and Maximum.
+// PopMin and PopMax skip it, PopMinN removes it without returning it, and the other writes treat it
+// as absent, until ExpireNow removes it. It is still included in Count and in the positional and
+// aggregate queries until then.
+func (t *Instance[K, V]) InsertWithTTL(key K, value V, ttl time.Duration) (V, bool) {
+	item := &insertion[K, V]{key: key, expires: t.now() + int64(ttl), retime: true, put: func(V, bool) (V, bool) {
+		return value, true
+	}}
+
+	t.put(item)
+
+	return item.old, item.found
+}
+
+// ExpireNow removes the expired key-value pairs from the instance and returns their number. The
+// deadlines are taken from the expiry index in deadline order, so that only the expired pairs are
+// visited. The index holds a deadline for each pair that has one: the writes that replace or remove
+// such pairs remove their deadlines, and SplitAt and Join move them with the pairs.
+func (t *Instance[K, V]) ExpireNow() int {
+	if t.Expiry == nil {
+		return 0
+	}
+
+	now := t.now()
+	n := 0
+
+	for {
+		deadline, key, found := t.Expiry.First()
+
+		if !found || deadline > now {
+			return n
+		}
+
+		if _, deleted := t.remove(&deletion[K, V]{key: key, expired: now}); deleted {
+			n++
+		} else {
+			// a deadline left behind by an index stored before the deadlines were removed with the pairs
+			t.Expiry.PopMin()
+		}
+	}
+}
+
+// deadlines returns the expiry index, created if it was not.
+func (t *Instance[K, V]) deadlines() *Instance[int64, K] {
+	if t.Expiry == nil {
+		t.Expiry = NewFunc[int64, K](cmp.Compare[int64], WithOrder(t.Order), WithDuplicates())
+		t.Expiry.CopyOnWrite = t.CopyOnWrite
+	}
+
+	return t.Expiry
+}
+
+// schedule adds the deadline of a key to the expiry index, unless it is zero.
+func (t *Instance[K, V]) schedule(key K, deadline int64) {
+	if deadline != 0 {
+		t.deadlines().Insert(deadline, key)
+	}
+}
+
+// unschedule removes the deadline of a key from the expiry index, unless it is zero.
+func (t *Instance[K, V]) unschedule(key K, deadline int64) {
+	if deadline != 0 && t.Expiry != nil {
+		t.Expiry.DeleteOne(deadline, func(k K) bool {
+			return t.compare(k, key) == 0
+		})
+	}
+}
+
+// scheduled returns true if any key-value pair of the instance has a deadline.
+func (t *Instance[K, V]) scheduled() bool {
+	return t.Expiry != nil && t.Expiry.Size > 0
+}
+
+// partition moves the deadlines of the expiry index to two new ones, of the key-value pairs whose keys
+// are less than the given key, and of the rest, and leaves it empty. Both are nil if there is no index.
+func (t *Instance[K, V]) partition(key K) (*Instance[int64, K], *Instance[int64, K]) {
+	if t.Expiry == nil {
+		return nil, nil
+	}
+
+	part := func(less bool) iter.Seq2[int64, K] {
+		return func(yield func(int64, K) bool) {
+			for deadline, k := range t.Expiry.scan(nil, nil, false) {
+				if (t.compare(k, key) < 0) == less && !yield(deadline, k) {
+					return
+				}
+			}
+		}
+	}
+
+	left, right := t.Expiry.sibling(), t.Expiry.sibling()
+
+	// the deadlines are in ascending order, and equal ones are allowed
+	_ = left.Build(part(true), 1)
+	_ = right.Build(part(false), 1)
+
+	t.Expiry.reset()
+
+	return left, right
+}
+
+// merge returns an index of the deadlines of two expiry indexes, either of which may be nil,
+// and leaves them empty. The nodes of an index are reused if the other one is empty.
+func merge[K any](a, b *Instance[int64, K]) *Instance[int64, K] {
+	if a == nil {
+		a, b = b, nil
+	}
+
+	if a == nil {
+		return nil
+	}
+
+	index := a.sibling()
+
+	if b == nil || b.Root == nil || a.Root == nil {
+		from := a
+
+		if a.Root == nil && b != nil {
+			from = b
+		}
+
+		index.Root, index.Min, index.Size = from.Root, from.Min, from.Size
+		from.Root, from.Min, from.Size = nil, 0, 0
+		from.Version++
+
+		return index
+	}
+
+	seq := func(yield func(int64, K) bool) {
+		next, stop := iter.Pull2(b.scan(nil, nil, false))
+		defer stop()
+
+		d, k, ok := next()
+
+		for deadline, key := range a.scan(nil, nil, false) {
+			for ; ok && d < deadline; d, k, ok = next() {
+				if !yield(d, k) {
+					return
+				}
+			}
+
+			if !yield(deadline, key) {
+				return
+			}
+		}
+
+		for ; ok; d, k, ok = next() {
+			if !yield(d, k) {
+				return
+			}
+		}
+	}
+
+	// the deadlines are in ascending order, and equal ones are allowed
+	_ = index.Build(seq, 1)
+
+	a.reset()
+	b.reset()
+
+	return index
+}
+
+// reset deletes the nodes of the instance and leaves it empty.
+func (t *Instance[K, V]) reset() {
+	if t.Root != nil {
+		t.drop(t.Root)
+	}
+
+	t.Root, t.Min, t.Size = nil, *new(K), 0
+	t.Version++
+}
+
+// now returns the current time of the instance clock, in Unix nanoseconds.
+func (t *Instance[K, V]) now() int64 {
+	if t.Clock != nil {
+		return t.Clock().UnixNano()
+	}
+
+	return time.Now().UnixNano()
+}
+
+// expired returns true if the i-th key-value pair of a leaf has a deadline that has passed.
+func (t *Instance[K, V]) expired(node *Node[K, V], i int) bool {
+	deadline := node.deadline(i)
+	return deadline != 0 && deadline <= t.now()
+}
+
+// deadline returns the deadline of the i-th key-value pair of a leaf, zero if it does not expire.
+func (n *Node[K, V]) deadline(i int) int64 {
+	if n.Deadlines == nil {
+		return 0
+	}
+
+	return n.Deadlines[i]
+}
+
+// expire sets the deadline of the i-th key-value pair of a leaf, creating the deadlines of the leaf
+// if it is the first one.
+func (n *Node[K, V]) expire(i int, deadline int64) {
+	if n.Deadlines == nil {
+		if deadline == 0 {
+			return
+		}
+
+		n.Deadlines = make([]int64, len(n.Values))
+	}
+
+	n.Deadlines[i] = deadline
+}
+
+// timed inserts the deadline of a key-value pair that was inserted at i into the values of a leaf.
+func (n *Node[K, V]) timed(i int, deadline int64) {
+	if n.Deadlines != nil {
+		n.Deadlines = slices.Insert(n.Deadlines, i, deadline)
+	} else {
+		n.expire(i, deadline)
+	}
+}
+
+// untimed removes the deadlines of the key-value pairs that were removed from i to j from the values of a leaf.
+func (n *Node[K, V]) untimed(i, j int) {
+	if n.Deadlines != nil {
+		n.Deadlines = slices.Delete(n.Deadlines, i, j)
+	}
+}
+
+// spread returns the deadlines of the key-value pairs of leaves in their order, or nil if none of
+// the leaves has deadlines. It is called before the pairs are moved between the leaves.
+func spread[K any, V any](leaves ...*Node[K, V]) []int64 {
+	if !slices.ContainsFunc(leaves, func(n *Node[K, V]) bool { return n.Deadlines != nil }) {
+		return nil
+	}
+
+	var deadlines []int64
+
+	for _, n := range leaves {
+		if n.Deadlines != nil {
+			deadlines = append(deadlines, n.Deadlines...)
+		} else {
+			deadlines = append(deadlines, make([]int64, len(n.Values))...)
+		}
+	}
+
+	return deadlines
+}
+
+// cut returns a copy of the deadlines of a leaf from i on, which are moved to a new leaf with the
+// pairs from i on, and keeps those before i. It returns nil if the leaf has no deadlines.
+func (n *Node[K, V]) cut(i int) []int64 {
+	if n.Deadlines == nil {
+		return nil
+	}
+
+	moved := slices.Clone(n.Deadlines[i:])
+	n.Deadlines = n.Deadlines[:i]
+
+	return moved
+}
@@ -0,0 +1,486 @@
+package bp3_test
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+// clock is a fake clock for deadlines, advanced by the tests.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestTTL(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithClock(c.Now))
+
+	for i := range 100 {
+		tree.InsertWithTTL(i, i, time.Duration(i%10+1)*time.Second)
+	}
+
+	for i := 100; i < 120; i++ {
+		tree.Insert(i, i)
+	}
+
+	// 2 is replaced by a pair that does not expire
+	tree.Insert(2, -2)
+
+	count := func() int {
+		n := 0
+
+		for range tree.FromClosed(0) {
+			n++
+		}
+
+		return n
+	}
+
+	if n := count(); n != 120 {
+		t.Fatalf("%d pairs before expiry", n)
+	}
+
+	c.now = c.now.Add(3 * time.Second)
+
+	// the pairs with a ttl of 1, 2 and 3 seconds expired, except for 2
+	if n := count(); n != 120-30+1 {
+		t.Fatalf("%d pairs after 3 seconds", n)
+	}
+
+	if _, found := tree.Find(12); found {
+		t.Fatal("expired pair found")
+	}
+
+	if v, found := tree.Find(2); !found || v != -2 {
+		t.Fatalf("replaced pair %d, %v", v, found)
+	}
+
+	for k := range tree.Backward() {
+		if k < 100 && k != 2 && k%10 < 3 {
+			t.Fatalf("expired key %d", k)
+		}
+	}
+
+	// an expired pair is absent to writes
+	if tree.InsertIfAbsent(21, 21) != true {
+		t.Fatal("insert over an expired pair failed")
+	}
+
+	if tree.Count() != 120 {
+		t.Fatalf("count %d before ExpireNow", tree.Count())
+	}
+
+	if n := tree.ExpireNow(); n != 28 {
+		t.Fatalf("%d pairs expired", n)
+	}
+
+	if tree.Count() != 92 || tree.ExpireNow() != 0 {
+		t.Fatalf("count %d after ExpireNow", tree.Count())
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.now = c.now.Add(time.Hour)
+
+	if n := tree.ExpireNow(); n != 70 {
+		t.Fatalf("%d pairs expired", n)
+	}
+
+	if tree.Expiry.Count() != 0 {
+		t.Fatalf("%d deadlines left", tree.Expiry.Count())
+	}
+}
+
+func TestTTLDuplicates(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates(), bp3.WithClock(c.Now))
+
+	for i := range 30 {
+		tree.InsertWithTTL(i%3, i, time.Duration(i%2+1)*time.Second)
+	}
+
+	c.now = c.now.Add(time.Second)
+
+	if n := tree.ExpireNow(); n != 15 {
+		t.Fatalf("%d pairs expired", n)
+	}
+
+	for v := range tree.FindAll(1) {
+		if v%2 == 0 {
+			t.Fatalf("expired value %d", v)
+		}
+	}
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTTLLookups(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithClock(c.Now))
+	expires := func(k int) bool { return k < 5 || k > 54 || k%3 == 0 }
+
+	var live []int
+
+	for k := range 60 {
+		if expires(k) {
+			tree.InsertWithTTL(k, k, time.Second)
+		} else {
+			tree.Insert(k, k)
+			live = append(live, k)
+		}
+	}
+
+	c.now = c.now.Add(time.Second)
+
+	if k, _, ok := tree.First(); !ok || k != live[0] {
+		t.Fatalf("first %d, %v", k, ok)
+	}
+
+	if k, _, ok := tree.Last(); !ok || k != live[len(live)-1] {
+		t.Fatalf("last %d, %v", k, ok)
+	}
+
+	if tree.Minimum() != live[0] || tree.Maximum() != live[len(live)-1] {
+		t.Fatalf("minimum %d, maximum %d", tree.Minimum(), tree.Maximum())
+	}
+
+	for key := -1; key <= 60; key++ {
+		lookups := []struct {
+			name   string
+			lookup func(int) (int, int, bool)
+			match  func(int) bool
+			back   bool
+		}{
+			{"floor", tree.Floor, func(k int) bool { return k <= key }, true},
+			{"ceiling", tree.Ceiling, func(k int) bool { return k >= key }, false},
+			{"lower", tree.Lower, func(k int) bool { return k < key }, true},
+			{"higher", tree.Higher, func(k int) bool { return k > key }, false},
+		}
+
+		for _, l := range lookups {
+			// the expected neighbour is the closest matching live key
+			want, exists := 0, false
+
+			for _, k := range live {
+				if l.match(k) && (!exists || l.back) {
+					want, exists = k, true
+				}
+			}
+
+			if k, _, ok := l.lookup(key); ok != exists || k != want {
+				t.Fatalf("%s of %d is %d, %v, expected %d, %v", l.name, key, k, ok, want, exists)
+			}
+		}
+
+		for k := range tree.Nearest(key, 4, func(a, b int) float64 { return math.Abs(float64(a - b)) }) {
+			if expires(k) {
+				t.Fatalf("expired key %d near %d", k, key)
+			}
+		}
+	}
+
+	var forward, backward []int
+
+	cur := tree.Cursor()
+
+	for ok := cur.SeekFirst(); ok; ok = cur.Next() {
+		forward = append(forward, cur.Key())
+	}
+
+	for ok := cur.SeekLast(); ok; ok = cur.Prev() {
+		backward = append(backward, cur.Key())
+	}
+
+	slices.Reverse(backward)
+
+	if !slices.Equal(forward, live) || !slices.Equal(backward, live) {
+		t.Fatalf("cursor visited %v and %v", forward, backward)
+	}
+
+	// deleting through a cursor moves it to the next live pair
+	if !cur.Seek(7) {
+		t.Fatal("seek failed")
+	} else if _, ok := cur.Delete(); !ok || cur.Key() != 8 {
+		t.Fatalf("cursor at %d after delete", cur.Key())
+	}
+
+	if k, _, ok := tree.PopMin(); !ok || k != 5 {
+		t.Fatalf("pop min %d, %v", k, ok)
+	}
+
+	if k, _, ok := tree.PopMax(); !ok || k != 53 {
+		t.Fatalf("pop max %d, %v", k, ok)
+	}
+
+	// the expired pairs before the popped ones, 0 to 4, 6 and 9, are removed as well
+	count := tree.Count()
+
+	if s := tree.PopMinN(3); len(s) != 3 || s[0].Key != 8 || s[1].Key != 10 || s[2].Key != 11 {
+		t.Fatalf("pop min n %v", s)
+	}
+
+	if n := count - tree.Count(); n != 10 {
+		t.Fatalf("%d pairs removed by PopMinN", n)
+	}
+
+	scheduled(t, tree)
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTTLLookupsDuplicates(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithDuplicates(), bp3.WithClock(c.Now))
+
+	for i := range 12 {
+		if i%2 == 0 {
+			tree.InsertWithTTL(i/4, i, time.Second)
+		} else {
+			tree.Insert(i/4, i)
+		}
+	}
+
+	c.now = c.now.Add(time.Second)
+
+	if k, v, ok := tree.PopMin(); !ok || k != 0 || v != 1 {
+		t.Fatalf("pop min %d: %d, %v", k, v, ok)
+	}
+
+	if k, v, ok := tree.PopMax(); !ok || k != 2 || v != 11 {
+		t.Fatalf("pop max %d: %d, %v", k, v, ok)
+	}
+
+	// the cursor removes the live pair of its run, not an expired one before it
+	if cur := tree.Cursor(); !cur.Seek(1) || cur.Value() != 5 {
+		t.Fatal("seek failed")
+	} else if _, ok := cur.Delete(); !ok || cur.Value() != 7 {
+		t.Fatalf("cursor at %d after delete", cur.Value())
+	}
+
+	if tree.Count() != 9 || tree.ExpireNow() != 6 {
+		t.Fatalf("count %d", tree.Count())
+	}
+
+	var values []int
+
+	for _, v := range tree.FromClosed(0) {
+		values = append(values, v)
+	}
+
+	if !slices.Equal(values, []int{3, 7, 9}) {
+		t.Fatalf("values %v", values)
+	}
+
+	scheduled(t, tree)
+}
+
+// scheduled verifies that the expiry index holds a deadline for each pair that has one, and no other.
+func scheduled(t *testing.T, tree *bp3.Instance[int, int]) {
+	t.Helper()
+
+	var want, got []bp3.KeyValue[int64, int]
+	var leaves func(d bp3.NodeDescriptor[int, int])
+
+	leaves = func(d bp3.NodeDescriptor[int, int]) {
+		node := d.Read()
+
+		for _, child := range node.Children {
+			leaves(child)
+		}
+
+		if node.Deadlines != nil && len(node.Deadlines) != len(node.Values) {
+			t.Fatalf("%d deadlines for %d pairs", len(node.Deadlines), len(node.Values))
+		}
+
+		for i, deadline := range node.Deadlines {
+			if deadline != 0 {
+				want = append(want, bp3.KeyValue[int64, int]{Key: deadline, Value: node.Values[i].Key})
+			}
+		}
+	}
+
+	if tree.Root != nil {
+		leaves(tree.Root)
+	}
+
+	if tree.Expiry != nil {
+		if err := tree.Expiry.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		got = bp3.Slice(tree.Expiry.Root)
+
+		if tree.Expiry.Size != len(got) {
+			t.Fatalf("expiry size %d, %d deadlines", tree.Expiry.Size, len(got))
+		}
+	}
+
+	order := func(a, b bp3.KeyValue[int64, int]) int {
+		return cmp.Or(cmp.Compare(a.Key, b.Key), cmp.Compare(a.Value, b.Value))
+	}
+
+	slices.SortFunc(want, order)
+	slices.SortFunc(got, order)
+
+	if !slices.EqualFunc(want, got, func(a, b bp3.KeyValue[int64, int]) bool { return order(a, b) == 0 }) {
+		t.Fatalf("%d pairs with a ttl, %d deadlines: %v != %v", len(want), len(got), want, got)
+	}
+}
+
+func TestTTLIndex(t *testing.T) {
+	test := func(order int, options ...bp3.Option) {
+		c := &clock{now: time.Unix(1000, 0)}
+		r := rand.New(rand.NewSource(int64(order)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order), bp3.WithClock(c.Now))...)
+
+		var tx *bp3.Tx[int, int]
+
+		points := 0
+
+		for i := range 3000 {
+			k := r.Intn(300)
+
+			switch r.Intn(14) {
+			case 0:
+				tree.Delete(k)
+			case 1:
+				tree.DeleteRange(bp3.RangeValue[int]{Value: k, Closed: true}, bp3.RangeValue[int]{Value: k + r.Intn(20), Closed: r.Intn(2) == 0})
+			case 2:
+				tree.PopMinN(r.Intn(10))
+			case 3:
+				tree.PopMax()
+			case 4:
+				tree.Replace(k, i)
+			case 5:
+				tree.Update(k, func(old int, ok bool) (int, bool) { return i, r.Intn(2) == 0 })
+			case 6:
+				c.now = c.now.Add(time.Duration(r.Intn(3)) * time.Second)
+				tree.ExpireNow()
+			case 7:
+				if tx == nil {
+					left, right := tree.SplitAt(k)
+					scheduled(t, left)
+					scheduled(t, right)
+
+					joined, err := bp3.Join(left, right)
+
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					*tree = *joined
+				}
+			case 8:
+				if tx == nil {
+					tx, points = tree.Begin(), 1
+				} else if r.Intn(3) == 0 {
+					points = r.Intn(points) + 1
+					tx.RollbackTo(points - 1)
+				} else if r.Intn(2) == 0 {
+					tx.Rollback()
+					tx = nil
+				} else {
+					tx.Commit()
+					tx = nil
+				}
+			case 9:
+				if tx != nil {
+					points = tx.Savepoint() + 1
+				}
+			case 10, 11:
+				tree.Insert(k, i)
+			default:
+				tree.InsertWithTTL(k, i, time.Duration(r.Intn(5)+1)*time.Second)
+			}
+
+			scheduled(t, tree)
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, order := range []int{3, 4, 5, 8} {
+		test(order)
+		test(order, bp3.WithDuplicates())
+		test(order, bp3.WithCopyOnWrite())
+	}
+}
+
+func TestTTLTxLazy(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	tree := bp3.New[int, int](bp3.WithOrder(3), bp3.WithClock(c.Now))
+
+	for i := range 20 {
+		tree.Insert(i, i)
+	}
+
+	tx := tree.Begin()
+	tx.Insert(20, 20)
+	tx.Commit()
+
+	// a transaction without a ttl insert does not create the expiry index
+	if tree.Expiry != nil {
+		t.Fatal("expiry index created by a transaction")
+	}
+
+	tx = tree.Begin()
+	tx.InsertWithTTL(1, -1, time.Second)
+	tx.Savepoint()
+	tx.InsertWithTTL(2, -2, time.Second)
+	p := tx.Savepoint()
+	tx.InsertWithTTL(3, -3, time.Second)
+	tx.RollbackTo(p)
+
+	if tree.Expiry == nil || tree.Expiry.Count() != 2 {
+		t.Fatal("deadlines not restored")
+	}
+
+	scheduled(t, tree)
+	tx.RollbackTo(1)
+
+	if tree.Expiry.Count() != 1 {
+		t.Fatalf("%d deadlines", tree.Expiry.Count())
+	}
+
+	scheduled(t, tree)
+	tx.Rollback()
+
+	if tree.Expiry != nil {
+		t.Fatal("expiry index not removed")
+	}
+
+	c.now = c.now.Add(time.Second)
+
+	if v, found := tree.Find(1); !found || v != 1 {
+		t.Fatalf("rolled back pair %d, %v", v, found)
+	}
+
+	// once created, the index is journaled from the beginning of a transaction
+	tree.InsertWithTTL(30, 30, time.Second)
+	tx = tree.Begin()
+	tx.InsertWithTTL(31, 31, time.Second)
+	tx.Rollback()
+
+	if tree.Expiry.Count() != 1 {
+		t.Fatalf("%d deadlines", tree.Expiry.Count())
+	}
+
+	scheduled(t, tree)
+}
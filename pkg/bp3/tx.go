@@ -0,0 +1,123 @@
+package bp3
+
+// Tx is a transaction over an instance, with the read and write API of the instance. Its changes are
+// made in place, so that reads (through the transaction or the instance) see them, and are undone
+// by Rollback, or by RollbackTo back to a savepoint. Beginning a transaction on a transaction nests
+// it in the enclosing one, and nested transactions must end before the ones they are nested in.
+// A transaction must not be used after it ends with Commit or Rollback. The expiry index of the
+// instance is changed in a transaction of its own, with the same savepoints, from the first savepoint
+// taken while it exists. Restoring a savepoint taken before it was created removes it. Rolling back calls
+// the hooks of the instance for the reverse of the changes it undoes, see OnInsert.
+type Tx[K any, V any] struct {
+	*Instance[K, V]
+	journal    NodeJournal
+	savepoints []savepoint[K, V]
+	expiry     *Tx[int64, K]
+}
+
+// savepoint is the state of the instance when a savepoint was taken, the journal level of the changes
+// made since, and the number of changes recorded for the hooks until then.
+type savepoint[K any, V any] struct {
+	root    NodeDescriptor[K, V]
+	min     K
+	size    int
+	expiry  *Instance[int64, K]
+	level   int
+	changes int
+}
+
+// Begin starts a transaction over the instance, with savepoint 0 at its beginning.
+// It panics if the builder does not implement NodeJournal.
+func (t *Instance[K, V]) Begin() *Tx[K, V] {
+	journal, ok := t.Builder.(NodeJournal)
+
+	if !ok {
+		panic("bp3: transactions are not supported by the builder")
+	}
+
+	tx := &Tx[K, V]{Instance: t, journal: journal}
+	tx.Savepoint()
+
+	return tx
+}
+
+// Savepoint takes a savepoint at the current state of the transaction and returns it.
+func (tx *Tx[K, V]) Savepoint() int {
+	tx.savepoints = append(tx.savepoints, savepoint[K, V]{
+		root:    tx.Root,
+		min:     tx.Min,
+		size:    tx.Size,
+		expiry:  tx.Expiry,
+		level:   tx.journal.Mark(),
+		changes: tx.recorded(),
+	})
+
+	switch {
+	case tx.expiry != nil:
+		tx.expiry.Savepoint()
+	case tx.Expiry != nil:
+		// the expiry index exists since the last savepoint, and is journaled from this one on
+		tx.expiry = tx.Expiry.Begin()
+
+		for len(tx.expiry.savepoints) < len(tx.savepoints) {
+			tx.expiry.savepoints = append(tx.expiry.savepoints, tx.expiry.savepoints[0])
+		}
+	}
+
+	return len(tx.savepoints) - 1
+}
+
+// RollbackTo undoes the changes made since a savepoint was taken, and releases the savepoints taken after it.
+// The transaction remains active, and the savepoint can be rolled back to again.
+func (tx *Tx[K, V]) RollbackTo(savepoint int) {
+	if savepoint < 0 || savepoint >= len(tx.savepoints) {
+		panic("bp3: invalid savepoint")
+	}
+
+	tx.restore(savepoint)
+	tx.Savepoint()
+}
+
+// Commit ends the transaction, keeping its changes. The changes of a nested transaction are
+// still undone if the enclosing transaction is rolled back.
+func (tx *Tx[K, V]) Commit() {
+	if len(tx.savepoints) == 0 {
+		panic("bp3: transaction ended")
+	}
+
+	tx.journal.Commit(tx.savepoints[0].level)
+	tx.savepoints = nil
+	tx.settled()
+
+	if tx.expiry != nil {
+		tx.expiry.Commit()
+	}
+}
+
+// Rollback ends the transaction, undoing its changes.
+func (tx *Tx[K, V]) Rollback() {
+	if len(tx.savepoints) == 0 {
+		panic("bp3: transaction ended")
+	}
+
+	tx.restore(0)
+}
+
+// restore undoes the changes made since a savepoint was taken, and removes it with the savepoints after it.
+func (tx *Tx[K, V]) restore(i int) {
+	s := tx.savepoints[i]
+
+	tx.journal.Undo(s.level)
+	tx.Root, tx.Min, tx.Size = s.root, s.min, s.size
+	tx.Version++
+	tx.savepoints = tx.savepoints[:i]
+
+	if s.expiry == nil {
+		// the expiry index was created after the savepoint
+		tx.Expiry, tx.expiry = nil, nil
+	} else {
+		tx.expiry.restore(i)
+	}
+
+	tx.revert(min(s.changes, tx.recorded()))
+}
@@ -0,0 +1,123 @@
+package bp3_test
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+// mutate applies random inserts and deletes to an instance.
+func mutate(r *rand.Rand, tree *bp3.Instance[int, int], n int, ops int) {
+	for i := 0; i < ops; i++ {
+		k := r.Intn(n)
+
+		switch r.Intn(4) {
+		case 0:
+			tree.Delete(k)
+		case 1:
+			tree.DeleteRange(bp3.RangeValue[int]{Value: k, Closed: true}, bp3.RangeValue[int]{Value: k + r.Intn(10), Closed: false})
+		default:
+			tree.Insert(k, i)
+		}
+	}
+}
+
+func TestTx(t *testing.T) {
+	test := func(order int, n int, options ...bp3.Option) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order))...)
+
+		mutate(r, tree, n, n)
+
+		for i := 0; i < 20; i++ {
+			before := slices.Clone(contents(t, tree))
+			tx := tree.Begin()
+
+			mutate(r, tx.Instance, n, n/2)
+
+			if !slices.Equal(contents(t, tree), bp3.Slice(tx.Root)) {
+				t.Fatal("transaction changes are not seen by the instance")
+			}
+
+			if i%2 == 0 {
+				tx.Rollback()
+
+				if s := contents(t, tree); !slices.Equal(s, before) || tree.Count() != len(before) {
+					t.Fatalf("order %d, n %d: rolled back to %v != %v", order, n, s, before)
+				}
+
+				if len(before) > 0 && tree.Min != before[0].Key {
+					t.Fatalf("min %d != %d", tree.Min, before[0].Key)
+				}
+			} else {
+				tx.Commit()
+			}
+
+			shape(t, tree.Root, order, true)
+		}
+	}
+
+	for order := 3; order < 7; order++ {
+		for _, n := range []int{10, 100, 500} {
+			test(order, n)
+			test(order, n, bp3.WithDuplicates())
+			test(order, n, bp3.WithCopyOnWrite())
+		}
+	}
+}
+
+func TestTxSavepoints(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := bp3.New[int, int](bp3.WithOrder(3))
+
+	mutate(r, tree, 200, 200)
+
+	s0 := slices.Clone(contents(t, tree))
+	tx := tree.Begin()
+
+	mutate(r, tx.Instance, 200, 100)
+
+	s1 := slices.Clone(contents(t, tree))
+	sp := tx.Savepoint()
+
+	mutate(r, tx.Instance, 200, 100)
+
+	// a nested transaction is committed into the enclosing one
+	inner := tx.Begin()
+	mutate(r, inner.Instance, 200, 100)
+	inner.Commit()
+
+	tx.RollbackTo(sp)
+
+	if s := contents(t, tree); !slices.Equal(s, s1) {
+		t.Fatalf("rolled back to savepoint %v != %v", s, s1)
+	}
+
+	// the savepoint is kept
+	mutate(r, tx.Instance, 200, 100)
+	tx.RollbackTo(sp)
+
+	if s := contents(t, tree); !slices.Equal(s, s1) {
+		t.Fatalf("rolled back to savepoint again %v != %v", s, s1)
+	}
+
+	// a nested transaction is rolled back alone
+	inner = tx.Begin()
+	mutate(r, inner.Instance, 200, 100)
+	inner.Rollback()
+
+	if s := contents(t, tree); !slices.Equal(s, s1) {
+		t.Fatalf("rolled back nested transaction %v != %v", s, s1)
+	}
+
+	mutate(r, tx.Instance, 200, 100)
+	tx.Rollback()
+
+	if s := contents(t, tree); !slices.Equal(s, s0) {
+		t.Fatalf("rolled back %v != %v", s, s0)
+	}
+
+	shape(t, tree.Root, 3, true)
+}
@@ -0,0 +1,209 @@
+package bp3
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrKeyOrder  = errors.New("bp3: keys out of order")
+	ErrSeparator = errors.New("bp3: separator is not the minimum of its child")
+	ErrDepth     = errors.New("bp3: leaves at different depths")
+	ErrFill      = errors.New("bp3: node fill out of bounds")
+	ErrCount     = errors.New("bp3: child count does not match its subtree")
+	ErrAggregate = errors.New("bp3: child aggregate does not match its subtree")
+	ErrLink      = errors.New("bp3: broken leaf link")
+	ErrSize      = errors.New("bp3: size does not match the number of pairs")
+	ErrMin       = errors.New("bp3: min is not the minimum key")
+)
+
+// ValidationError describes a broken invariant of an instance. Err is the invariant (one of the
+// ErrKeyOrder, ErrSeparator, ErrDepth, ErrFill, ErrCount, ErrAggregate, ErrLink, ErrSize and ErrMin
+// errors), and Path locates the node where it is broken, as the child indices from the root. Path is
+// nil for the invariants of the instance itself.
+type ValidationError struct {
+	Err    error
+	Path   []int
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == nil {
+		return fmt.Sprintf("%v: %s", e.Err, e.Detail)
+	}
+
+	return fmt.Sprintf("%v at node %v: %s", e.Err, e.Path, e.Detail)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that the instance is a valid B+ Tree: the keys are ordered within and across the
+// leaves (strictly, unless in duplicates mode), each separator is the minimum of its child, the leaves
+// are at the same depth, the nodes hold between half of their capacity and all of it (an internal root
+// holds at least two children), the child counts match their subtrees and so do the aggregates if the
+// monoid is an EqualMonoid, the leaves are linked both ways unless in copy-on-write mode, and Size and
+// Min match the pairs. It returns a *ValidationError for the first broken invariant found, or nil.
+func (t *Instance[K, V]) Validate() error {
+	v := validation[K, V]{tree: t, depth: -1}
+
+	if t.Root != nil && t.Root.Read() != nil {
+		if _, err := v.node(t.Root, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := v.links(); err != nil {
+		return err
+	}
+
+	if v.size != t.Size {
+		return &ValidationError{Err: ErrSize, Detail: fmt.Sprintf("size %d, %d pairs", t.Size, v.size)}
+	}
+
+	if v.size > 0 && t.compare(t.Min, v.first) != 0 {
+		return &ValidationError{Err: ErrMin, Detail: fmt.Sprintf("min %v, minimum key %v", t.Min, v.first)}
+	}
+
+	return nil
+}
+
+// validation is the state of Validate along its traversal of the leaves.
+type validation[K any, V any] struct {
+	tree   *Instance[K, V]
+	leaves []NodeDescriptor[K, V]
+	paths  [][]int
+	depth  int // depth is the depth of the first leaf, -1 before it is reached.
+	size   int
+	first  K
+	last   K
+}
+
+// node checks the subtree of a node at the given path, and returns its minimum key.
+func (v *validation[K, V]) node(d NodeDescriptor[K, V], p []int) (K, error) {
+	if p == nil {
+		p = []int{}
+	}
+
+	t := v.tree
+	node := d.Read()
+	count := node.Count()
+
+	fail := func(err error, format string, args ...any) (K, error) {
+		return *new(K), &ValidationError{Err: err, Path: p, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	switch leaf := node.Leaf(); {
+	case count > t.capacity(leaf):
+		return fail(ErrFill, "%d entries, capacity %d", count, t.capacity(leaf))
+	case len(p) > 0 && count < t.least(leaf):
+		return fail(ErrFill, "%d entries, minimum %d", count, t.least(leaf))
+	case len(p) == 0 && !node.Leaf() && count < 2:
+		return fail(ErrFill, "internal root with %d children", count)
+	}
+
+	if node.Leaf() || count == 0 {
+		if v.depth < 0 {
+			v.depth = len(p)
+		} else if v.depth != len(p) {
+			return fail(ErrDepth, "leaf at depth %d, first leaf at depth %d", len(p), v.depth)
+		}
+
+		for i, kv := range node.Values {
+			if v.size+i > 0 && !v.ordered(v.last, kv.Key) {
+				return fail(ErrKeyOrder, "key %v at %d after %v", kv.Key, i, v.last)
+			}
+
+			v.last = kv.Key
+		}
+
+		if v.size == 0 && count > 0 {
+			v.first = node.Values[0].Key
+		}
+
+		v.size += count
+		v.leaves = append(v.leaves, d)
+		v.paths = append(v.paths, p)
+
+		if count == 0 {
+			return *new(K), nil
+		}
+
+		return node.Values[0].Key, nil
+	}
+
+	if len(node.Mins) != count-1 {
+		return fail(ErrSeparator, "%d separators for %d children", len(node.Mins), count)
+	}
+
+	if len(node.Counts) > 0 && len(node.Counts) != count {
+		return fail(ErrCount, "%d counts for %d children", len(node.Counts), count)
+	}
+
+	if len(node.Aggregates) > 0 && len(node.Aggregates) != count {
+		return fail(ErrAggregate, "%d aggregates for %d children", len(node.Aggregates), count)
+	}
+
+	var minimum K
+
+	for i, child := range node.Children {
+		size := v.size
+		m, err := v.node(child, append(p[:len(p):len(p)], i))
+
+		if err != nil {
+			return *new(K), err
+		}
+
+		if i == 0 {
+			minimum = m
+		} else if t.compare(node.Mins[i-1], m) != 0 {
+			return fail(ErrSeparator, "separator %d is %v, minimum of child %d is %v", i-1, node.Mins[i-1], i, m)
+		}
+
+		if len(node.Counts) > 0 && node.Counts[i] != v.size-size {
+			return fail(ErrCount, "count of child %d is %d, its subtree has %d pairs", i, node.Counts[i], v.size-size)
+		}
+
+		if t.Aggregator != nil && len(node.Aggregates) > 0 {
+			if equal, known := t.Aggregator.Equal(node.Aggregates[i], t.summarize(child)); known && !equal {
+				return fail(ErrAggregate, "aggregate of child %d is %v, its subtree has %v", i, node.Aggregates[i], t.summarize(child))
+			}
+		}
+	}
+
+	return minimum, nil
+}
+
+// links checks that the leaves are linked in order in both directions.
+func (v *validation[K, V]) links() error {
+	if v.tree.CopyOnWrite {
+		return nil
+	}
+
+	for i, leaf := range v.leaves {
+		var prev, next NodeDescriptor[K, V]
+
+		if i > 0 {
+			prev = v.leaves[i-1]
+		}
+
+		if i < len(v.leaves)-1 {
+			next = v.leaves[i+1]
+		}
+
+		if node := leaf.Read(); node.Prev != prev {
+			return &ValidationError{Err: ErrLink, Path: v.paths[i], Detail: "previous leaf"}
+		} else if node.Next != next {
+			return &ValidationError{Err: ErrLink, Path: v.paths[i], Detail: "next leaf"}
+		}
+	}
+
+	return nil
+}
+
+// ordered returns true if key b may follow key a.
+func (v *validation[K, V]) ordered(a, b K) bool {
+	c := v.tree.compare(a, b)
+	return c < 0 || (c == 0 && v.tree.Duplicates)
+}
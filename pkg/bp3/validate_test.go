@@ -0,0 +1,235 @@
+package bp3_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
+
+func TestValidate(t *testing.T) {
+	test := func(order int, n int, options ...bp3.Option) {
+		r := rand.New(rand.NewSource(int64(order * n)))
+		tree := bp3.New[int, int](append(options, bp3.WithOrder(order))...)
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 10; i++ {
+			mutate(r, tree, n, n)
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("order %d, n %d: %v", order, n, err)
+			}
+
+			for range n / 5 {
+				tree.PopMin()
+			}
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("order %d, n %d: %v", order, n, err)
+			}
+		}
+
+		left, right := tree.SplitAt(n / 2)
+
+		for _, half := range []*bp3.Instance[int, int]{left, right} {
+			if err := half.Validate(); err != nil {
+				t.Fatalf("order %d, n %d, split: %v", order, n, err)
+			}
+		}
+
+		joined, err := bp3.Join(left, right)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := joined.Validate(); err != nil {
+			t.Fatalf("order %d, n %d, join: %v", order, n, err)
+		}
+
+		built := bp3.New[int, int](append(options, bp3.WithOrder(order))...)
+
+		if err := built.Build(joined.FromClosed(-1), 0.7); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := built.Validate(); err != nil {
+			t.Fatalf("order %d, n %d, build: %v", order, n, err)
+		}
+	}
+
+	for order := 3; order < 8; order++ {
+		for _, n := range []int{1, 10, 100, 500} {
+			test(order, n)
+			test(order, n, bp3.WithDuplicates())
+			test(order, n, bp3.WithCopyOnWrite())
+		}
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	build := func() *bp3.Instance[int, int] {
+		tree := bp3.New[int, int](bp3.WithOrder(3))
+
+		for i := 0; i < 20; i++ {
+			tree.Insert(i, i)
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		return tree
+	}
+
+	// leaf returns the first leaf and its path
+	leaf := func(tree *bp3.Instance[int, int]) (*bp3.Node[int, int], []int) {
+		var p []int
+		node := tree.Root.Read()
+
+		for !node.Leaf() {
+			node = node.Children[0].Read()
+			p = append(p, 0)
+		}
+
+		return node, p
+	}
+
+	for _, test := range []struct {
+		err    error
+		path   bool
+		modify func(*bp3.Instance[int, int])
+	}{
+		{bp3.ErrKeyOrder, true, func(tree *bp3.Instance[int, int]) {
+			node, _ := leaf(tree)
+			node.Values[0], node.Values[1] = node.Values[1], node.Values[0]
+		}},
+		{bp3.ErrSeparator, true, func(tree *bp3.Instance[int, int]) {
+			tree.Root.Read().Mins[0]--
+		}},
+		{bp3.ErrFill, true, func(tree *bp3.Instance[int, int]) {
+			node, _ := leaf(tree)
+			node.Values = append(node.Values, bp3.KeyValue[int, int]{Key: node.Values[1].Key, Value: 0})
+			node.Values = append(node.Values, bp3.KeyValue[int, int]{Key: node.Values[1].Key, Value: 0})
+		}},
+		{bp3.ErrCount, true, func(tree *bp3.Instance[int, int]) {
+			tree.Root.Read().Counts[0]++
+		}},
+		{bp3.ErrLink, true, func(tree *bp3.Instance[int, int]) {
+			node, _ := leaf(tree)
+			node.Next = nil
+		}},
+		{bp3.ErrDepth, true, func(tree *bp3.Instance[int, int]) {
+			root := tree.Root.Read()
+			root.Children[0] = root.Children[0].Read().Children[0]
+			root.Counts = nil
+		}},
+		{bp3.ErrSize, false, func(tree *bp3.Instance[int, int]) {
+			tree.Size++
+		}},
+		{bp3.ErrMin, false, func(tree *bp3.Instance[int, int]) {
+			tree.Min = -1
+		}},
+	} {
+		tree := build()
+		test.modify(tree)
+
+		err := tree.Validate()
+
+		var verr *bp3.ValidationError
+
+		if !errors.Is(err, test.err) || !errors.As(err, &verr) {
+			t.Fatalf("%v: %v", test.err, err)
+		}
+
+		if (verr.Path != nil) != test.path {
+			t.Fatalf("%v: path %v", test.err, verr.Path)
+		}
+	}
+
+	// the path leads to the broken node
+	tree := build()
+	node, p := leaf(tree)
+	node.Prev = tree.Root
+
+	var verr *bp3.ValidationError
+
+	if err := tree.Validate(); !errors.As(err, &verr) || !slices.Equal(verr.Path, p) {
+		t.Fatalf("path %v: %v", p, err)
+	}
+}
+
+func TestValidateUnderflow(t *testing.T) {
+	tree := bp3.New[int, int](bp3.WithOrder(5))
+
+	for i := 0; i < 50; i++ {
+		tree.Insert(i, i)
+	}
+
+	node := tree.Root.Read()
+
+	for !node.Leaf() {
+		node = node.Children[0].Read()
+	}
+
+	node.Values = node.Values[:1]
+	tree.Size -= 2
+
+	if err := tree.Validate(); !errors.Is(err, bp3.ErrFill) || !strings.Contains(err.Error(), "1 entries, minimum 3") {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateAggregates(t *testing.T) {
+	lift := func(kv bp3.KeyValue[int, float64]) float64 {
+		return kv.Value
+	}
+
+	add := func(a, b float64) float64 {
+		return a + b
+	}
+
+	// a sum with a NaN is NaN, which is not equal to itself
+	same := func(a, b float64) bool {
+		return a == b || (math.IsNaN(a) && math.IsNaN(b))
+	}
+
+	build := func(m bp3.Monoid[int, float64, float64]) *bp3.Instance[int, float64] {
+		tree := bp3.New[int, float64](bp3.WithOrder(3), bp3.WithMonoid(m))
+
+		for i := 0; i < 100; i++ {
+			tree.Insert(i, float64(i))
+		}
+
+		tree.Insert(10, math.NaN())
+
+		return tree
+	}
+
+	// the aggregates are not compared without an equal function
+	tree := build(bp3.MonoidFunc(0.0, lift, add))
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree = build(bp3.EqualMonoidFunc(0.0, lift, add, same))
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregates := tree.Root.Read().Aggregates
+	aggregates[len(aggregates)-1] = aggregates[len(aggregates)-1].(float64) + 1
+
+	if err := tree.Validate(); !errors.Is(err, bp3.ErrAggregate) {
+		t.Fatal(err)
+	}
+}
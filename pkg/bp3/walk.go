@@ -0,0 +1,146 @@
+package bp3
+
+// frame is an internal node on the path from the root to a leaf, and the index of the child the path goes through.
+type frame[K any, V any] struct {
+	node NodeDescriptor[K, V]
+	i    int
+}
+
+// path is the path from the root to a leaf. It is used to step between the leaves of
+// copy-on-write instances, whose leaves are not linked to their neighbours, and of instances
+// with a monoid, whose aggregates are updated along the path to a leaf that is written.
+type path[K any, V any] []frame[K, V]
+
+// walk returns the path to the leaf and the index of the first key-value pair whose key is not less
+// than the given key, or greater than it if after is set. The index may be past the last pair of the leaf.
+func (t *Instance[K, V]) walk(key K, after bool) (path[K, V], NodeDescriptor[K, V], int) {
+	return t.retrace(nil, nil, key, after)
+}
+
+// retrace is walk starting from a path to a leaf of the instance, or from the root if the path is empty
+// and the leaf is nil. It climbs the path only up to the lowest node whose range holds the key, and
+// descends from there, so that consecutive close keys do not descend from the root each time.
+// The path is reused in place.
+func (t *Instance[K, V]) retrace(p path[K, V], leaf NodeDescriptor[K, V], key K, after bool) (path[K, V], NodeDescriptor[K, V], int) {
+	// left returns true if the key is stored left of the given minimum, as child decides
+	left := func(min K) bool {
+		c := t.compare(min, key)
+		return c > 0 || (c == 0 && !after && t.Duplicates)
+	}
+
+	depth := len(p)              // the depth of the lowest node known to hold the key in its range
+	lower, upper := false, false // whether the key is known to be within the lower and upper bounds of that node
+
+	for d := len(p) - 1; d >= 0 && !(lower && upper); d-- {
+		f := p[d]
+		mins := f.node.Read().Mins
+
+		if !lower && f.i > 0 {
+			if lower = !left(mins[f.i-1]); !lower {
+				depth = d
+			}
+		}
+
+		if !upper && f.i < len(mins) {
+			if upper = left(mins[f.i]); !upper {
+				depth = d
+			}
+		}
+	}
+
+	root := t.Root
+
+	if depth < len(p) {
+		root = p[depth].node
+	} else if leaf != nil {
+		root = leaf
+	}
+
+	p = p[:depth]
+
+	for root != nil && !root.Read().Leaf() {
+		i := t.child(root.Read().Mins, key, after)
+		p = append(p, frame[K, V]{root, i})
+		root = root.Read().Children[i]
+	}
+
+	if root == nil {
+		return nil, nil, 0
+	}
+
+	return p, root, t.search(root.Read().Values, key, after)
+}
+
+// first returns the path to the leaf with the minimum key.
+func (t *Instance[K, V]) first() (path[K, V], NodeDescriptor[K, V]) {
+	var p path[K, V]
+	return p, p.descend(t.Root, false)
+}
+
+// last returns the path to the leaf with the maximum key.
+func (t *Instance[K, V]) last() (path[K, V], NodeDescriptor[K, V]) {
+	var p path[K, V]
+	return p, p.descend(t.Root, true)
+}
+
+// next returns the leaf that follows the given one, and moves the path to it.
+func (t *Instance[K, V]) next(p *path[K, V], leaf NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+	if !t.CopyOnWrite && t.Aggregator == nil {
+		return leaf.Read().Next
+	}
+
+	return p.next()
+}
+
+// next moves the path to the leaf that follows the one it leads to, and returns it, nil if none.
+func (p *path[K, V]) next() NodeDescriptor[K, V] {
+	for len(*p) > 0 {
+		f := &(*p)[len(*p)-1]
+
+		if f.i+1 < len(f.node.Read().Children) {
+			f.i++
+			return p.descend(f.node.Read().Children[f.i], false)
+		}
+
+		*p = (*p)[:len(*p)-1]
+	}
+
+	return nil
+}
+
+// prev returns the leaf that precedes the given one, and moves the path to it.
+func (t *Instance[K, V]) prev(p *path[K, V], leaf NodeDescriptor[K, V]) NodeDescriptor[K, V] {
+	if !t.CopyOnWrite && t.Aggregator == nil {
+		return leaf.Read().Prev
+	}
+
+	for len(*p) > 0 {
+		f := &(*p)[len(*p)-1]
+
+		if f.i > 0 {
+			f.i--
+			return p.descend(f.node.Read().Children[f.i], true)
+		}
+
+		*p = (*p)[:len(*p)-1]
+	}
+
+	return nil
+}
+
+// descend extends the path along the leftmost (or rightmost if last is set) children
+// of the given node, and returns the leaf it reaches.
+func (p *path[K, V]) descend(root NodeDescriptor[K, V], last bool) NodeDescriptor[K, V] {
+	for root != nil && !root.Read().Leaf() {
+		i := 0
+
+		if last {
+			i = len(root.Read().Children) - 1
+		}
+
+		*p = append(*p, frame[K, V]{root, i})
+		root = root.Read().Children[i]
+	}
+
+	return root
+}
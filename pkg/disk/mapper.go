@@ -21,8 +21,8 @@ type mapper struct {
 	cache   lrucache.LRUCache[int, map[uuid.UUID]int64]
 }
 
-func newMapper(capacity int, pages []ReadWriteSeekSyncTruncater) mapper {
-	return mapper{
+func newMapper(capacity int, pages []ReadWriteSeekSyncTruncater) *mapper {
+	return &mapper{
 		pages:   pages,
 		updates: make(map[int]map[uuid.UUID]int64),
 		cache:   lrucache.New[int, map[uuid.UUID]int64](capacity, 0),
@@ -1,25 +1,67 @@
 package disk
 
-import "github.com/moshenahmias/bp3/pkg/bp3"
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/moshenahmias/bp3/pkg/bp3"
+)
 
 type options struct {
 	order          int
+	internal       int
+	leaf           int
+	fill           float64
+	duplicates     bool
 	pages          []ReadWriteSeekSyncTruncater
 	maxCachedPages int
+	aggregator     any
+	clock          func() time.Time
+	tolerant       bool
 }
 
 // Option represents a functional option for configuring a B+ Tree instance
 type Option func(*options)
 
+// aggregatorOf returns the aggregator of the monoid given with WithMonoid, nil if none was given.
+// It panics if the monoid has other key or value types.
+func aggregatorOf[K any, V any](o options) bp3.Aggregator[K, V] {
+	if o.aggregator == nil {
+		return nil
+	}
+
+	a, ok := o.aggregator.(bp3.Aggregator[K, V])
+
+	if !ok {
+		panic("disk: monoid of other key or value types")
+	}
+
+	return a
+}
+
 func buildOptions(options_ ...Option) options {
 	opts := options{
 		order: bp3.MinOrder,
+		fill:  1,
 	}
 
 	for _, opt := range options_ {
 		opt(&opts)
 	}
 
+	// without a leaf capacity, the leaves of a tree with an internal order keep the capacity of its order
+	if opts.leaf <= 0 && opts.internal > 0 {
+		opts.leaf = opts.order
+	}
+
+	if opts.leaf > 0 {
+		opts.leaf = max(opts.leaf, bp3.MinOrder)
+	}
+
+	if opts.internal > 0 {
+		opts.order = opts.internal
+	}
+
 	if opts.maxCachedPages == 0 {
 		opts.maxCachedPages = max(1, (len(opts.pages)+1)/2)
 	}
@@ -34,6 +76,35 @@ func WithOrder(order int) Option {
 	}
 }
 
+// WithInternalOrder sets the maximum number of children of an internal node of the B+ Tree,
+// without changing the maximum number of key-value pairs in a leaf.
+func WithInternalOrder(order int) Option {
+	return func(o *options) {
+		o.internal = order
+	}
+}
+
+// WithLeafCapacity sets the maximum number of key-value pairs in a leaf of the B+ Tree.
+func WithLeafCapacity(capacity int) Option {
+	return func(o *options) {
+		o.leaf = capacity
+	}
+}
+
+// WithDuplicates allows the B+ Tree to hold multiple key-value pairs with equal keys.
+func WithDuplicates() Option {
+	return func(o *options) {
+		o.duplicates = true
+	}
+}
+
+// WithFillFactor sets the fraction (0, 1] of each node that is filled when bulk loading the B+ Tree.
+func WithFillFactor(fill float64) Option {
+	return func(o *options) {
+		o.fill = fill
+	}
+}
+
 // WithIndexPage adds a storage page for the B+ Tree index.
 func WithIndexPage(page ReadWriteSeekSyncTruncater) Option {
 	return func(o *options) {
@@ -54,3 +125,28 @@ func WithMaxCachedPages(max int) Option {
 		o.maxCachedPages = max
 	}
 }
+
+// WithMonoid makes the B+ Tree cache the aggregate of each child subtree under the given monoid,
+// see bp3.Aggregate. The aggregates are stored with the nodes, so the aggregate type must be
+// encodable by gob, and a loaded tree must be given the monoid it was stored with.
+func WithMonoid[K any, V any, A any](m bp3.Monoid[K, V, A]) Option {
+	return func(o *options) {
+		gob.Register(m.Identity())
+		o.aggregator = bp3.Aggregating(m)
+	}
+}
+
+// WithClock sets the function that returns the current time for the deadlines of the B+ Tree pairs, instead of time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithTolerantIterators makes the sequences of the B+ Tree resume after the last pair they returned
+// when the B+ Tree is modified while they are being consumed, instead of panicking.
+func WithTolerantIterators() Option {
+	return func(o *options) {
+		o.tolerant = true
+	}
+}
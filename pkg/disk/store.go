@@ -1,10 +1,15 @@
 package disk
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"slices"
 
 	"github.com/google/uuid"
@@ -17,7 +22,7 @@ type ReadWriteSeekSyncer interface {
 	Sync() error
 }
 
-type nodeDescriptor[K constraints.Ordered, V any] struct {
+type nodeDescriptor[K any, V any] struct {
 	id      uuid.UUID
 	offset  int64
 	size    int64 // on store
@@ -42,20 +47,63 @@ func (d *nodeDescriptor[K, V]) Write() *bp3.Node[K, V] {
 	return node
 }
 
-type nodeRecord[K constraints.Ordered, V any] struct {
-	Id       uuid.UUID
-	Mins     []K
-	Children []uuid.UUID
-	Values   []bp3.KeyValue[K, V]
-	Next     uuid.UUID
-	Prev     uuid.UUID
+func (d *nodeDescriptor[K, V]) Size() int64 {
+	return d.size
 }
 
-type nodeBuilder[K constraints.Ordered, V any] struct {
-	update map[uuid.UUID]*nodeDescriptor[K, V]
-	delete map[uuid.UUID]*nodeDescriptor[K, V]
-	store  ReadWriteSeekSyncer
-	index  mapper
+type nodeRecord[K any, V any] struct {
+	Id         uuid.UUID
+	Mins       []K
+	Children   []uuid.UUID
+	Counts     []int
+	Aggregates []any
+	Values     []bp3.KeyValue[K, V]
+	Deadlines  []int64
+	Next       uuid.UUID
+	Prev       uuid.UUID
+}
+
+// nodeBuilder loads and writes the nodes of a tree. In a transaction, the journal keeps the nodes
+// as they were before being written, and whether they were dirty (in update or delete).
+type nodeBuilder[K any, V any] struct {
+	bp3.Journal
+	nodes   map[uuid.UUID]*nodeDescriptor[K, V]
+	update  map[uuid.UUID]*nodeDescriptor[K, V]
+	delete  map[uuid.UUID]*nodeDescriptor[K, V]
+	store   ReadWriteSeekSyncer
+	index   *mapper
+	flushes int   // flushes counts the calls to Flush, to tell if a restored node differs from the stored one.
+	header  int64 // header is the offset of the tree record on store, 0 if it was not written.
+	size    int64 // size is the size of the tree record on store.
+}
+
+// deleted is the journal key of the deletion of a node, apart from the changes to its contents.
+type deleted[K any, V any] struct {
+	desc *nodeDescriptor[K, V]
+}
+
+func newNodeBuilder[K any, V any](store ReadWriteSeekSyncer, index *mapper) *nodeBuilder[K, V] {
+	return &nodeBuilder[K, V]{
+		store:  store,
+		nodes:  make(map[uuid.UUID]*nodeDescriptor[K, V]),
+		update: make(map[uuid.UUID]*nodeDescriptor[K, V]),
+		delete: make(map[uuid.UUID]*nodeDescriptor[K, V]),
+		index:  index,
+	}
+}
+
+// descriptor returns the descriptor of the node with the given id. Every reference to a node
+// (as a child, next or previous node) shares the same descriptor, so that changes made through
+// one of them are seen through the others.
+func (b *nodeBuilder[K, V]) descriptor(id uuid.UUID) *nodeDescriptor[K, V] {
+	if d, found := b.nodes[id]; found {
+		return d
+	}
+
+	d := &nodeDescriptor[K, V]{id: id, builder: b, loader: b}
+	b.nodes[id] = d
+
+	return d
 }
 
 func (b *nodeBuilder[K, V]) Load(d bp3.NodeDescriptor[K, V]) error {
@@ -74,19 +122,14 @@ func (b *nodeBuilder[K, V]) Load(d bp3.NodeDescriptor[K, V]) error {
 		return err
 	}
 
-	decoder := gob.NewDecoder(b.store)
+	reader := &countingReader{reader: bufio.NewReader(b.store)}
+	decoder := gob.NewDecoder(reader)
 
 	if err := decoder.Decode(&record); err != nil {
 		return err
 	}
 
-	currentOffset, err := b.store.Seek(0, io.SeekCurrent)
-
-	if err != nil {
-		return err
-	}
-
-	desc.size = currentOffset - desc.offset
+	desc.size = reader.count
 
 	var children []bp3.NodeDescriptor[K, V]
 
@@ -94,33 +137,59 @@ func (b *nodeBuilder[K, V]) Load(d bp3.NodeDescriptor[K, V]) error {
 		children = make([]bp3.NodeDescriptor[K, V], 0, len(record.Children))
 
 		for _, id := range record.Children {
-			children = append(children, &nodeDescriptor[K, V]{id: id, builder: desc.builder, loader: desc.loader})
+			children = append(children, b.descriptor(id))
 		}
 	}
 
 	var next bp3.NodeDescriptor[K, V]
 
 	if record.Next != uuid.Nil {
-		next = &nodeDescriptor[K, V]{id: record.Next, builder: desc.builder, loader: desc.loader}
+		next = b.descriptor(record.Next)
 	}
 
 	var prev bp3.NodeDescriptor[K, V]
 
 	if record.Prev != uuid.Nil {
-		prev = &nodeDescriptor[K, V]{id: record.Prev, builder: desc.builder, loader: desc.loader}
+		prev = b.descriptor(record.Prev)
 	}
 
 	desc.node = &bp3.Node[K, V]{
-		Mins:     record.Mins,
-		Values:   record.Values,
-		Children: children,
-		Next:     next,
-		Prev:     prev,
+		Mins:       record.Mins,
+		Values:     record.Values,
+		Deadlines:  record.Deadlines,
+		Children:   children,
+		Counts:     record.Counts,
+		Aggregates: record.Aggregates,
+		Next:       next,
+		Prev:       prev,
 	}
 
 	return nil
 }
 
+// countingReader counts the bytes consumed by a gob decoder. Being an io.ByteReader, it keeps
+// the decoder from buffering ahead, so the count is the exact size of the decoded record.
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	c, err := r.reader.ReadByte()
+
+	if err == nil {
+		r.count++
+	}
+
+	return c, err
+}
+
 func (b *nodeBuilder[K, V]) Create(node *bp3.Node[K, V]) bp3.NodeDescriptor[K, V] {
 	d := &nodeDescriptor[K, V]{
 		id:      uuid.New(),
@@ -129,6 +198,15 @@ func (b *nodeBuilder[K, V]) Create(node *bp3.Node[K, V]) bp3.NodeDescriptor[K, V
 		loader:  b,
 	}
 
+	b.nodes[d.id] = d
+
+	b.Record(d, func() func() {
+		return func() {
+			delete(b.nodes, d.id)
+			delete(b.update, d.id)
+		}
+	})
+
 	b.Update(d)
 
 	return d
@@ -136,12 +214,31 @@ func (b *nodeBuilder[K, V]) Create(node *bp3.Node[K, V]) bp3.NodeDescriptor[K, V
 
 func (b *nodeBuilder[K, V]) Update(d bp3.NodeDescriptor[K, V]) {
 	desc := d.(*nodeDescriptor[K, V])
+
+	b.Record(desc, func() func() {
+		image := desc.node.Clone()
+		_, dirty := b.update[desc.id]
+		flushes := b.flushes
+
+		return func() {
+			*desc.node = *image
+			b.nodes[desc.id] = desc
+
+			if dirty || b.flushes != flushes {
+				b.update[desc.id] = desc
+			} else {
+				delete(b.update, desc.id)
+			}
+		}
+	})
+
 	b.update[desc.id] = desc
 }
 
 func (b *nodeBuilder[K, V]) Flush() error {
 	for id := range b.delete {
 		delete(b.update, id)
+		delete(b.nodes, id)
 	}
 
 	clear(b.delete)
@@ -173,12 +270,15 @@ func (b *nodeBuilder[K, V]) Flush() error {
 		}
 
 		record := nodeRecord[K, V]{
-			Id:       dd.id,
-			Mins:     slices.Clone(dd.node.Mins),
-			Values:   slices.Clone(dd.node.Values),
-			Children: children,
-			Next:     next,
-			Prev:     prev,
+			Id:         dd.id,
+			Mins:       slices.Clone(dd.node.Mins),
+			Values:     slices.Clone(dd.node.Values),
+			Deadlines:  slices.Clone(dd.node.Deadlines),
+			Children:   children,
+			Counts:     slices.Clone(dd.node.Counts),
+			Aggregates: slices.Clone(dd.node.Aggregates),
+			Next:       next,
+			Prev:       prev,
 		}
 
 		var buffer bytes.Buffer
@@ -225,81 +325,298 @@ func (b *nodeBuilder[K, V]) Flush() error {
 	}
 
 	clear(b.update)
+	b.flushes++
 
 	return nil
 }
 
 func (b *nodeBuilder[K, V]) Delete(d bp3.NodeDescriptor[K, V]) {
 	dd := d.(*nodeDescriptor[K, V])
+
+	b.Record(deleted[K, V]{dd}, func() func() {
+		_, dirty := b.delete[dd.id]
+		flushes := b.flushes
+
+		return func() {
+			b.nodes[dd.id] = dd
+
+			if !dirty {
+				delete(b.delete, dd.id)
+			}
+
+			// a flush dropped the node without writing it
+			if b.flushes != flushes {
+				b.update[dd.id] = dd
+			}
+		}
+	})
+
 	b.delete[dd.id] = dd
 }
 
-type treeRecord[K constraints.Ordered, V any] struct {
-	Root  uuid.UUID
-	Min   K
-	Order int
-	Size  int
+// ErrUnsupportedFormat is returned by Load for a store that does not start with the format marker
+// (such as a store written before it was added), or that has a format version it cannot read.
+var ErrUnsupportedFormat = errors.New("disk: unsupported store format")
+
+// formatMarker and formatVersion start every store, ahead of the location of the tree record.
+const (
+	formatMarker  = "bp3store"
+	formatVersion = 1
+)
+
+// slot is the fixed header at the start of the store, which holds the format of the store and the
+// offset and the size of the tree record. The record is written apart from the slot, like a node,
+// since its size varies with the minimum key and the deadlines, and it would overwrite the first
+// node otherwise.
+type slot struct {
+	Marker  [8]byte
+	Version int64
+	Offset  int64
+	Size    int64
+}
+
+// slotSize is the size of the encoded slot.
+const slotSize = 32
+
+type treeRecord[K any, V any] struct {
+	Root         uuid.UUID
+	Min          K
+	Order        int
+	Size         int
+	Duplicates   bool
+	LeafCapacity int
+	Expiry       uuid.UUID // Expiry is the root of the index of the deadlines of the pairs.
+	ExpiryMin    int64
+	ExpirySize   int
+}
+
+// writeHeader writes the tree record in place if it fits in the previous one, or at the end of the
+// store otherwise, and then the slot that points to it.
+func (b *nodeBuilder[K, V]) writeHeader(record treeRecord[K, V]) error {
+	var buffer bytes.Buffer
+
+	if err := gob.NewEncoder(&buffer).Encode(record); err != nil {
+		return err
+	}
+
+	size := int64(buffer.Len())
+	offset := b.header
+	whence := io.SeekStart
+
+	if b.size < size || b.header == 0 {
+		offset = 0
+		whence = io.SeekEnd
+	}
+
+	offset, err := b.store.Seek(offset, whence)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := buffer.WriteTo(b.store); err != nil {
+		return err
+	}
+
+	b.header, b.size = offset, size
+
+	if _, err := b.store.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := slot{Version: formatVersion, Offset: offset, Size: size}
+	copy(header.Marker[:], formatMarker)
+
+	return binary.Write(b.store, binary.LittleEndian, header)
+}
+
+// readHeader reads the tree record that the slot at the start of the store points to. It returns an
+// error wrapping ErrUnsupportedFormat if the slot has no format marker or another format version.
+func (b *nodeBuilder[K, V]) readHeader() (treeRecord[K, V], error) {
+	var record treeRecord[K, V]
+	var header slot
+
+	if _, err := b.store.Seek(0, io.SeekStart); err != nil {
+		return record, err
+	}
+
+	if err := binary.Read(b.store, binary.LittleEndian, &header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return record, fmt.Errorf("%w: store too short for a header", ErrUnsupportedFormat)
+		}
+
+		return record, err
+	}
+
+	if string(header.Marker[:]) != formatMarker {
+		return record, fmt.Errorf("%w: no format marker, the store may have been written by an earlier version", ErrUnsupportedFormat)
+	}
+
+	if header.Version != formatVersion {
+		return record, fmt.Errorf("%w: version %d, expected %d", ErrUnsupportedFormat, header.Version, formatVersion)
+	}
+
+	if _, err := b.store.Seek(header.Offset, io.SeekStart); err != nil {
+		return record, err
+	}
+
+	if err := gob.NewDecoder(bufio.NewReader(b.store)).Decode(&record); err != nil {
+		return record, err
+	}
+
+	b.header, b.size = header.Offset, header.Size
+
+	return record, nil
 }
 
 // Initialize sets up a new B+ Tree instance with the given store, index, and optionals.
 func Initialize[K constraints.Ordered, V any](store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+	return InitializeFunc[K, V](cmp.Compare[K], store, index, options...)
+}
+
+// InitializeFunc sets up a new B+ Tree instance with the given key compare function, store, index, and optionals.
+// If the function is nil, the keys are in their natural order, and it returns bp3.ErrUnordered if K has none.
+func InitializeFunc[K any, V any](compare func(a, b K) int, store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+	compare, err := orderOf(compare)
+
+	if err != nil {
+		return nil, err
+	}
+
 	opts := buildOptions(options...)
 	order := max(opts.order, bp3.MinOrder)
 
 	record := treeRecord[K, V]{
-		Order: order,
+		Order:        order,
+		Duplicates:   opts.duplicates,
+		LeafCapacity: opts.leaf,
 	}
 
-	if err := gob.NewEncoder(store).Encode(record); err != nil {
+	mapper := newMapper(opts.maxCachedPages, append([]ReadWriteSeekSyncTruncater{index}, opts.pages...))
+	builder := newNodeBuilder[K, V](store, mapper)
+
+	// the slot is reserved before the record is appended after it
+	if _, err := store.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
 
-	return &bp3.Instance[K, V]{Order: order, Builder: &nodeBuilder[K, V]{
-		store:  store,
-		update: make(map[uuid.UUID]*nodeDescriptor[K, V]),
-		delete: make(map[uuid.UUID]*nodeDescriptor[K, V]),
-		index:  newMapper(opts.maxCachedPages, append([]ReadWriteSeekSyncTruncater{index}, opts.pages...))},
+	if _, err := store.Write(make([]byte, slotSize)); err != nil {
+		return nil, err
+	}
+
+	if err := builder.writeHeader(record); err != nil {
+		return nil, err
+	}
+
+	return &bp3.Instance[K, V]{
+		Order:        order,
+		LeafCapacity: opts.leaf,
+		Compare:      compare,
+		Duplicates:   opts.duplicates,
+		Builder:      builder,
+		Aggregator:   aggregatorOf[K, V](opts),
+		Clock:        opts.clock,
+		Tolerant:     opts.tolerant,
+		Expiry:       expiry[K](order, store, mapper),
 	}, nil
 }
 
-// Load retrieves a B+ Tree instance from the given store, index, and optionals.
-func Load[K constraints.Ordered, V any](store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+// BulkLoad sets up a new B+ Tree instance with the given store, index, and optionals,
+// and fills it bottom-up from a sequence of key-value pairs sorted in ascending key order.
+// The loaded nodes are written on the next Flush.
+func BulkLoad[K constraints.Ordered, V any](seq iter.Seq2[K, V], store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+	return BulkLoadFunc(cmp.Compare[K], seq, store, index, options...)
+}
+
+// BulkLoadFunc sets up a new B+ Tree instance with the given key compare function, store, index, and optionals,
+// and fills it bottom-up from a sequence of key-value pairs sorted in ascending order of the compare function.
+// The loaded nodes are written on the next Flush.
+func BulkLoadFunc[K any, V any](compare func(a, b K) int, seq iter.Seq2[K, V], store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
 	opts := buildOptions(options...)
+	tree, err := InitializeFunc[K, V](compare, store, index, options...)
 
-	var record treeRecord[K, V]
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := store.Seek(0, io.SeekStart); err != nil {
+	if err := tree.Build(seq, opts.fill); err != nil {
 		return nil, err
 	}
 
-	if err := gob.NewDecoder(store).Decode(&record); err != nil {
+	return tree, nil
+}
+
+// Load retrieves a B+ Tree instance from the given store, index, and optionals.
+func Load[K constraints.Ordered, V any](store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+	return LoadFunc[K, V](cmp.Compare[K], store, index, options...)
+}
+
+// LoadFunc retrieves a B+ Tree instance from the given store, index, and optionals.
+// The key compare function must order the keys the same way as the one the tree was stored with.
+// It returns an error wrapping ErrUnsupportedFormat if the store was not written in the current format.
+// If it is nil, the keys are in their natural order, and it returns bp3.ErrUnordered if K has none.
+func LoadFunc[K any, V any](compare func(a, b K) int, store ReadWriteSeekSyncer, index ReadWriteSeekSyncTruncater, options ...Option) (*bp3.Instance[K, V], error) {
+	compare, err := orderOf(compare)
+
+	if err != nil {
 		return nil, err
 	}
 
-	builder := &nodeBuilder[K, V]{
-		store:  store,
-		update: make(map[uuid.UUID]*nodeDescriptor[K, V]),
-		delete: make(map[uuid.UUID]*nodeDescriptor[K, V]),
-		index:  newMapper(opts.maxCachedPages, append([]ReadWriteSeekSyncTruncater{index}, opts.pages...)),
+	opts := buildOptions(options...)
+
+	mapper := newMapper(opts.maxCachedPages, append([]ReadWriteSeekSyncTruncater{index}, opts.pages...))
+	builder := newNodeBuilder[K, V](store, mapper)
+	record, err := builder.readHeader()
+
+	if err != nil {
+		return nil, err
 	}
 
 	var root bp3.NodeDescriptor[K, V]
 
 	if record.Root != uuid.Nil {
-		root = &nodeDescriptor[K, V]{id: record.Root, builder: builder, loader: builder}
+		root = builder.descriptor(record.Root)
+	}
+
+	deadlines := expiry[K](record.Order, store, mapper)
+
+	if record.Expiry != uuid.Nil {
+		deadlines.Root = deadlines.Builder.(*nodeBuilder[int64, K]).descriptor(record.Expiry)
+		deadlines.Min, deadlines.Size = record.ExpiryMin, record.ExpirySize
 	}
 
 	return &bp3.Instance[K, V]{
-		Root:    root,
-		Order:   record.Order,
-		Size:    record.Size,
-		Min:     record.Min,
-		Builder: builder,
+		Root:         root,
+		Order:        record.Order,
+		LeafCapacity: record.LeafCapacity,
+		Size:         record.Size,
+		Min:          record.Min,
+		Compare:      compare,
+		Duplicates:   record.Duplicates,
+		Builder:      builder,
+		Aggregator:   aggregatorOf[K, V](opts),
+		Clock:        opts.clock,
+		Tolerant:     opts.tolerant,
+		Expiry:       deadlines,
 	}, nil
 }
 
+// orderOf returns the given compare function, or the natural order of K if it is nil.
+func orderOf[K any](compare func(a, b K) int) (func(a, b K) int, error) {
+	if compare != nil {
+		return compare, nil
+	}
+
+	return bp3.NaturalOrder[K]()
+}
+
+// expiry returns an empty index of the deadlines of the pairs of a tree, stored with the tree.
+func expiry[K any](order int, store ReadWriteSeekSyncer, index *mapper) *bp3.Instance[int64, K] {
+	return &bp3.Instance[int64, K]{Order: order, Compare: cmp.Compare[int64], Duplicates: true, Builder: newNodeBuilder[int64, K](store, index)}
+}
+
 // Flush writes the current state of the B+ Tree.
-func Flush[K constraints.Ordered, V any](tree *bp3.Instance[K, V]) error {
+func Flush[K any, V any](tree *bp3.Instance[K, V]) error {
 	var root uuid.UUID
 
 	if tree.Root != nil {
@@ -308,18 +625,27 @@ func Flush[K constraints.Ordered, V any](tree *bp3.Instance[K, V]) error {
 
 	builder := tree.Builder.(*nodeBuilder[K, V])
 
-	if _, err := builder.store.Seek(0, io.SeekStart); err != nil {
-		return err
+	record := treeRecord[K, V]{
+		Order:        tree.Order,
+		Min:          tree.Min,
+		Size:         tree.Size,
+		Root:         root,
+		Duplicates:   tree.Duplicates,
+		LeafCapacity: tree.LeafCapacity,
 	}
 
-	record := treeRecord[K, V]{
-		Order: tree.Order,
-		Min:   tree.Min,
-		Size:  tree.Size,
-		Root:  root,
+	var deadlines *nodeBuilder[int64, K]
+
+	if tree.Expiry != nil {
+		deadlines, _ = tree.Expiry.Builder.(*nodeBuilder[int64, K])
 	}
 
-	if err := gob.NewEncoder(builder.store).Encode(record); err != nil {
+	if deadlines != nil && tree.Expiry.Root != nil {
+		record.Expiry = tree.Expiry.Root.(*nodeDescriptor[int64, K]).id
+		record.ExpiryMin, record.ExpirySize = tree.Expiry.Min, tree.Expiry.Size
+	}
+
+	if err := builder.writeHeader(record); err != nil {
 		return err
 	}
 
@@ -327,5 +653,28 @@ func Flush[K constraints.Ordered, V any](tree *bp3.Instance[K, V]) error {
 		return err
 	}
 
+	if deadlines != nil {
+		if err := deadlines.Flush(); err != nil {
+			return err
+		}
+	}
+
 	return builder.index.flush()
 }
+
+// NewConcurrent wraps a B+ Tree instance for concurrent use. Since the nodes are loaded on demand
+// through a shared store, reads are serialized as well, and Flush writes the state of the tree.
+func NewConcurrent[K any, V any](tree *bp3.Instance[K, V]) *bp3.Concurrent[K, V] {
+	return bp3.NewConcurrent(tree, bp3.WithExclusiveReads(), bp3.WithFlush(func() error {
+		return Flush(tree)
+	}))
+}
+
+// NewLatched wraps a B+ Tree instance for concurrent use with a latch for each node. Since the nodes are
+// loaded on demand through a shared store, the node accesses are serialized while the writers latch
+// their own paths, and Flush writes the state of the tree.
+func NewLatched[K any, V any](tree *bp3.Instance[K, V]) *bp3.Latched[K, V] {
+	return bp3.Latch(tree, bp3.WithExclusiveReads(), bp3.WithFlush(func() error {
+		return Flush(tree)
+	}))
+}
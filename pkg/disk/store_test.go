@@ -2,10 +2,14 @@ package disk_test
 
 import (
 	"cmp"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/moshenahmias/bp3/pkg/bp3"
 	"github.com/moshenahmias/bp3/pkg/disk"
@@ -163,3 +167,1388 @@ func TestTreeInserDeleteSync(t *testing.T) {
 	test(10, 1000, 10)
 	test(15, 10000, 100)
 }
+
+func TestTreeBackwardSync(t *testing.T) {
+	test := func(order int, n int, p int) {
+		fs := afero.NewMemMapFs()
+
+		file, err := fs.Create("testo")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer file.Close()
+
+		var pages []disk.ReadWriteSeekSyncTruncater
+
+		for i := 0; i < p; i++ {
+			if pf, err := fs.Create(fmt.Sprintf("page_%d", i)); err == nil {
+				pages = append(pages, pf)
+				defer pf.Close()
+			} else {
+				t.Fatal(err)
+			}
+		}
+
+		tree, err := disk.Initialize[int, string](
+			file,
+			pages[0],
+			disk.WithOrder(order),
+			disk.WithIndexPages(pages[1:]),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < n; i++ {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		if err := disk.Flush(tree); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := disk.Load[int, string](
+			file,
+			pages[0],
+			disk.WithOrder(order),
+			disk.WithIndexPages(pages[1:]),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []int
+
+		for k := range loaded.RangeReverseClosed(n/4, n/2) {
+			keys = append(keys, k)
+		}
+
+		if len(keys) != n/2-n/4+1 {
+			t.Fatalf("got %d keys", len(keys))
+		}
+
+		for i, k := range keys {
+			if k != n/2-i {
+				t.Fatalf("%d not in position", k)
+			}
+		}
+
+		count := 0
+
+		for range loaded.Backward() {
+			count++
+		}
+
+		if count != n {
+			t.Fatalf("backward count %d != %d", count, n)
+		}
+	}
+
+	test(3, 100, 1)
+	test(10, 1000, 10)
+}
+
+func TestTreeTimeKeysSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.InitializeFunc[time.Time, int](time.Time.Compare, file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 500; i++ {
+		tree.Insert(start.Add(time.Duration(i)*time.Hour), i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.LoadFunc[time.Time, int](time.Time.Compare, file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		if v, found := loaded.Find(start.Add(time.Duration(i) * time.Hour)); !found || v != i {
+			t.Fatalf("%d: %d, %v", i, v, found)
+		}
+	}
+
+	if _, found := loaded.Find(start.Add(time.Minute)); found {
+		t.Fatal("unexpected key")
+	}
+
+	// time has no natural order
+	if _, err := disk.LoadFunc[time.Time, int](nil, file, page); !errors.Is(err, bp3.ErrUnordered) {
+		t.Fatal(err)
+	}
+}
+
+func TestTreeBulkLoadSync(t *testing.T) {
+	test := func(order int, n int, p int, fill float64) {
+		fs := afero.NewMemMapFs()
+
+		file, err := fs.Create("testo")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer file.Close()
+
+		var pages []disk.ReadWriteSeekSyncTruncater
+
+		for i := 0; i < p; i++ {
+			if pf, err := fs.Create(fmt.Sprintf("page_%d", i)); err == nil {
+				pages = append(pages, pf)
+				defer pf.Close()
+			} else {
+				t.Fatal(err)
+			}
+		}
+
+		seq := func(yield func(int, string) bool) {
+			for i := 0; i < n; i++ {
+				if !yield(i, fmt.Sprint(i)) {
+					return
+				}
+			}
+		}
+
+		tree, err := disk.BulkLoad(
+			seq,
+			file,
+			pages[0],
+			disk.WithOrder(order),
+			disk.WithFillFactor(fill),
+			disk.WithIndexPages(pages[1:]),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := disk.Flush(tree); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := disk.Load[int, string](
+			file,
+			pages[0],
+			disk.WithIndexPages(pages[1:]),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if loaded.Size != n {
+			t.Fatalf("size %d != %d", loaded.Size, n)
+		}
+
+		s1 := bp3.Slice(loaded.Root)
+
+		if len(s1) != n {
+			t.Fatalf("slice size %d != %d", len(s1), n)
+		}
+
+		for i, kv := range s1 {
+			if kv.Key != i {
+				t.Fatalf("%d not in position", i)
+			}
+		}
+
+		for i := 0; i < n; i += 7 {
+			if v, found := loaded.Find(i); !found || v != fmt.Sprint(i) {
+				t.Fatalf("%d: %s, %v", i, v, found)
+			}
+		}
+	}
+
+	test(3, 100, 1, 1)
+	test(10, 1000, 10, 0.8)
+	test(15, 10000, 100, 1)
+}
+
+func TestTreeOverwriteSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, int](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Update(i%100, func(old int, _ bool) (int, bool) {
+			return old + 1, true
+		})
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, int](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 100 {
+		t.Fatalf("size %d != %d", loaded.Count(), 100)
+	}
+
+	for i := 0; i < 100; i++ {
+		if v, found := loaded.Find(i); !found || v != 10 {
+			t.Fatalf("%d: %d, %v", i, v, found)
+		}
+	}
+}
+
+func TestTreeDuplicatesSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, int](file, page, disk.WithOrder(3), disk.WithDuplicates())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		tree.Insert(i%10, i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, int](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Duplicates || loaded.Count() != 100 {
+		t.Fatalf("duplicates %v, size %d", loaded.Duplicates, loaded.Count())
+	}
+
+	loaded.Insert(5, 100)
+
+	s := slices.Collect(loaded.FindAll(5))
+	master := []int{5, 15, 25, 35, 45, 55, 65, 75, 85, 95, 100}
+
+	if slices.Compare(s, master) != 0 {
+		t.Fatalf("%v, %v", s, master)
+	}
+}
+
+func TestTreeRankSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(5))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	for i := 0; i < 1000; i += 3 {
+		tree.Delete(i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, kv := range bp3.Slice(loaded.Root) {
+		if rank := loaded.Rank(kv.Key); rank != i {
+			t.Fatalf("rank %d: %d != %d", kv.Key, rank, i)
+		}
+
+		if k, _, ok := loaded.At(i); !ok || k != kv.Key {
+			t.Fatalf("at %d: %d, %v", i, k, ok)
+		}
+	}
+
+	if c := loaded.CountRange(bp3.RangeValue[int]{Value: 100, Closed: true}, bp3.RangeValue[int]{Value: 200, Closed: false}); c != 67 {
+		t.Fatalf("count %d != %d", c, 67)
+	}
+}
+
+func TestTreePopSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	if k, v, ok := tree.PopMin(); !ok || k != 0 || v != "0" {
+		t.Fatalf("pop min: %d, %s, %v", k, v, ok)
+	}
+
+	if k, v, ok := tree.PopMax(); !ok || k != 99 || v != "99" {
+		t.Fatalf("pop max: %d, %s, %v", k, v, ok)
+	}
+
+	if s := tree.PopMinN(10); len(s) != 10 || s[0].Key != 1 || s[9].Key != 10 {
+		t.Fatalf("pop min: %v", s)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 88 {
+		t.Fatalf("size %d != %d", loaded.Count(), 88)
+	}
+
+	if k, _, ok := loaded.First(); !ok || k != 11 {
+		t.Fatalf("first: %d, %v", k, ok)
+	}
+
+	if k, _, ok := loaded.Last(); !ok || k != 98 {
+		t.Fatalf("last: %d, %v", k, ok)
+	}
+
+	for i := 11; i < 99; i++ {
+		if k, _, ok := loaded.PopMin(); !ok || k != i {
+			t.Fatalf("pop min: %d, %v != %d", k, ok, i)
+		}
+	}
+
+	if _, _, ok := loaded.PopMax(); ok {
+		t.Fatal("pop max of an empty tree")
+	}
+}
+
+func TestTreeDeleteRangeSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	if c := tree.DeleteRange(bp3.RangeValue[int]{Value: 100, Closed: true}, bp3.RangeValue[int]{Value: 900, Closed: false}); c != 800 {
+		t.Fatalf("delete range: %d", c)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 200 {
+		t.Fatalf("size %d != %d", loaded.Count(), 200)
+	}
+
+	var master []int
+
+	for i := 0; i < 100; i++ {
+		master = append(master, i)
+	}
+
+	for i := 900; i < 1000; i++ {
+		master = append(master, i)
+	}
+
+	var s []int
+
+	for k := range loaded.RangeClosed(0, 1000) {
+		s = append(s, k)
+	}
+
+	if slices.Compare(s, master) != 0 {
+		t.Fatalf("%v, %v", s, master)
+	}
+
+	if c := loaded.DeleteRange(bp3.RangeValue[int]{Value: 50, Closed: false}, bp3.RangeValue[int]{Value: 950, Closed: true}); c != 100 {
+		t.Fatalf("delete range: %d", c)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, ok := loaded.Find(i); ok != (i <= 50 || i > 950) {
+			t.Fatalf("find %d: %v", i, ok)
+		}
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTreeSplitJoinSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	left, right := loaded.SplitAt(300)
+
+	if left.Count() != 300 || right.Count() != 700 {
+		t.Fatalf("split %d, %d", left.Count(), right.Count())
+	}
+
+	for i := 1000; i < 1500; i++ {
+		right.Insert(i, fmt.Sprint(i))
+	}
+
+	joined, err := bp3.Join(left, right)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := disk.Flush(joined); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 1500 {
+		t.Fatalf("size %d != %d", loaded.Count(), 1500)
+	}
+
+	i := 0
+
+	for k, v := range loaded.RangeClosed(0, 1500) {
+		if k != i || v != fmt.Sprint(i) {
+			t.Fatalf("%d: %d, %s", i, k, v)
+		}
+
+		i++
+	}
+
+	if i != 1500 {
+		t.Fatalf("%d != %d", i, 1500)
+	}
+}
+
+func TestTreeConcurrentSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := disk.NewConcurrent(tree)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w; i < 400; i += 4 {
+				c.Insert(i, fmt.Sprint(i))
+
+				if i%40 == w {
+					if err := c.Flush(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(w)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 10; i++ {
+				prev := -1
+
+				for k, v := range c.FromClosed(0) {
+					if k <= prev || v != fmt.Sprint(k) {
+						t.Errorf("%d: %s after %d", k, v, prev)
+					}
+
+					prev = k
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 400 {
+		t.Fatalf("size %d != %d", loaded.Count(), 400)
+	}
+
+	for i := 0; i < 400; i++ {
+		if v, ok := loaded.Find(i); !ok || v != fmt.Sprint(i) {
+			t.Fatalf("find %d: %s, %v", i, v, ok)
+		}
+	}
+}
+
+func TestTreeTxSync(t *testing.T) {
+	test := func(flush bool) {
+		fs := afero.NewMemMapFs()
+
+		file, err := fs.Create("testo")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer file.Close()
+
+		page, err := fs.Create("page")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer page.Close()
+
+		tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(4))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 200; i += 2 {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		if err := disk.Flush(tree); err != nil {
+			t.Fatal(err)
+		}
+
+		// dirty before the transaction
+		tree.Insert(1, "1")
+
+		s0 := bp3.Slice(tree.Root)
+		tx := tree.Begin()
+
+		for i := 0; i < 100; i++ {
+			tx.Delete(i)
+			tx.Insert(i*3+1, "tx")
+		}
+
+		if flush {
+			// flushing in a transaction writes the changes, the rollback rewrites the restored nodes
+			if err := disk.Flush(tree); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tx.DeleteRange(bp3.RangeValue[int]{Value: 150, Closed: true}, bp3.RangeValue[int]{Value: 250, Closed: true})
+		tx.Rollback()
+
+		if s := bp3.Slice(tree.Root); !slices.Equal(s, s0) {
+			t.Fatalf("rolled back %v != %v", s, s0)
+		}
+
+		if err := disk.Flush(tree); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := disk.Load[int, string](file, page)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s := bp3.Slice(loaded.Root); !slices.Equal(s, s0) || loaded.Count() != len(s0) {
+			t.Fatalf("flush %v: loaded %v != %v", flush, s, s0)
+		}
+
+		if err := loaded.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	test(false)
+	test(true)
+}
+
+func TestTreeStatsSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithOrder(8))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sampling loads the nodes along the sampled paths only
+	sampled := loaded.Stats(1)
+
+	for i, level := range sampled.Levels {
+		if level.Visited != 1 || len(level.Sizes) != 1 || level.Sizes[0] <= 0 {
+			t.Fatalf("sampled level %d: %+v", i, level)
+		}
+	}
+
+	s := loaded.Stats(0)
+
+	if s.Height != sampled.Height || s.Leaves != s.LeafChain {
+		t.Fatalf("stats %+v", s)
+	}
+
+	for i, level := range s.Levels {
+		if len(level.Sizes) != level.Nodes {
+			t.Fatalf("level %d: %d sizes, %d nodes", i, len(level.Sizes), level.Nodes)
+		}
+
+		for _, size := range level.Sizes {
+			if size <= 0 {
+				t.Fatalf("level %d: size %d", i, size)
+			}
+		}
+	}
+}
+
+func TestTreeLeafCapacitySync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, string](file, page, disk.WithInternalOrder(4), disk.WithLeafCapacity(32))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	for i := 0; i < 2000; i += 3 {
+		tree.Delete(i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// the capacities are persisted with the tree
+	loaded, err := disk.Load[int, string](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Order != 4 || loaded.LeafCapacity != 32 {
+		t.Fatalf("order %d, leaf capacity %d", loaded.Order, loaded.LeafCapacity)
+	}
+
+	loaded.DeleteRange(bp3.RangeValue[int]{Value: 500, Closed: true}, bp3.RangeValue[int]{Value: 1500, Closed: false})
+
+	for i := 0; i < 2000; i += 3 {
+		loaded.Insert(i, fmt.Sprint(i))
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the multiples of 3 in the deleted range are back
+	if count := 2000 - 1000 + 333; loaded.Count() != count {
+		t.Fatalf("count %d != %d", loaded.Count(), count)
+	}
+
+	wide, err := fs.Create("wide")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer wide.Close()
+
+	// the internal order alone keeps the leaves at the capacity of the order
+	tree, err = disk.Initialize[int, string](wide, page, disk.WithOrder(4), disk.WithInternalOrder(64))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tree.Order != 64 || tree.LeafCapacity != 4 {
+		t.Fatalf("order %d, leaf capacity %d", tree.Order, tree.LeafCapacity)
+	}
+}
+
+func TestTreeAggregateSync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	sum := bp3.EqualMonoidFunc(int64(0), func(kv bp3.KeyValue[int, int]) int64 {
+		return int64(kv.Value)
+	}, func(a, b int64) int64 {
+		return a + b
+	}, func(a, b int64) bool {
+		return a == b
+	})
+
+	tree, err := disk.Initialize[int, int](file, page, disk.WithOrder(4), disk.WithMonoid(sum))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, i)
+	}
+
+	for i := 0; i < 1000; i += 3 {
+		tree.Delete(i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// the aggregates are persisted with the nodes
+	loaded, err := disk.Load[int, int](file, page, disk.WithMonoid(sum))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Root.Read().Aggregates) != len(loaded.Root.Read().Children) {
+		t.Fatalf("%d aggregates for %d children", len(loaded.Root.Read().Aggregates), len(loaded.Root.Read().Children))
+	}
+
+	from, to := bp3.RangeValue[int]{Value: 100, Closed: true}, bp3.RangeValue[int]{Value: 900, Closed: false}
+	var want int64
+
+	for _, v := range loaded.Range(from, to) {
+		want += int64(v)
+	}
+
+	if got := bp3.Aggregate[int64](loaded, from, to); got != want {
+		t.Fatalf("aggregate %d != %d", got, want)
+	}
+}
+
+// diskTree is a tree stored in a file of an in-memory file system, with its index in another.
+type diskTree[K cmp.Ordered, V any] struct {
+	*bp3.Instance[K, V]
+	file    afero.File
+	page    afero.File
+	options []disk.Option
+}
+
+// newDiskTree initializes a tree with the given options in a new in-memory file system.
+func newDiskTree[K cmp.Ordered, V any](t *testing.T, options ...disk.Option) *diskTree[K, V] {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		file.Close()
+		page.Close()
+	})
+
+	tree, err := disk.Initialize[K, V](file, page, options...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &diskTree[K, V]{Instance: tree, file: file, page: page, options: options}
+}
+
+// reload flushes a tree and loads it again from its files, with the options it was initialized with.
+func reload[K cmp.Ordered, V any](t *testing.T, tree *diskTree[K, V]) *diskTree[K, V] {
+	t.Helper()
+
+	if err := disk.Flush(tree.Instance); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[K, V](tree.file, tree.page, tree.options...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &diskTree[K, V]{Instance: loaded, file: tree.file, page: tree.page, options: tree.options}
+}
+
+func TestTreeTTLSync(t *testing.T) {
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+	tree := newDiskTree[int, string](t, disk.WithOrder(4), disk.WithClock(clock))
+
+	for i := 0; i < 500; i++ {
+		if i%2 == 0 {
+			tree.InsertWithTTL(i, fmt.Sprint(i), time.Minute)
+		} else {
+			tree.Insert(i, fmt.Sprint(i))
+		}
+
+		if i%100 == 0 {
+			tree = reload(t, tree)
+		}
+	}
+
+	// the deadlines and their index are persisted with the tree
+	loaded := reload(t, tree)
+
+	if _, found := loaded.Find(10); !found {
+		t.Fatal("pair expired early")
+	}
+
+	now = now.Add(time.Hour)
+
+	if _, found := loaded.Find(10); found {
+		t.Fatal("expired pair found")
+	}
+
+	if n := loaded.ExpireNow(); n != 250 {
+		t.Fatalf("%d pairs expired", n)
+	}
+
+	loaded = reload(t, loaded)
+
+	if loaded.Count() != 250 || loaded.Expiry.Size != 0 {
+		t.Fatalf("count %d, %d deadlines", loaded.Count(), loaded.Expiry.Size)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTreeTTLTxSync(t *testing.T) {
+	test := func(flush bool) {
+		now := time.Unix(1000, 0)
+		tree := newDiskTree[int, string](t, disk.WithOrder(4), disk.WithClock(func() time.Time { return now }))
+
+		for i := 0; i < 200; i += 2 {
+			tree.InsertWithTTL(i, fmt.Sprint(i), time.Duration(i)*time.Second)
+		}
+
+		tree = reload(t, tree)
+		tx := tree.Begin()
+
+		for i := 0; i < 100; i++ {
+			tx.Delete(i)
+			tx.InsertWithTTL(i*3+1, "tx", time.Minute)
+		}
+
+		if flush {
+			if err := disk.Flush(tree.Instance); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tx.Rollback()
+
+		loaded := reload(t, tree)
+
+		if err := loaded.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the deadlines are rolled back with the pairs
+		if loaded.Count() != 100 || loaded.Expiry.Size != 100 {
+			t.Fatalf("flush %v: count %d, %d deadlines", flush, loaded.Count(), loaded.Expiry.Size)
+		}
+
+		now = now.Add(100 * time.Second)
+
+		if n := loaded.ExpireNow(); n != 51 || loaded.Count() != 49 {
+			t.Fatalf("flush %v: %d expired, count %d", flush, n, loaded.Count())
+		}
+	}
+
+	test(false)
+	test(true)
+}
+
+func TestTreeHeaderSync(t *testing.T) {
+	tree := newDiskTree[int, string](t, disk.WithOrder(50))
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, fmt.Sprint(i))
+	}
+
+	tree = reload(t, tree)
+
+	// the deadlines grow the tree record past its previous size
+	tree.InsertWithTTL(5000, "x", time.Hour)
+
+	loaded := reload(t, tree)
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 1001 || loaded.Expiry.Size != 1 {
+		t.Fatalf("count %d, %d deadlines", loaded.Count(), loaded.Expiry.Size)
+	}
+
+	if v, found := loaded.Find(5000); !found || v != "x" {
+		t.Fatalf("found %v, value %q", found, v)
+	}
+}
+
+func TestTreeFormatSync(t *testing.T) {
+	load := func(file afero.File, page afero.File) error {
+		_, err := disk.Load[int, string](file, page)
+		return err
+	}
+
+	fs := afero.NewMemMapFs()
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	// the tree record written at the start of the store, before the format marker
+	legacy, err := fs.Create("legacy")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer legacy.Close()
+
+	if err := gob.NewEncoder(legacy).Encode(struct {
+		Root  [16]byte
+		Min   int
+		Order int
+		Size  int
+	}{Order: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	empty, err := fs.Create("empty")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer empty.Close()
+
+	for _, file := range []afero.File{legacy, empty} {
+		if err := load(file, page); !errors.Is(err, disk.ErrUnsupportedFormat) {
+			t.Fatalf("%s: %v, expected %v", file.Name(), err, disk.ErrUnsupportedFormat)
+		}
+	}
+
+	tree := newDiskTree[int, string](t)
+	tree.Insert(1, "1")
+	tree = reload(t, tree)
+
+	// a later format version
+	if _, err := tree.file.WriteAt([]byte{2}, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := load(tree.file, tree.page); !errors.Is(err, disk.ErrUnsupportedFormat) {
+		t.Fatalf("%v, expected %v", err, disk.ErrUnsupportedFormat)
+	}
+}
+
+func TestTreeFindManySync(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	file, err := fs.Create("testo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	page, err := fs.Create("page")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer page.Close()
+
+	tree, err := disk.Initialize[int, int](file, page, disk.WithOrder(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		tree.Insert(2*i, i)
+	}
+
+	if err := disk.Flush(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := disk.Load[int, int](file, page)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+
+	for k, v := range loaded.FindMany(slices.Values([]int{0, 1, 2, 3, 500, 998, 999})) {
+		if k != 2*v {
+			t.Fatalf("value of %d is %d", k, v)
+		}
+
+		n++
+	}
+
+	if n != 4 {
+		t.Fatalf("%d keys found", n)
+	}
+
+	n = 0
+
+	for k := range loaded.RangeMany([]struct{ From, To bp3.RangeValue[int] }{
+		{From: bp3.RangeValue[int]{Value: 900, Closed: true}, To: bp3.RangeValue[int]{Value: 910, Closed: false}},
+		{From: bp3.RangeValue[int]{Value: 10, Closed: true}, To: bp3.RangeValue[int]{Value: 20, Closed: true}},
+	}) {
+		if k%2 != 0 || (k < 10 || k > 20) && (k < 900 || k >= 910) {
+			t.Fatalf("key %d out of the ranges", k)
+		}
+
+		n++
+	}
+
+	if n != 11 {
+		t.Fatalf("%d pairs in the ranges", n)
+	}
+}
+
+func TestTreeLatchedSync(t *testing.T) {
+	tree := newDiskTree[int, string](t, disk.WithOrder(4))
+	l := disk.NewLatched(tree.Instance)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w; i < 400; i += 4 {
+				l.Insert(i, fmt.Sprint(i))
+
+				// every other multiple of 5 is removed again
+				if i%10 == 5 {
+					if _, ok := l.Delete(i); !ok {
+						t.Errorf("delete %d", i)
+					}
+				}
+
+				if i%40 == w {
+					if err := l.Flush(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := reload(t, tree)
+
+	if loaded.Count() != 360 {
+		t.Fatalf("size %d != %d", loaded.Count(), 360)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 400; i++ {
+		if v, ok := loaded.Find(i); ok != (i%10 != 5) || (ok && v != fmt.Sprint(i)) {
+			t.Fatalf("find %d: %s, %v", i, v, ok)
+		}
+	}
+
+	if rank := loaded.Rank(100); rank != 90 {
+		t.Fatalf("rank %d", rank)
+	}
+}